@@ -18,6 +18,11 @@ type Config struct {
 	UploadPath       string
 	AllowedOrigins   []string
 	TurnstileSecret  string
+	// WebsocketBroadcaster is either "memory" or "postgres".
+	// Postgres is required when running more than one server.
+	WebsocketBroadcaster string
+	// ServerId tells servers apart when they track connections, and should stay the same when the server restarts.
+	ServerId string
 	*JWTConfig
 	*PushNotificationConfig
 	*WebAuthnConfig
@@ -64,6 +69,23 @@ func NewConfig() (*Config, error) {
 		return nil, errors.New("TURNSTILE_SECRET was not set")
 	}
 
+	websocketBroadcaster := os.Getenv("WEBSOCKET_BROADCASTER")
+	if websocketBroadcaster == "" {
+		websocketBroadcaster = "memory"
+	}
+	if websocketBroadcaster != "memory" && websocketBroadcaster != "postgres" {
+		return nil, fmt.Errorf("invalid WEBSOCKET_BROADCASTER was provided: %s", websocketBroadcaster)
+	}
+
+	serverId := os.Getenv("SERVER_ID")
+	if serverId == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("SERVER_ID was not set and the hostname could not be used instead: %v", err)
+		}
+		serverId = hostname
+	}
+
 	jwtConfig, err := loadJWTConfig()
 	if err != nil {
 		return nil, err
@@ -82,6 +104,8 @@ func NewConfig() (*Config, error) {
 		UploadPath:             uploadPath,
 		AllowedOrigins:         origins,
 		TurnstileSecret:        turnstileSecret,
+		WebsocketBroadcaster:   websocketBroadcaster,
+		ServerId:               serverId,
 		JWTConfig:              jwtConfig,
 		PushNotificationConfig: pushNotificationConfig,
 		WebAuthnConfig:         webAuthnConfig,
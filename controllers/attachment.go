@@ -65,8 +65,7 @@ func (a *Attachment) uploadAttachment(w http.ResponseWriter, r *http.Request) {
 	output.FilePath = ""
 	output.FileSize = 0
 	output.MimeType = ""
-	w.WriteHeader(http.StatusCreated)
-	if err = writeJsonBody(w, *output); err != nil {
+	if err = writeJsonBodyStatus(w, http.StatusCreated, *output); err != nil {
 		handleError(w, r, a.logger, err, claims, http.StatusInternalServerError, "error")
 		return
 	}
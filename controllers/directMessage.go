@@ -0,0 +1,256 @@
+package controllers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"tranquility/app"
+	"tranquility/data"
+	"tranquility/models"
+	"tranquility/services"
+)
+
+type DirectMessage struct {
+	logger          services.Logger
+	database        data.IDatabase
+	websocketServer *services.WebsocketServer
+}
+
+func NewDirectMessageController(logger services.Logger, database data.IDatabase, websocketServer *services.WebsocketServer) *DirectMessage {
+	return &DirectMessage{logger, database, websocketServer}
+}
+
+func (d *DirectMessage) RegisterRoutes(app *app.App) {
+	app.AddSecureRoute("GET", "/api/dm", d.getDirectMessageChannels)
+	app.AddSecureRoute("GET", "/api/dm/{channelId}", d.getDirectMessageChannel)
+	app.AddSecureRoute("GET", "/api/dm/{channelId}/message", d.getDirectMessages)
+	app.AddSecureRoute("GET", "/api/dm/{channelId}/message/{messageId}/thread", d.getDirectMessages)
+	app.AddSecureRoute("GET", "/api/dm/{channelId}/message/{messageId}/thread/participant", d.getThreadParticipants)
+	app.AddSecureRoute("POST", "/api/dm", d.createDirectMessage)
+	app.AddSecureRoute("POST", "/api/dm/{channelId}/member/{userId}", d.addDirectMessageMember)
+	app.AddSecureRoute("DELETE", "/api/dm/{channelId}/member", d.leaveDirectMessage)
+}
+
+func (d *DirectMessage) getDirectMessageChannels(w http.ResponseWriter, r *http.Request) {
+	claims, err := getClaims(r)
+	if err != nil {
+		handleError(w, r, d.logger, err, nil, http.StatusUnauthorized, "error")
+		return
+	}
+
+	channels, err := d.database.GetDirectMessageChannels(r.Context(), claims.ID)
+	if err != nil {
+		handleError(w, r, d.logger, err, claims, http.StatusInternalServerError, "error")
+		return
+	}
+
+	if err = writeJsonBody(w, channels); err != nil {
+		handleError(w, r, d.logger, err, claims, http.StatusInternalServerError, "error")
+		return
+	}
+}
+
+func (d *DirectMessage) getDirectMessageChannel(w http.ResponseWriter, r *http.Request) {
+	claims, err := getClaims(r)
+	if err != nil {
+		handleError(w, r, d.logger, err, nil, http.StatusUnauthorized, "error")
+		return
+	}
+
+	channelId, err := strconv.ParseInt(r.PathValue("channelId"), 10, 32)
+	if err != nil {
+		handleError(w, r, d.logger, err, claims, http.StatusBadRequest, "warning")
+		return
+	}
+
+	channel, err := d.database.GetDirectMessageChannel(r.Context(), int32(channelId), claims.ID)
+	if err != nil {
+		d.handleDirectMessageError(w, r, err, claims)
+		return
+	}
+
+	if err = writeJsonBody(w, channel); err != nil {
+		handleError(w, r, d.logger, err, claims, http.StatusInternalServerError, "error")
+		return
+	}
+}
+
+func (d *DirectMessage) getDirectMessages(w http.ResponseWriter, r *http.Request) {
+	claims, err := getClaims(r)
+	if err != nil {
+		handleError(w, r, d.logger, err, nil, http.StatusUnauthorized, "error")
+		return
+	}
+
+	channelId, channelErr := strconv.ParseInt(r.PathValue("channelId"), 10, 32)
+	query, queryErr := getMessageQuery(r)
+	threadId, threadErr := getThreadId(r)
+	if channelErr != nil || queryErr != nil || threadErr != nil {
+		handleError(w, r, d.logger, errors.Join(channelErr, queryErr, threadErr), claims, http.StatusBadRequest, "warning")
+		return
+	}
+	query.ThreadId = threadId
+
+	if err := requireChannelPermission(r.Context(), d.database, int32(channelId), claims.ID, models.PermissionViewChannel); err != nil {
+		handlePermissionError(w, r, d.logger, err, claims)
+		return
+	}
+
+	// Direct messages don't belong to a guild, which is represented by a guild id of 0.
+	page, err := d.database.GetChannelMessages(r.Context(), claims.ID, 0, int32(channelId), query)
+	if err != nil {
+		handleError(w, r, d.logger, err, claims, http.StatusInternalServerError, "error")
+		return
+	}
+
+	if err = writeJsonBody(w, page); err != nil {
+		handleError(w, r, d.logger, err, claims, http.StatusInternalServerError, "error")
+		return
+	}
+}
+
+func (d *DirectMessage) getThreadParticipants(w http.ResponseWriter, r *http.Request) {
+	claims, err := getClaims(r)
+	if err != nil {
+		handleError(w, r, d.logger, err, nil, http.StatusUnauthorized, "error")
+		return
+	}
+
+	channelId, channelErr := strconv.ParseInt(r.PathValue("channelId"), 10, 32)
+	threadId, threadErr := strconv.ParseInt(r.PathValue("messageId"), 10, 32)
+	if channelErr != nil || threadErr != nil {
+		handleError(w, r, d.logger, errors.Join(channelErr, threadErr), claims, http.StatusBadRequest, "warning")
+		return
+	}
+
+	participants, err := d.database.GetThreadParticipants(r.Context(), int32(channelId), int32(threadId), claims.ID)
+	if err != nil {
+		d.handleDirectMessageError(w, r, err, claims)
+		return
+	}
+
+	if err = writeJsonBody(w, participants); err != nil {
+		handleError(w, r, d.logger, err, claims, http.StatusInternalServerError, "error")
+		return
+	}
+}
+
+func (d *DirectMessage) createDirectMessage(w http.ResponseWriter, r *http.Request) {
+	claims, err := getClaims(r)
+	if err != nil {
+		handleError(w, r, d.logger, err, nil, http.StatusUnauthorized, "error")
+		return
+	}
+
+	body, err := getJsonBody[models.DirectMessageRequest](r)
+	if err != nil || len(body.UserIds) == 0 {
+		handleError(w, r, d.logger, fmt.Errorf("an invalid direct message was provided: %v", err), claims, http.StatusBadRequest, "warning")
+		return
+	}
+
+	channel, created, err := d.database.CreateDirectMessage(r.Context(), claims.ID, body)
+	if err != nil {
+		d.handleDirectMessageError(w, r, err, claims)
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		d.notifyParticipants(claims, channel, models.NewWebsocketMessage("dm_create", channel))
+		status = http.StatusCreated
+	}
+	if err = writeJsonBodyStatus(w, status, channel); err != nil {
+		handleError(w, r, d.logger, err, claims, http.StatusInternalServerError, "error")
+		return
+	}
+}
+
+func (d *DirectMessage) addDirectMessageMember(w http.ResponseWriter, r *http.Request) {
+	claims, err := getClaims(r)
+	if err != nil {
+		handleError(w, r, d.logger, err, nil, http.StatusUnauthorized, "error")
+		return
+	}
+
+	channelId, channelErr := strconv.ParseInt(r.PathValue("channelId"), 10, 32)
+	userId, userErr := strconv.ParseInt(r.PathValue("userId"), 10, 32)
+	if channelErr != nil || userErr != nil {
+		handleError(w, r, d.logger, errors.Join(channelErr, userErr), claims, http.StatusBadRequest, "warning")
+		return
+	}
+
+	if err := d.database.AddDirectMessageMember(r.Context(), int32(channelId), claims.ID, int32(userId)); err != nil {
+		d.handleDirectMessageError(w, r, err, claims)
+		return
+	}
+
+	channel, err := d.database.GetDirectMessageChannel(r.Context(), int32(channelId), claims.ID)
+	if err != nil {
+		handleError(w, r, d.logger, err, claims, http.StatusInternalServerError, "error")
+		return
+	}
+
+	d.notifyParticipants(claims, channel, models.NewWebsocketMessage("dm_update", channel))
+	if err = writeJsonBody(w, channel); err != nil {
+		handleError(w, r, d.logger, err, claims, http.StatusInternalServerError, "error")
+		return
+	}
+}
+
+func (d *DirectMessage) leaveDirectMessage(w http.ResponseWriter, r *http.Request) {
+	claims, err := getClaims(r)
+	if err != nil {
+		handleError(w, r, d.logger, err, nil, http.StatusUnauthorized, "error")
+		return
+	}
+
+	channelId, err := strconv.ParseInt(r.PathValue("channelId"), 10, 32)
+	if err != nil {
+		handleError(w, r, d.logger, err, claims, http.StatusBadRequest, "warning")
+		return
+	}
+
+	// The participants are collected first so everyone, including the user leaving, sees the new member list.
+	channel, err := d.database.GetDirectMessageChannel(r.Context(), int32(channelId), claims.ID)
+	if err != nil {
+		d.handleDirectMessageError(w, r, err, claims)
+		return
+	}
+
+	if err := d.database.LeaveDirectMessage(r.Context(), channel.ID, claims.ID); err != nil {
+		d.handleDirectMessageError(w, r, err, claims)
+		return
+	}
+
+	receivers := make(map[int32]bool, len(channel.Members))
+	remaining := make([]models.AuthUser, 0, len(channel.Members))
+	for _, member := range channel.Members {
+		receivers[member.ID] = true
+		if member.ID != claims.ID {
+			remaining = append(remaining, member)
+		}
+	}
+	channel.Members = remaining
+	notify(d.logger, d.websocketServer, claims.ID, models.NewWebsocketMessage("dm_update", channel), receivers)
+}
+
+func (d *DirectMessage) handleDirectMessageError(w http.ResponseWriter, r *http.Request, err error, claims *models.Claims) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		handleError(w, r, d.logger, err, claims, http.StatusNotFound, "warning")
+	case errors.Is(err, data.ErrDirectMessageNotAllowed), errors.Is(err, data.ErrDirectMessageFull), errors.Is(err, data.ErrDuplicateMember):
+		handleError(w, r, d.logger, err, claims, http.StatusBadRequest, "warning", err.Error())
+	default:
+		handlePermissionError(w, r, d.logger, err, claims)
+	}
+}
+
+func (d *DirectMessage) notifyParticipants(claims *models.Claims, channel *models.Channel, event *models.WebsocketMessage) {
+	receivers := make(map[int32]bool, len(channel.Members))
+	for _, member := range channel.Members {
+		receivers[member.ID] = true
+	}
+	notify(d.logger, d.websocketServer, claims.ID, event, receivers)
+}
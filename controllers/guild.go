@@ -2,6 +2,7 @@ package controllers
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -12,12 +13,13 @@ import (
 )
 
 type Guild struct {
-	logger   services.Logger
-	database data.IDatabase
+	logger          services.Logger
+	database        data.IDatabase
+	websocketServer *services.WebsocketServer
 }
 
-func NewGuildController(logger services.Logger, database data.IDatabase) *Guild {
-	return &Guild{logger, database}
+func NewGuildController(logger services.Logger, database data.IDatabase, websocketServer *services.WebsocketServer) *Guild {
+	return &Guild{logger, database, websocketServer}
 }
 
 func (g *Guild) RegisterRoutes(app *app.App) {
@@ -30,6 +32,17 @@ func (g *Guild) RegisterRoutes(app *app.App) {
 	app.AddSecureRoute("POST", "/api/guild", g.createGuild)
 	app.AddSecureRoute("POST", "/api/guild/{guildId}/channel", g.createChannel)
 	app.AddSecureRoute("POST", "/api/guild/{guildId}/member", g.createMember)
+	app.AddSecureRoute("PATCH", "/api/guild/{guildId}", g.updateGuild)
+	app.AddSecureRoute("DELETE", "/api/guild/{guildId}", g.deleteGuild)
+	app.AddSecureRoute("PATCH", "/api/guild/{guildId}/channel/order", g.reorderChannels)
+	app.AddSecureRoute("PATCH", "/api/guild/{guildId}/channel/{channelId}", g.updateChannel)
+	app.AddSecureRoute("DELETE", "/api/guild/{guildId}/channel/{channelId}", g.deleteChannel)
+	app.AddSecureRoute("DELETE", "/api/guild/{guildId}/member", g.leaveGuild)
+	app.AddSecureRoute("DELETE", "/api/guild/{guildId}/member/{userId}", g.kickMember)
+	app.AddSecureRoute("GET", "/api/guild/{guildId}/ban", g.getGuildBans)
+	app.AddSecureRoute("POST", "/api/guild/{guildId}/ban/{userId}", g.banMember)
+	app.AddSecureRoute("DELETE", "/api/guild/{guildId}/ban/{userId}", g.unbanMember)
+	app.AddSecureRoute("GET", "/api/guild/{guildId}/audit-log", g.getAuditLog)
 }
 
 func (g *Guild) getAllGuilds(w http.ResponseWriter, r *http.Request) {
@@ -260,6 +273,11 @@ func (g *Guild) createChannel(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := requireGuildPermission(r.Context(), g.database, body.GuildId, claims.ID, models.PermissionManageChannels); err != nil {
+		handlePermissionError(w, r, g.logger, err, claims)
+		return
+	}
+
 	channel, err := g.database.CreateChannel(r.Context(), body, claims.ID)
 	if err != nil {
 		if err == data.ErrUserLacksPermission {
@@ -271,6 +289,7 @@ func (g *Guild) createChannel(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	writeAuditLog(r, g.database, g.logger, claims, channel.GuildId, models.AuditChannelCreate, channel.ID, channel)
 	if err = writeJsonBody(w, channel); err != nil {
 		handleError(w, r, g.logger, err, nil, http.StatusInternalServerError, "error")
 	}
@@ -300,17 +319,459 @@ func (g *Guild) createMember(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := requireGuildPermission(r.Context(), g.database, int32(guildId), claims.ID, models.PermissionInviteMembers); err != nil {
+		handlePermissionError(w, r, g.logger, err, claims)
+		return
+	}
+
 	newMember, err := g.database.CreateMember(r.Context(), body)
 	if err != nil {
 		if err == data.ErrDuplicateMember {
 			handleError(w, r, g.logger, err, nil, http.StatusBadRequest, "warning", err.Error())
 			return
 		}
+		if err == data.ErrMemberBanned {
+			handleError(w, r, g.logger, err, nil, http.StatusForbidden, "warning", err.Error())
+			return
+		}
 		handleError(w, r, g.logger, err, nil, http.StatusInternalServerError, "error")
 		return
 	}
 
+	writeAuditLog(r, g.database, g.logger, claims, int32(guildId), models.AuditMemberAdd, int32(newMember.UserId), newMember)
 	if err = writeJsonBody(w, newMember); err != nil {
 		handleError(w, r, g.logger, err, nil, http.StatusInternalServerError, "error")
 	}
 }
+
+func (g *Guild) updateGuild(w http.ResponseWriter, r *http.Request) {
+	claims, err := getClaims(r)
+	if err != nil {
+		handleError(w, r, g.logger, err, nil, http.StatusUnauthorized, "error")
+		return
+	}
+
+	body, err := getJsonBody[models.GuildUpdate](r)
+	if err != nil {
+		handleError(w, r, g.logger, err, claims, http.StatusBadRequest, "warning")
+		return
+	}
+
+	guildId, err := strconv.ParseInt(r.PathValue("guildId"), 10, 32)
+	if err != nil {
+		handleError(w, r, g.logger, err, claims, http.StatusBadRequest, "warning")
+		return
+	}
+	body.ID = int32(guildId)
+
+	if err := requireGuildPermission(r.Context(), g.database, body.ID, claims.ID, models.PermissionManageGuild); err != nil {
+		handlePermissionError(w, r, g.logger, err, claims)
+		return
+	}
+
+	guild, err := g.database.UpdateGuild(r.Context(), body)
+	if err != nil {
+		handlePermissionError(w, r, g.logger, err, claims)
+		return
+	}
+
+	writeAuditLog(r, g.database, g.logger, claims, guild.ID, models.AuditGuildUpdate, guild.ID, guild)
+	g.notifyGuild(r, claims, guild.ID, models.NewWebsocketMessage("guild_update", guild))
+	if err = writeJsonBody(w, guild); err != nil {
+		handleError(w, r, g.logger, err, claims, http.StatusInternalServerError, "error")
+		return
+	}
+}
+
+// Only the owner is able to delete a guild, regardless of their permissions.
+func (g *Guild) deleteGuild(w http.ResponseWriter, r *http.Request) {
+	claims, err := getClaims(r)
+	if err != nil {
+		handleError(w, r, g.logger, err, nil, http.StatusUnauthorized, "error")
+		return
+	}
+
+	guildId, err := strconv.ParseInt(r.PathValue("guildId"), 10, 32)
+	if err != nil {
+		handleError(w, r, g.logger, err, claims, http.StatusBadRequest, "warning")
+		return
+	}
+
+	guild, err := g.database.GetGuildByID(r.Context(), int32(guildId), claims.ID)
+	if err != nil {
+		handlePermissionError(w, r, g.logger, err, claims)
+		return
+	}
+	if guild.OwnerId != claims.ID {
+		handlePermissionError(w, r, g.logger, data.ErrUserLacksPermission, claims)
+		return
+	}
+
+	// Members have to be collected before the guild is deleted because they are removed with it.
+	receivers, err := g.database.GetGuildMemberIds(r.Context(), guild.ID)
+	if err != nil {
+		handleError(w, r, g.logger, err, claims, http.StatusInternalServerError, "error")
+		return
+	}
+
+	if err := g.database.DeleteGuild(r.Context(), guild.ID); err != nil {
+		handlePermissionError(w, r, g.logger, err, claims)
+		return
+	}
+
+	notify(g.logger, g.websocketServer, claims.ID, models.NewWebsocketMessage("guild_delete", &models.Guild{ID: guild.ID}), receivers)
+}
+
+func (g *Guild) updateChannel(w http.ResponseWriter, r *http.Request) {
+	claims, err := getClaims(r)
+	if err != nil {
+		handleError(w, r, g.logger, err, nil, http.StatusUnauthorized, "error")
+		return
+	}
+
+	body, err := getJsonBody[models.Channel](r)
+	if err != nil {
+		handleError(w, r, g.logger, err, claims, http.StatusBadRequest, "warning")
+		return
+	}
+
+	guildId, guildErr := strconv.ParseInt(r.PathValue("guildId"), 10, 32)
+	channelId, channelErr := strconv.ParseInt(r.PathValue("channelId"), 10, 32)
+	if guildErr != nil || channelErr != nil {
+		handleError(w, r, g.logger, errors.Join(guildErr, channelErr), claims, http.StatusBadRequest, "warning")
+		return
+	}
+	body.ID = int32(channelId)
+	body.GuildId = int32(guildId)
+
+	if err := requireGuildPermission(r.Context(), g.database, body.GuildId, claims.ID, models.PermissionManageChannels); err != nil {
+		handlePermissionError(w, r, g.logger, err, claims)
+		return
+	}
+
+	channel, err := g.database.UpdateChannel(r.Context(), body)
+	if err != nil {
+		handlePermissionError(w, r, g.logger, err, claims)
+		return
+	}
+
+	writeAuditLog(r, g.database, g.logger, claims, channel.GuildId, models.AuditChannelUpdate, channel.ID, channel)
+	g.notifyGuild(r, claims, channel.GuildId, models.NewWebsocketMessage("channel_update", channel))
+	if err = writeJsonBody(w, channel); err != nil {
+		handleError(w, r, g.logger, err, claims, http.StatusInternalServerError, "error")
+		return
+	}
+}
+
+func (g *Guild) deleteChannel(w http.ResponseWriter, r *http.Request) {
+	claims, err := getClaims(r)
+	if err != nil {
+		handleError(w, r, g.logger, err, nil, http.StatusUnauthorized, "error")
+		return
+	}
+
+	guildId, guildErr := strconv.ParseInt(r.PathValue("guildId"), 10, 32)
+	channelId, channelErr := strconv.ParseInt(r.PathValue("channelId"), 10, 32)
+	if guildErr != nil || channelErr != nil {
+		handleError(w, r, g.logger, errors.Join(guildErr, channelErr), claims, http.StatusBadRequest, "warning")
+		return
+	}
+
+	if err := requireGuildPermission(r.Context(), g.database, int32(guildId), claims.ID, models.PermissionManageChannels); err != nil {
+		handlePermissionError(w, r, g.logger, err, claims)
+		return
+	}
+
+	if err := g.database.DeleteChannel(r.Context(), int32(guildId), int32(channelId)); err != nil {
+		handlePermissionError(w, r, g.logger, err, claims)
+		return
+	}
+
+	channel := &models.Channel{ID: int32(channelId), GuildId: int32(guildId)}
+	writeAuditLog(r, g.database, g.logger, claims, channel.GuildId, models.AuditChannelDelete, channel.ID, nil)
+	g.notifyGuild(r, claims, channel.GuildId, models.NewWebsocketMessage("channel_delete", channel))
+}
+
+// reorderChannels only needs the id and position of the channels that moved.
+func (g *Guild) reorderChannels(w http.ResponseWriter, r *http.Request) {
+	claims, err := getClaims(r)
+	if err != nil {
+		handleError(w, r, g.logger, err, nil, http.StatusUnauthorized, "error")
+		return
+	}
+
+	body, err := getJsonBody[models.ChannelOrder](r)
+	if err != nil {
+		handleError(w, r, g.logger, err, claims, http.StatusBadRequest, "warning")
+		return
+	}
+
+	guildId, err := strconv.ParseInt(r.PathValue("guildId"), 10, 32)
+	if err != nil || len(body.Channels) == 0 {
+		handleError(w, r, g.logger, fmt.Errorf("an invalid channel order was provided: %v", err), claims, http.StatusBadRequest, "warning")
+		return
+	}
+	body.GuildId = int32(guildId)
+
+	if err := requireGuildPermission(r.Context(), g.database, body.GuildId, claims.ID, models.PermissionManageChannels); err != nil {
+		handlePermissionError(w, r, g.logger, err, claims)
+		return
+	}
+
+	if err := g.database.ReorderChannels(r.Context(), body); err != nil {
+		handlePermissionError(w, r, g.logger, err, claims)
+		return
+	}
+	writeAuditLog(r, g.database, g.logger, claims, body.GuildId, models.AuditChannelReorder, 0, body.Channels)
+
+	channels, err := g.database.GetGuildChannels(r.Context(), body.GuildId, claims.ID)
+	if err != nil {
+		handleError(w, r, g.logger, err, claims, http.StatusInternalServerError, "error")
+		return
+	}
+
+	order := &models.ChannelOrder{GuildId: body.GuildId, Channels: channels}
+	g.notifyGuild(r, claims, order.GuildId, models.NewWebsocketMessage("channel_reorder", order))
+	if err = writeJsonBody(w, channels); err != nil {
+		handleError(w, r, g.logger, err, claims, http.StatusInternalServerError, "error")
+		return
+	}
+}
+
+// The guild owner can't leave and has to delete the guild instead.
+func (g *Guild) leaveGuild(w http.ResponseWriter, r *http.Request) {
+	claims, err := getClaims(r)
+	if err != nil {
+		handleError(w, r, g.logger, err, nil, http.StatusUnauthorized, "error")
+		return
+	}
+
+	guildId, err := strconv.ParseInt(r.PathValue("guildId"), 10, 32)
+	if err != nil {
+		handleError(w, r, g.logger, err, claims, http.StatusBadRequest, "warning")
+		return
+	}
+
+	g.removeMember(w, r, claims, int32(guildId), claims.ID)
+}
+
+func (g *Guild) kickMember(w http.ResponseWriter, r *http.Request) {
+	claims, err := getClaims(r)
+	if err != nil {
+		handleError(w, r, g.logger, err, nil, http.StatusUnauthorized, "error")
+		return
+	}
+
+	guildId, guildErr := strconv.ParseInt(r.PathValue("guildId"), 10, 32)
+	userId, userErr := strconv.ParseInt(r.PathValue("userId"), 10, 32)
+	if guildErr != nil || userErr != nil {
+		handleError(w, r, g.logger, errors.Join(guildErr, userErr), claims, http.StatusBadRequest, "warning")
+		return
+	}
+
+	if err := requireGuildPermission(r.Context(), g.database, int32(guildId), claims.ID, models.PermissionKickMembers); err != nil {
+		handlePermissionError(w, r, g.logger, err, claims)
+		return
+	}
+	if err := requireModeratable(r.Context(), g.database, int32(guildId), claims.ID, int32(userId)); err != nil {
+		handlePermissionError(w, r, g.logger, err, claims)
+		return
+	}
+
+	if !g.removeMember(w, r, claims, int32(guildId), int32(userId)) {
+		return
+	}
+	writeAuditLog(r, g.database, g.logger, claims, int32(guildId), models.AuditMemberKick, int32(userId), nil)
+}
+
+// removeMember returns false when the member could not be removed and an error has been written.
+func (g *Guild) removeMember(w http.ResponseWriter, r *http.Request, claims *models.Claims, guildId, userId int32) bool {
+	// Members are collected first so the removed user is also told they are no longer in the guild.
+	receivers, err := g.database.GetGuildMemberIds(r.Context(), guildId)
+	if err != nil {
+		handleError(w, r, g.logger, err, claims, http.StatusInternalServerError, "error")
+		return false
+	}
+
+	if err := g.database.RemoveMember(r.Context(), guildId, userId); err != nil {
+		g.handleMemberError(w, r, err, claims)
+		return false
+	}
+
+	member := &models.Member{UserId: int(userId), GuildId: int(guildId)}
+	notify(g.logger, g.websocketServer, claims.ID, models.NewWebsocketMessage("member_remove", member), receivers)
+	return true
+}
+
+func (g *Guild) getGuildBans(w http.ResponseWriter, r *http.Request) {
+	claims, err := getClaims(r)
+	if err != nil {
+		handleError(w, r, g.logger, err, nil, http.StatusUnauthorized, "error")
+		return
+	}
+
+	guildId, err := strconv.ParseInt(r.PathValue("guildId"), 10, 32)
+	if err != nil {
+		handleError(w, r, g.logger, err, claims, http.StatusBadRequest, "warning")
+		return
+	}
+
+	if err := requireGuildPermission(r.Context(), g.database, int32(guildId), claims.ID, models.PermissionBanMembers); err != nil {
+		handlePermissionError(w, r, g.logger, err, claims)
+		return
+	}
+
+	bans, err := g.database.GetGuildBans(r.Context(), int32(guildId))
+	if err != nil {
+		handleError(w, r, g.logger, err, claims, http.StatusInternalServerError, "error")
+		return
+	}
+
+	if err = writeJsonBody(w, bans); err != nil {
+		handleError(w, r, g.logger, err, claims, http.StatusInternalServerError, "error")
+		return
+	}
+}
+
+func (g *Guild) banMember(w http.ResponseWriter, r *http.Request) {
+	claims, err := getClaims(r)
+	if err != nil {
+		handleError(w, r, g.logger, err, nil, http.StatusUnauthorized, "error")
+		return
+	}
+
+	body, err := getJsonBody[models.Ban](r)
+	if err != nil {
+		handleError(w, r, g.logger, err, claims, http.StatusBadRequest, "warning")
+		return
+	}
+
+	guildId, guildErr := strconv.ParseInt(r.PathValue("guildId"), 10, 32)
+	userId, userErr := strconv.ParseInt(r.PathValue("userId"), 10, 32)
+	if guildErr != nil || userErr != nil || body.Duration < 0 || int32(userId) == claims.ID {
+		handleError(w, r, g.logger, fmt.Errorf("an invalid ban was provided: %v", errors.Join(guildErr, userErr)), claims, http.StatusBadRequest, "warning")
+		return
+	}
+	body.GuildId = int32(guildId)
+	body.UserId = int32(userId)
+	body.BannedBy = &claims.ID
+
+	if err := requireGuildPermission(r.Context(), g.database, body.GuildId, claims.ID, models.PermissionBanMembers); err != nil {
+		handlePermissionError(w, r, g.logger, err, claims)
+		return
+	}
+	if err := requireModeratable(r.Context(), g.database, body.GuildId, claims.ID, body.UserId); err != nil {
+		handlePermissionError(w, r, g.logger, err, claims)
+		return
+	}
+
+	// The banned user might not be a member anymore, but they are still told in case they have the guild open.
+	receivers, err := g.database.GetGuildMemberIds(r.Context(), body.GuildId)
+	if err != nil {
+		handleError(w, r, g.logger, err, claims, http.StatusInternalServerError, "error")
+		return
+	}
+	receivers[body.UserId] = true
+
+	ban, err := g.database.BanMember(r.Context(), body)
+	if err != nil {
+		g.handleMemberError(w, r, err, claims)
+		return
+	}
+
+	writeAuditLog(r, g.database, g.logger, claims, ban.GuildId, models.AuditMemberBan, ban.UserId, ban)
+	member := &models.Member{UserId: int(ban.UserId), GuildId: int(ban.GuildId)}
+	notify(g.logger, g.websocketServer, claims.ID, models.NewWebsocketMessage("member_remove", member), receivers)
+
+	if err = writeJsonBodyStatus(w, http.StatusCreated, ban); err != nil {
+		handleError(w, r, g.logger, err, claims, http.StatusInternalServerError, "error")
+		return
+	}
+}
+
+func (g *Guild) unbanMember(w http.ResponseWriter, r *http.Request) {
+	claims, err := getClaims(r)
+	if err != nil {
+		handleError(w, r, g.logger, err, nil, http.StatusUnauthorized, "error")
+		return
+	}
+
+	guildId, guildErr := strconv.ParseInt(r.PathValue("guildId"), 10, 32)
+	userId, userErr := strconv.ParseInt(r.PathValue("userId"), 10, 32)
+	if guildErr != nil || userErr != nil {
+		handleError(w, r, g.logger, errors.Join(guildErr, userErr), claims, http.StatusBadRequest, "warning")
+		return
+	}
+
+	if err := requireGuildPermission(r.Context(), g.database, int32(guildId), claims.ID, models.PermissionBanMembers); err != nil {
+		handlePermissionError(w, r, g.logger, err, claims)
+		return
+	}
+
+	if err := g.database.UnbanMember(r.Context(), int32(guildId), int32(userId)); err != nil {
+		handlePermissionError(w, r, g.logger, err, claims)
+		return
+	}
+
+	writeAuditLog(r, g.database, g.logger, claims, int32(guildId), models.AuditMemberUnban, int32(userId), nil)
+}
+
+func (g *Guild) getAuditLog(w http.ResponseWriter, r *http.Request) {
+	claims, err := getClaims(r)
+	if err != nil {
+		handleError(w, r, g.logger, err, nil, http.StatusUnauthorized, "error")
+		return
+	}
+
+	guildId, err := strconv.ParseInt(r.PathValue("guildId"), 10, 32)
+	if err != nil {
+		handleError(w, r, g.logger, err, claims, http.StatusBadRequest, "warning")
+		return
+	}
+
+	query, err := getAuditLogQuery(r)
+	if err != nil {
+		handleError(w, r, g.logger, err, claims, http.StatusBadRequest, "warning", err.Error())
+		return
+	}
+
+	if err := requireGuildPermission(r.Context(), g.database, int32(guildId), claims.ID, models.PermissionManageGuild); err != nil {
+		handlePermissionError(w, r, g.logger, err, claims)
+		return
+	}
+
+	page, err := g.database.GetAuditLog(r.Context(), int32(guildId), query)
+	if err != nil {
+		handleError(w, r, g.logger, err, claims, http.StatusInternalServerError, "error")
+		return
+	}
+
+	if err = writeJsonBody(w, page); err != nil {
+		handleError(w, r, g.logger, err, claims, http.StatusInternalServerError, "error")
+		return
+	}
+}
+
+func (g *Guild) handleMemberError(w http.ResponseWriter, r *http.Request, err error, claims *models.Claims) {
+	if errors.Is(err, data.ErrMemberNotFound) {
+		handleError(w, r, g.logger, err, claims, http.StatusNotFound, "warning", err.Error())
+		return
+	}
+	if errors.Is(err, data.ErrOwnerCannotLeave) {
+		handleError(w, r, g.logger, err, claims, http.StatusConflict, "warning", err.Error())
+		return
+	}
+	handlePermissionError(w, r, g.logger, err, claims)
+}
+
+// notifyGuild sends the event to every member of the guild connected to the websocket server.
+func (g *Guild) notifyGuild(r *http.Request, claims *models.Claims, guildId int32, event *models.WebsocketMessage) {
+	receivers, err := g.database.GetGuildMemberIds(r.Context(), guildId)
+	if err != nil {
+		g.logger.ERROR(fmt.Sprintf("an error occurred while collecting guild members to send %s: %v", event.Type, err))
+		return
+	}
+
+	receivers[claims.ID] = true
+	notify(g.logger, g.websocketServer, claims.ID, event, receivers)
+}
@@ -0,0 +1,54 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"tranquility/data"
+	"tranquility/middleware"
+	"tranquility/models"
+	"tranquility/services"
+)
+
+// ownedGuildDatabase is a guild owned by user 1, anything else panics on the nil IDatabase.
+type ownedGuildDatabase struct {
+	data.IDatabase
+}
+
+func (o *ownedGuildDatabase) GetGuildMemberIds(ctx context.Context, guildId int32) (map[int32]bool, error) {
+	return map[int32]bool{1: true, 2: true}, nil
+}
+
+func (o *ownedGuildDatabase) RemoveMember(ctx context.Context, guildId, userId int32) error {
+	if userId == 1 {
+		return data.ErrOwnerCannotLeave
+	}
+	return nil
+}
+
+func serveLeaveGuild(controller *Guild, userId int32) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("DELETE", "/api/guild/1/member", nil)
+	r = r.WithContext(context.WithValue(r.Context(), middleware.ClaimsContextKey, &models.Claims{ID: userId, Username: "user"}))
+	r.SetPathValue("guildId", "1")
+
+	w := httptest.NewRecorder()
+	controller.leaveGuild(w, r)
+	return w
+}
+
+func TestLeaveGuildOwnerIsRejected(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	websocketServer := services.NewWebsocketServer(ctx, discardLogger{}, services.NewMemoryBroadcaster())
+	go websocketServer.Run()
+	controller := NewGuildController(discardLogger{}, &ownedGuildDatabase{}, websocketServer)
+
+	if w := serveLeaveGuild(controller, 1); w.Code != http.StatusConflict {
+		t.Errorf("expected the owner leaving to conflict, got %d", w.Code)
+	}
+	if w := serveLeaveGuild(controller, 2); w.Code != http.StatusOK {
+		t.Errorf("expected a member to be able to leave, got %d", w.Code)
+	}
+}
@@ -0,0 +1,156 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"tranquility/app"
+	"tranquility/data"
+	"tranquility/models"
+	"tranquility/services"
+)
+
+type Invite struct {
+	logger   services.Logger
+	database data.IDatabase
+}
+
+func NewInviteController(logger services.Logger, database data.IDatabase) *Invite {
+	return &Invite{logger, database}
+}
+
+func (i *Invite) RegisterRoutes(app *app.App) {
+	app.AddSecureRoute("GET", "/api/guild/{guildId}/invite", i.getGuildInvites)
+	app.AddSecureRoute("POST", "/api/guild/{guildId}/invite", i.createInvite)
+	app.AddSecureRoute("DELETE", "/api/guild/{guildId}/invite/{code}", i.revokeInvite)
+	app.AddSecureRoute("POST", "/api/invite/{code}", i.redeemInvite)
+}
+
+func (i *Invite) getGuildInvites(w http.ResponseWriter, r *http.Request) {
+	claims, err := getClaims(r)
+	if err != nil {
+		handleError(w, r, i.logger, err, nil, http.StatusUnauthorized, "error")
+		return
+	}
+
+	guildId, err := strconv.ParseInt(r.PathValue("guildId"), 10, 32)
+	if err != nil {
+		handleError(w, r, i.logger, err, claims, http.StatusBadRequest, "warning")
+		return
+	}
+
+	if err := requireGuildPermission(r.Context(), i.database, int32(guildId), claims.ID, models.PermissionManageGuild); err != nil {
+		handlePermissionError(w, r, i.logger, err, claims)
+		return
+	}
+
+	invites, err := i.database.GetGuildInvites(r.Context(), int32(guildId))
+	if err != nil {
+		handleError(w, r, i.logger, err, claims, http.StatusInternalServerError, "error")
+		return
+	}
+
+	if err = writeJsonBody(w, invites); err != nil {
+		handleError(w, r, i.logger, err, claims, http.StatusInternalServerError, "error")
+		return
+	}
+}
+
+func (i *Invite) createInvite(w http.ResponseWriter, r *http.Request) {
+	claims, err := getClaims(r)
+	if err != nil {
+		handleError(w, r, i.logger, err, nil, http.StatusUnauthorized, "error")
+		return
+	}
+
+	body, err := getJsonBody[models.Invite](r)
+	if err != nil {
+		handleError(w, r, i.logger, err, claims, http.StatusBadRequest, "warning")
+		return
+	}
+
+	guildId, err := strconv.ParseInt(r.PathValue("guildId"), 10, 32)
+	if err != nil || body.MaxAge < 0 || (body.MaxUses != nil && *body.MaxUses <= 0) {
+		handleError(w, r, i.logger, fmt.Errorf("an invalid invite was provided while creating an invite: %v", err), claims, http.StatusBadRequest, "warning")
+		return
+	}
+	body.GuildId = int32(guildId)
+	body.CreatedBy = claims.ID
+
+	if err := requireGuildPermission(r.Context(), i.database, body.GuildId, claims.ID, models.PermissionInviteMembers); err != nil {
+		handlePermissionError(w, r, i.logger, err, claims)
+		return
+	}
+
+	invite, err := i.database.CreateInvite(r.Context(), body)
+	if err != nil {
+		handleError(w, r, i.logger, err, claims, http.StatusInternalServerError, "error")
+		return
+	}
+
+	writeAuditLog(r, i.database, i.logger, claims, invite.GuildId, models.AuditInviteCreate, invite.ID, invite)
+	if err = writeJsonBodyStatus(w, http.StatusCreated, invite); err != nil {
+		handleError(w, r, i.logger, err, claims, http.StatusInternalServerError, "error")
+		return
+	}
+}
+
+func (i *Invite) revokeInvite(w http.ResponseWriter, r *http.Request) {
+	claims, err := getClaims(r)
+	if err != nil {
+		handleError(w, r, i.logger, err, nil, http.StatusUnauthorized, "error")
+		return
+	}
+
+	guildId, err := strconv.ParseInt(r.PathValue("guildId"), 10, 32)
+	if err != nil {
+		handleError(w, r, i.logger, err, claims, http.StatusBadRequest, "warning")
+		return
+	}
+
+	if err := requireGuildPermission(r.Context(), i.database, int32(guildId), claims.ID, models.PermissionManageGuild); err != nil {
+		handlePermissionError(w, r, i.logger, err, claims)
+		return
+	}
+
+	if err := i.database.RevokeInvite(r.Context(), int32(guildId), r.PathValue("code")); err != nil {
+		if errors.Is(err, data.ErrInviteNotFound) {
+			handleError(w, r, i.logger, err, claims, http.StatusNotFound, "warning")
+			return
+		}
+		handleError(w, r, i.logger, err, claims, http.StatusInternalServerError, "error")
+		return
+	}
+
+	writeAuditLog(r, i.database, i.logger, claims, int32(guildId), models.AuditInviteRevoke, 0, map[string]string{"code": r.PathValue("code")})
+}
+
+func (i *Invite) redeemInvite(w http.ResponseWriter, r *http.Request) {
+	claims, err := getClaims(r)
+	if err != nil {
+		handleError(w, r, i.logger, err, nil, http.StatusUnauthorized, "error")
+		return
+	}
+
+	guild, err := i.database.RedeemInvite(r.Context(), r.PathValue("code"), claims.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrInviteNotFound):
+			handleError(w, r, i.logger, err, claims, http.StatusNotFound, "warning", err.Error())
+		case errors.Is(err, data.ErrDuplicateMember):
+			handleError(w, r, i.logger, err, claims, http.StatusBadRequest, "warning", err.Error())
+		case errors.Is(err, data.ErrMemberBanned):
+			handleError(w, r, i.logger, err, claims, http.StatusForbidden, "warning", err.Error())
+		default:
+			handleError(w, r, i.logger, err, claims, http.StatusInternalServerError, "error")
+		}
+		return
+	}
+	writeAuditLog(r, i.database, i.logger, claims, guild.ID, models.AuditMemberAdd, claims.ID, map[string]string{"code": r.PathValue("code")})
+
+	if err = writeJsonBody(w, guild); err != nil {
+		handleError(w, r, i.logger, err, claims, http.StatusInternalServerError, "error")
+		return
+	}
+}
@@ -0,0 +1,67 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"tranquility/data"
+	"tranquility/middleware"
+	"tranquility/models"
+)
+
+// inviteDatabase only implements what redeeming an invite uses, anything else panics on the nil IDatabase.
+type inviteDatabase struct {
+	data.IDatabase
+	entries  []models.AuditLogEntry
+	auditErr error
+}
+
+func (i *inviteDatabase) RedeemInvite(ctx context.Context, code string, userId int32) (*models.Guild, error) {
+	return &models.Guild{ID: 1, Name: "guild"}, nil
+}
+
+func (i *inviteDatabase) CreateAuditLogEntry(ctx context.Context, entry *models.AuditLogEntry) error {
+	if i.auditErr != nil {
+		return i.auditErr
+	}
+	i.entries = append(i.entries, *entry)
+	return nil
+}
+
+func serveRedeemInvite(controller *Invite) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("POST", "/api/invite/code", nil)
+	r = r.WithContext(context.WithValue(r.Context(), middleware.ClaimsContextKey, &models.Claims{ID: 4, Username: "user"}))
+	r.SetPathValue("code", "code")
+
+	w := httptest.NewRecorder()
+	controller.redeemInvite(w, r)
+	return w
+}
+
+func TestRedeemInviteIsAudited(t *testing.T) {
+	database := &inviteDatabase{}
+	controller := NewInviteController(discardLogger{}, database)
+
+	if w := serveRedeemInvite(controller); w.Code != http.StatusOK {
+		t.Fatalf("expected the invite to be redeemed, got %d", w.Code)
+	}
+	if len(database.entries) != 1 {
+		t.Fatalf("expected a single audit log entry, got %d", len(database.entries))
+	}
+	entry := database.entries[0]
+	if entry.Action != models.AuditMemberAdd || entry.GuildId != 1 || entry.TargetId == nil || *entry.TargetId != 4 {
+		t.Errorf("unexpected audit log entry: %+v", entry)
+	}
+}
+
+func TestRedeemInviteSucceedsWhenAuditLogFails(t *testing.T) {
+	database := &inviteDatabase{auditErr: errors.New("audit log is unavailable")}
+	controller := NewInviteController(discardLogger{}, database)
+
+	// The member has already joined, failing the request would only make the client redeem the invite again.
+	if w := serveRedeemInvite(controller); w.Code != http.StatusOK {
+		t.Errorf("expected the invite to be redeemed, got %d", w.Code)
+	}
+}
@@ -2,26 +2,50 @@ package controllers
 
 import (
 	"database/sql"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 	"tranquility/app"
 	"tranquility/data"
+	"tranquility/models"
 	"tranquility/services"
 )
 
 type Message struct {
-	logger   services.Logger
-	database data.IDatabase
+	logger          services.Logger
+	database        data.IDatabase
+	websocketServer *services.WebsocketServer
 }
 
-func NewMessageController(logger services.Logger, database data.IDatabase) *Message {
-	return &Message{logger, database}
+func NewMessageController(logger services.Logger, database data.IDatabase, websocketServer *services.WebsocketServer) *Message {
+	return &Message{logger, database, websocketServer}
 }
 
 func (m *Message) RegisterRoutes(app *app.App) {
-	app.AddSecureRoute("GET", "/api/guild/{guildId}/channel/{channelId}/message/page/{pageNumber}", m.getChannelMessages)
+	app.AddSecureRoute("GET", "/api/guild/{guildId}/channel/{channelId}/message", m.getChannelMessages)
+	app.AddSecureRoute("GET", "/api/guild/{guildId}/channel/{channelId}/message/{messageId}/thread", m.getChannelMessages)
+	app.AddSecureRoute("GET", "/api/guild/{guildId}/channel/{channelId}/message/{messageId}/thread/participant", m.getThreadParticipants)
+	app.AddSecureRoute("GET", "/api/message/search", m.searchMessages)
+	app.AddSecureRoute("GET", "/api/mentions", m.getMentions)
+	app.AddSecureRoute("PATCH", "/api/guild/{guildId}/channel/{channelId}/message/{messageId}", m.updateMessage)
+	app.AddSecureRoute("DELETE", "/api/guild/{guildId}/channel/{channelId}/message/{messageId}", m.deleteMessage)
+	app.AddSecureRoute("PATCH", "/api/dm/{channelId}/message/{messageId}", m.updateMessage)
+	app.AddSecureRoute("DELETE", "/api/dm/{channelId}/message/{messageId}", m.deleteMessage)
+	app.AddSecureRoute("POST", "/api/guild/{guildId}/channel/{channelId}/message/{messageId}/reaction/{emoji}", m.addReaction)
+	app.AddSecureRoute("DELETE", "/api/guild/{guildId}/channel/{channelId}/message/{messageId}/reaction/{emoji}", m.removeReaction)
+	app.AddSecureRoute("POST", "/api/dm/{channelId}/message/{messageId}/reaction/{emoji}", m.addReaction)
+	app.AddSecureRoute("DELETE", "/api/dm/{channelId}/message/{messageId}/reaction/{emoji}", m.removeReaction)
+	app.AddSecureRoute("POST", "/api/guild/{guildId}/channel/{channelId}/message/{messageId}/ack", m.ackMessage)
+	app.AddSecureRoute("GET", "/api/guild/{guildId}/channel/{channelId}/pins", m.getChannelPins)
+	app.AddSecureRoute("GET", "/api/guild/{guildId}/channel/{channelId}/message/{messageId}/revisions", m.getMessageHistory)
+	app.AddSecureRoute("GET", "/api/dm/{channelId}/message/{messageId}/revisions", m.getMessageHistory)
+	app.AddSecureRoute("POST", "/api/guild/{guildId}/channel/{channelId}/pins/{messageId}", m.pinMessage)
+	app.AddSecureRoute("DELETE", "/api/guild/{guildId}/channel/{channelId}/pins/{messageId}", m.unpinMessage)
+	app.AddSecureRoute("POST", "/api/dm/{channelId}/message/{messageId}/ack", m.ackMessage)
 }
 
+// getChannelMessages is also used for threads, where the message id in the path is the message that started the thread.
 func (m *Message) getChannelMessages(w http.ResponseWriter, r *http.Request) {
 	claims, err := getClaims(r)
 	if err != nil {
@@ -31,18 +55,25 @@ func (m *Message) getChannelMessages(w http.ResponseWriter, r *http.Request) {
 
 	guildId, guildErr := strconv.ParseInt(r.PathValue("guildId"), 10, 32)
 	channelId, channelErr := strconv.ParseInt(r.PathValue("channelId"), 10, 32)
-	pageNumber, pageNumErr := strconv.ParseInt(r.PathValue("pageNumber"), 10, 32)
-	if guildErr != nil || channelErr != nil || pageNumErr != nil {
-		handleError(w, r, m.logger, err, nil, http.StatusBadRequest, "warning")
+	query, queryErr := getMessageQuery(r)
+	threadId, threadErr := getThreadId(r)
+	if guildErr != nil || channelErr != nil || queryErr != nil || threadErr != nil {
+		handleError(w, r, m.logger, errors.Join(guildErr, channelErr, queryErr, threadErr), claims, http.StatusBadRequest, "warning")
 		return
 	}
+	query.ThreadId = threadId
 
-	messages, err := m.database.GetChannelMessages(
+	if err := requireGuildPermission(r.Context(), m.database, int32(guildId), claims.ID, models.PermissionViewChannel); err != nil {
+		handlePermissionError(w, r, m.logger, err, claims)
+		return
+	}
+
+	page, err := m.database.GetChannelMessages(
 		r.Context(),
 		claims.ID,
 		int32(guildId),
 		int32(channelId),
-		int32(pageNumber),
+		query,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -53,8 +84,515 @@ func (m *Message) getChannelMessages(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err = writeJsonBody(w, messages); err != nil {
+	if err = writeJsonBody(w, page); err != nil {
 		handleError(w, r, m.logger, err, nil, http.StatusInternalServerError, "error")
 		return
 	}
 }
+
+func (m *Message) getThreadParticipants(w http.ResponseWriter, r *http.Request) {
+	claims, err := getClaims(r)
+	if err != nil {
+		handleError(w, r, m.logger, err, nil, http.StatusUnauthorized, "error")
+		return
+	}
+
+	guildId, guildErr := strconv.ParseInt(r.PathValue("guildId"), 10, 32)
+	channelId, channelErr := strconv.ParseInt(r.PathValue("channelId"), 10, 32)
+	threadId, threadErr := strconv.ParseInt(r.PathValue("messageId"), 10, 32)
+	if guildErr != nil || channelErr != nil || threadErr != nil {
+		handleError(w, r, m.logger, errors.Join(guildErr, channelErr, threadErr), claims, http.StatusBadRequest, "warning")
+		return
+	}
+
+	if _, err := m.database.GetGuildChannel(r.Context(), int32(guildId), int32(channelId), claims.ID); err != nil {
+		m.handleMessageError(w, r, err, claims)
+		return
+	}
+
+	participants, err := m.database.GetThreadParticipants(r.Context(), int32(channelId), int32(threadId), claims.ID)
+	if err != nil {
+		m.handleMessageError(w, r, err, claims)
+		return
+	}
+
+	if err = writeJsonBody(w, participants); err != nil {
+		handleError(w, r, m.logger, err, claims, http.StatusInternalServerError, "error")
+		return
+	}
+}
+
+func (m *Message) searchMessages(w http.ResponseWriter, r *http.Request) {
+	claims, err := getClaims(r)
+	if err != nil {
+		handleError(w, r, m.logger, err, nil, http.StatusUnauthorized, "error")
+		return
+	}
+
+	search, err := getMessageSearch(r)
+	if err != nil {
+		handleError(w, r, m.logger, err, claims, http.StatusBadRequest, "warning", err.Error())
+		return
+	}
+
+	results, err := m.database.SearchMessages(r.Context(), claims.ID, search)
+	if err != nil {
+		handleError(w, r, m.logger, err, claims, http.StatusInternalServerError, "error")
+		return
+	}
+
+	if err = writeJsonBody(w, results); err != nil {
+		handleError(w, r, m.logger, err, claims, http.StatusInternalServerError, "error")
+		return
+	}
+}
+
+// getMentions pages backwards through the messages that mentioned the user. Only before is supported.
+func (m *Message) getMentions(w http.ResponseWriter, r *http.Request) {
+	claims, err := getClaims(r)
+	if err != nil {
+		handleError(w, r, m.logger, err, nil, http.StatusUnauthorized, "error")
+		return
+	}
+
+	query, err := getMessageQuery(r)
+	if err == nil && (query.After != 0 || query.Around != 0) {
+		err = fmt.Errorf("mentions can only be paged with before")
+	}
+	if err != nil {
+		handleError(w, r, m.logger, err, claims, http.StatusBadRequest, "warning", err.Error())
+		return
+	}
+
+	page, err := m.database.GetMentionedMessages(r.Context(), claims.ID, query)
+	if err != nil {
+		handleError(w, r, m.logger, err, claims, http.StatusInternalServerError, "error")
+		return
+	}
+
+	if err = writeJsonBody(w, page); err != nil {
+		handleError(w, r, m.logger, err, claims, http.StatusInternalServerError, "error")
+		return
+	}
+}
+
+func (m *Message) updateMessage(w http.ResponseWriter, r *http.Request) {
+	claims, err := getClaims(r)
+	if err != nil {
+		handleError(w, r, m.logger, err, nil, http.StatusUnauthorized, "error")
+		return
+	}
+
+	body, err := getJsonBody[models.Message](r)
+	if err != nil {
+		handleError(w, r, m.logger, err, claims, http.StatusBadRequest, "warning")
+		return
+	}
+
+	var guildId int64
+	var guildErr error
+	if r.PathValue("guildId") != "" {
+		guildId, guildErr = strconv.ParseInt(r.PathValue("guildId"), 10, 32)
+	}
+	channelId, channelErr := strconv.ParseInt(r.PathValue("channelId"), 10, 32)
+	messageId, messageErr := strconv.ParseInt(r.PathValue("messageId"), 10, 32)
+	if guildErr != nil || channelErr != nil || messageErr != nil {
+		handleError(w, r, m.logger, errors.Join(guildErr, channelErr, messageErr), claims, http.StatusBadRequest, "warning")
+		return
+	}
+	if body.Content == "" {
+		handleError(w, r, m.logger, fmt.Errorf("%s attempted to update message %d without content", claims.Username, messageId), claims, http.StatusBadRequest, "warning")
+		return
+	}
+	body.ID = int32(messageId)
+	body.ChannelID = int32(channelId)
+
+	if guildId != 0 {
+		if _, err := m.database.GetGuildChannel(r.Context(), int32(guildId), int32(channelId), claims.ID); err != nil {
+			m.handleMessageError(w, r, err, claims)
+			return
+		}
+	}
+	// Users that have left a group direct message can no longer edit what they sent there.
+	if err := requireChannelPermission(r.Context(), m.database, int32(channelId), claims.ID, models.PermissionViewChannel); err != nil {
+		handlePermissionError(w, r, m.logger, err, claims)
+		return
+	}
+
+	message, err := m.database.UpdateMessage(r.Context(), body, claims.ID)
+	if err != nil {
+		m.handleMessageError(w, r, err, claims)
+		return
+	}
+
+	m.notifyChannel(r, claims, message.ChannelID, models.NewWebsocketMessage("message_update", message))
+
+	if err = writeJsonBody(w, message); err != nil {
+		handleError(w, r, m.logger, err, claims, http.StatusInternalServerError, "error")
+		return
+	}
+}
+
+func (m *Message) deleteMessage(w http.ResponseWriter, r *http.Request) {
+	claims, err := getClaims(r)
+	if err != nil {
+		handleError(w, r, m.logger, err, nil, http.StatusUnauthorized, "error")
+		return
+	}
+
+	var guildId int64
+	var guildErr error
+	if r.PathValue("guildId") != "" {
+		guildId, guildErr = strconv.ParseInt(r.PathValue("guildId"), 10, 32)
+	}
+	channelId, channelErr := strconv.ParseInt(r.PathValue("channelId"), 10, 32)
+	messageId, messageErr := strconv.ParseInt(r.PathValue("messageId"), 10, 32)
+	if guildErr != nil || channelErr != nil || messageErr != nil {
+		handleError(w, r, m.logger, errors.Join(guildErr, channelErr, messageErr), claims, http.StatusBadRequest, "warning")
+		return
+	}
+
+	// The channel is checked against the guild so a message can't be removed through another guild's path.
+	if guildId != 0 {
+		if _, err := m.database.GetGuildChannel(r.Context(), int32(guildId), int32(channelId), claims.ID); err != nil {
+			m.handleMessageError(w, r, err, claims)
+			return
+		}
+	}
+	if err := requireChannelPermission(r.Context(), m.database, int32(channelId), claims.ID, models.PermissionViewChannel); err != nil {
+		handlePermissionError(w, r, m.logger, err, claims)
+		return
+	}
+
+	message, err := m.database.DeleteMessage(r.Context(), int32(channelId), int32(messageId), claims.ID)
+	if err != nil {
+		m.handleMessageError(w, r, err, claims)
+		return
+	}
+
+	m.notifyChannel(r, claims, message.ChannelID, models.NewWebsocketMessage("message_delete", message))
+}
+
+func (m *Message) addReaction(w http.ResponseWriter, r *http.Request) {
+	claims, err := getClaims(r)
+	if err != nil {
+		handleError(w, r, m.logger, err, nil, http.StatusUnauthorized, "error")
+		return
+	}
+
+	event, ok := m.getReactionEvent(w, r, claims)
+	if !ok {
+		return
+	}
+
+	added, err := m.database.AddReaction(r.Context(), event.ChannelId, event.MessageId, claims.ID, event.Emoji)
+	if err != nil {
+		if errors.Is(err, data.ErrTooManyReactions) {
+			handleError(w, r, m.logger, err, claims, http.StatusBadRequest, "warning", err.Error())
+			return
+		}
+		m.handleMessageError(w, r, err, claims)
+		return
+	}
+
+	// Reacting twice with the same emoji is not an error, but there is nothing new to tell the channel.
+	if added {
+		m.notifyChannel(r, claims, event.ChannelId, models.NewWebsocketMessage("reaction_add", event))
+		w.WriteHeader(http.StatusCreated)
+	}
+}
+
+func (m *Message) removeReaction(w http.ResponseWriter, r *http.Request) {
+	claims, err := getClaims(r)
+	if err != nil {
+		handleError(w, r, m.logger, err, nil, http.StatusUnauthorized, "error")
+		return
+	}
+
+	event, ok := m.getReactionEvent(w, r, claims)
+	if !ok {
+		return
+	}
+
+	removed, err := m.database.RemoveReaction(r.Context(), event.ChannelId, event.MessageId, claims.ID, event.Emoji)
+	if err != nil {
+		m.handleMessageError(w, r, err, claims)
+		return
+	}
+
+	if removed {
+		m.notifyChannel(r, claims, event.ChannelId, models.NewWebsocketMessage("reaction_remove", event))
+	}
+}
+
+// getReactionEvent parses a reaction path for both guild channels and direct messages, which have no guild id,
+// and checks the user is allowed to react in the channel. The response has already been written when ok is false.
+func (m *Message) getReactionEvent(w http.ResponseWriter, r *http.Request, claims *models.Claims) (event *models.ReactionEvent, ok bool) {
+	var guildId int64
+	var guildErr error
+	if r.PathValue("guildId") != "" {
+		guildId, guildErr = strconv.ParseInt(r.PathValue("guildId"), 10, 32)
+	}
+	channelId, channelErr := strconv.ParseInt(r.PathValue("channelId"), 10, 32)
+	messageId, messageErr := strconv.ParseInt(r.PathValue("messageId"), 10, 32)
+	if guildErr != nil || channelErr != nil || messageErr != nil {
+		handleError(w, r, m.logger, errors.Join(guildErr, channelErr, messageErr), claims, http.StatusBadRequest, "warning")
+		return nil, false
+	}
+
+	emoji := r.PathValue("emoji")
+	if !models.IsValidEmoji(emoji) {
+		handleError(w, r, m.logger, fmt.Errorf("%s attempted to react with an invalid emoji %q", claims.Username, emoji), claims, http.StatusBadRequest, "warning", "an invalid emoji was provided")
+		return nil, false
+	}
+
+	if guildId != 0 {
+		if _, err := m.database.GetGuildChannel(r.Context(), int32(guildId), int32(channelId), claims.ID); err != nil {
+			m.handleMessageError(w, r, err, claims)
+			return nil, false
+		}
+	}
+
+	if err := requireChannelPermission(r.Context(), m.database, int32(channelId), claims.ID, models.PermissionViewChannel|models.PermissionAddReactions); err != nil {
+		handlePermissionError(w, r, m.logger, err, claims)
+		return nil, false
+	}
+
+	return &models.ReactionEvent{
+		MessageId: int32(messageId),
+		ChannelId: int32(channelId),
+		GuildId:   int32(guildId),
+		UserId:    claims.ID,
+		Emoji:     emoji,
+	}, true
+}
+
+// ackMessage marks the channel as read up to the message for both guild channels and direct messages.
+// The user's other devices are sent the new read state so they stay in sync.
+func (m *Message) ackMessage(w http.ResponseWriter, r *http.Request) {
+	claims, err := getClaims(r)
+	if err != nil {
+		handleError(w, r, m.logger, err, nil, http.StatusUnauthorized, "error")
+		return
+	}
+
+	var guildId int64
+	var guildErr error
+	if r.PathValue("guildId") != "" {
+		guildId, guildErr = strconv.ParseInt(r.PathValue("guildId"), 10, 32)
+	}
+	channelId, channelErr := strconv.ParseInt(r.PathValue("channelId"), 10, 32)
+	messageId, messageErr := strconv.ParseInt(r.PathValue("messageId"), 10, 32)
+	if guildErr != nil || channelErr != nil || messageErr != nil {
+		handleError(w, r, m.logger, errors.Join(guildErr, channelErr, messageErr), claims, http.StatusBadRequest, "warning")
+		return
+	}
+
+	if guildId != 0 {
+		if _, err := m.database.GetGuildChannel(r.Context(), int32(guildId), int32(channelId), claims.ID); err != nil {
+			m.handleMessageError(w, r, err, claims)
+			return
+		}
+	}
+
+	if err := requireChannelPermission(r.Context(), m.database, int32(channelId), claims.ID, models.PermissionViewChannel); err != nil {
+		handlePermissionError(w, r, m.logger, err, claims)
+		return
+	}
+
+	state, err := m.database.AckMessage(r.Context(), claims.ID, int32(channelId), int32(messageId))
+	if err != nil {
+		m.handleMessageError(w, r, err, claims)
+		return
+	}
+
+	notify(m.logger, m.websocketServer, claims.ID, models.NewWebsocketMessage("read_state_update", state), map[int32]bool{claims.ID: true})
+
+	if err = writeJsonBody(w, state); err != nil {
+		handleError(w, r, m.logger, err, claims, http.StatusInternalServerError, "error")
+		return
+	}
+}
+
+func (m *Message) getChannelPins(w http.ResponseWriter, r *http.Request) {
+	claims, err := getClaims(r)
+	if err != nil {
+		handleError(w, r, m.logger, err, nil, http.StatusUnauthorized, "error")
+		return
+	}
+
+	guildId, guildErr := strconv.ParseInt(r.PathValue("guildId"), 10, 32)
+	channelId, channelErr := strconv.ParseInt(r.PathValue("channelId"), 10, 32)
+	if guildErr != nil || channelErr != nil {
+		handleError(w, r, m.logger, errors.Join(guildErr, channelErr), claims, http.StatusBadRequest, "warning")
+		return
+	}
+
+	if _, err := m.database.GetGuildChannel(r.Context(), int32(guildId), int32(channelId), claims.ID); err != nil {
+		m.handleMessageError(w, r, err, claims)
+		return
+	}
+	if err := requireChannelPermission(r.Context(), m.database, int32(channelId), claims.ID, models.PermissionViewChannel); err != nil {
+		handlePermissionError(w, r, m.logger, err, claims)
+		return
+	}
+
+	pins, err := m.database.GetChannelPins(r.Context(), int32(channelId))
+	if err != nil {
+		handleError(w, r, m.logger, err, claims, http.StatusInternalServerError, "error")
+		return
+	}
+
+	if err = writeJsonBody(w, pins); err != nil {
+		handleError(w, r, m.logger, err, claims, http.StatusInternalServerError, "error")
+		return
+	}
+}
+
+func (m *Message) pinMessage(w http.ResponseWriter, r *http.Request) {
+	claims, err := getClaims(r)
+	if err != nil {
+		handleError(w, r, m.logger, err, nil, http.StatusUnauthorized, "error")
+		return
+	}
+
+	channelId, messageId, ok := m.getPinTarget(w, r, claims)
+	if !ok {
+		return
+	}
+
+	pin, created, err := m.database.PinMessage(r.Context(), channelId, messageId, claims.ID)
+	if err != nil {
+		if errors.Is(err, data.ErrTooManyPins) {
+			handleError(w, r, m.logger, err, claims, http.StatusBadRequest, "warning", err.Error())
+			return
+		}
+		m.handleMessageError(w, r, err, claims)
+		return
+	}
+
+	// Pinning a message twice is not an error, but there is nothing new to tell the channel.
+	status := http.StatusOK
+	if created {
+		m.notifyChannel(r, claims, pin.ChannelId, models.NewWebsocketMessage("pin_add", pin))
+		status = http.StatusCreated
+	}
+	if err = writeJsonBodyStatus(w, status, pin); err != nil {
+		handleError(w, r, m.logger, err, claims, http.StatusInternalServerError, "error")
+		return
+	}
+}
+
+func (m *Message) unpinMessage(w http.ResponseWriter, r *http.Request) {
+	claims, err := getClaims(r)
+	if err != nil {
+		handleError(w, r, m.logger, err, nil, http.StatusUnauthorized, "error")
+		return
+	}
+
+	channelId, messageId, ok := m.getPinTarget(w, r, claims)
+	if !ok {
+		return
+	}
+
+	pin, err := m.database.UnpinMessage(r.Context(), channelId, messageId)
+	if err != nil {
+		if errors.Is(err, data.ErrPinNotFound) {
+			handleError(w, r, m.logger, err, claims, http.StatusNotFound, "warning")
+			return
+		}
+		m.handleMessageError(w, r, err, claims)
+		return
+	}
+
+	m.notifyChannel(r, claims, pin.ChannelId, models.NewWebsocketMessage("pin_remove", pin))
+	if err = writeJsonBody(w, pin); err != nil {
+		handleError(w, r, m.logger, err, claims, http.StatusInternalServerError, "error")
+		return
+	}
+}
+
+// getPinTarget parses the pin path and checks the user is able to manage messages in the channel.
+// The response has already been written when ok is false.
+func (m *Message) getPinTarget(w http.ResponseWriter, r *http.Request, claims *models.Claims) (channelId, messageId int32, ok bool) {
+	guildId, guildErr := strconv.ParseInt(r.PathValue("guildId"), 10, 32)
+	channel, channelErr := strconv.ParseInt(r.PathValue("channelId"), 10, 32)
+	message, messageErr := strconv.ParseInt(r.PathValue("messageId"), 10, 32)
+	if guildErr != nil || channelErr != nil || messageErr != nil {
+		handleError(w, r, m.logger, errors.Join(guildErr, channelErr, messageErr), claims, http.StatusBadRequest, "warning")
+		return 0, 0, false
+	}
+
+	if _, err := m.database.GetGuildChannel(r.Context(), int32(guildId), int32(channel), claims.ID); err != nil {
+		m.handleMessageError(w, r, err, claims)
+		return 0, 0, false
+	}
+	if err := requireChannelPermission(r.Context(), m.database, int32(channel), claims.ID, models.PermissionViewChannel|models.PermissionManageMessages); err != nil {
+		handlePermissionError(w, r, m.logger, err, claims)
+		return 0, 0, false
+	}
+
+	return int32(channel), int32(message), true
+}
+
+// getMessageHistory returns the revisions of a message for both guild channels and direct messages.
+// Deleted messages are included so moderators are able to review them.
+func (m *Message) getMessageHistory(w http.ResponseWriter, r *http.Request) {
+	claims, err := getClaims(r)
+	if err != nil {
+		handleError(w, r, m.logger, err, nil, http.StatusUnauthorized, "error")
+		return
+	}
+
+	var guildId int64
+	var guildErr error
+	if r.PathValue("guildId") != "" {
+		guildId, guildErr = strconv.ParseInt(r.PathValue("guildId"), 10, 32)
+	}
+	channelId, channelErr := strconv.ParseInt(r.PathValue("channelId"), 10, 32)
+	messageId, messageErr := strconv.ParseInt(r.PathValue("messageId"), 10, 32)
+	if guildErr != nil || channelErr != nil || messageErr != nil {
+		handleError(w, r, m.logger, errors.Join(guildErr, channelErr, messageErr), claims, http.StatusBadRequest, "warning")
+		return
+	}
+
+	if guildId != 0 {
+		if _, err := m.database.GetGuildChannel(r.Context(), int32(guildId), int32(channelId), claims.ID); err != nil {
+			m.handleMessageError(w, r, err, claims)
+			return
+		}
+	}
+
+	history, err := m.database.GetMessageHistory(r.Context(), int32(channelId), int32(messageId), claims.ID)
+	if err != nil {
+		m.handleMessageError(w, r, err, claims)
+		return
+	}
+
+	if err = writeJsonBody(w, history); err != nil {
+		handleError(w, r, m.logger, err, claims, http.StatusInternalServerError, "error")
+		return
+	}
+}
+
+// notifyChannel sends the event to every member of the channel connected to the websocket server.
+func (m *Message) notifyChannel(r *http.Request, claims *models.Claims, channelId int32, event *models.WebsocketMessage) {
+	receivers, err := m.database.GetChannelMembers(r.Context(), channelId)
+	if err != nil {
+		m.logger.ERROR(fmt.Sprintf("an error occurred while collecting channel members to send %s: %v", event.Type, err))
+		return
+	}
+	receivers[claims.ID] = true
+	notify(m.logger, m.websocketServer, claims.ID, event, receivers)
+}
+
+func (m *Message) handleMessageError(w http.ResponseWriter, r *http.Request, err error, claims *models.Claims) {
+	switch {
+	case errors.Is(err, data.ErrMessageNotFound) || errors.Is(err, sql.ErrNoRows):
+		handleError(w, r, m.logger, err, claims, http.StatusNotFound, "warning")
+	case errors.Is(err, data.ErrUserLacksPermission):
+		handlePermissionError(w, r, m.logger, err, claims)
+	default:
+		handleError(w, r, m.logger, err, claims, http.StatusInternalServerError, "error")
+	}
+}
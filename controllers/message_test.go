@@ -0,0 +1,132 @@
+package controllers
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"tranquility/data"
+	"tranquility/middleware"
+	"tranquility/models"
+	"tranquility/services"
+)
+
+type discardLogger struct{}
+
+func (discardLogger) INFO(string)    {}
+func (discardLogger) WARNING(string) {}
+func (discardLogger) ERROR(string)   {}
+func (discardLogger) TRACE(string)   {}
+
+// pinDatabase only implements what the pin handlers use, anything else panics on the nil IDatabase.
+type pinDatabase struct {
+	data.IDatabase
+	permissions models.Permission
+	pinned      map[int32]bool
+}
+
+func (p *pinDatabase) GetGuildChannel(ctx context.Context, guildId, channelId, userId int32) (*models.Channel, error) {
+	return &models.Channel{ID: channelId, GuildId: guildId}, nil
+}
+
+func (p *pinDatabase) GetChannelPermissions(ctx context.Context, channelId, userId int32) (models.Permission, error) {
+	return p.permissions, nil
+}
+
+func (p *pinDatabase) GetChannelMembers(ctx context.Context, channelId int32) (map[int32]bool, error) {
+	return map[int32]bool{}, nil
+}
+
+func (p *pinDatabase) PinMessage(ctx context.Context, channelId, messageId, userId int32) (*models.Pin, bool, error) {
+	created := !p.pinned[messageId]
+	p.pinned[messageId] = true
+	return &models.Pin{ChannelId: channelId, MessageId: messageId, PinnedBy: userId}, created, nil
+}
+
+func (p *pinDatabase) UnpinMessage(ctx context.Context, channelId, messageId int32) (*models.Pin, error) {
+	if !p.pinned[messageId] {
+		return nil, data.ErrPinNotFound
+	}
+	delete(p.pinned, messageId)
+	return &models.Pin{ChannelId: channelId, MessageId: messageId}, nil
+}
+
+func newPinController(t *testing.T, permissions models.Permission) (*Message, *pinDatabase) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	websocketServer := services.NewWebsocketServer(ctx, discardLogger{}, services.NewMemoryBroadcaster())
+	go websocketServer.Run()
+
+	database := &pinDatabase{permissions: permissions, pinned: make(map[int32]bool)}
+	return NewMessageController(discardLogger{}, database, websocketServer), database
+}
+
+func servePin(handler http.HandlerFunc, method string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, "/api/guild/1/channel/2/pins/3", nil)
+	r = r.WithContext(context.WithValue(r.Context(), middleware.ClaimsContextKey, &models.Claims{ID: 4, Username: "user"}))
+	r.SetPathValue("guildId", "1")
+	r.SetPathValue("channelId", "2")
+	r.SetPathValue("messageId", "3")
+
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
+
+func TestPinMessageRequiresManageMessages(t *testing.T) {
+	controller, database := newPinController(t, models.PermissionDefault)
+
+	if w := servePin(controller.pinMessage, "POST"); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected pinning without manage messages to be unauthorized, got %d", w.Code)
+	}
+	database.pinned[3] = true
+	if w := servePin(controller.unpinMessage, "DELETE"); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected unpinning without manage messages to be unauthorized, got %d", w.Code)
+	}
+	if !database.pinned[3] {
+		t.Error("the message was unpinned without permission")
+	}
+}
+
+func TestPinMessage(t *testing.T) {
+	controller, _ := newPinController(t, models.PermissionDefault|models.PermissionManageMessages)
+
+	w := servePin(controller.pinMessage, "POST")
+	if w.Code != http.StatusCreated {
+		t.Errorf("expected the first pin to be created, got %d", w.Code)
+	}
+	if encoding := w.Result().Header.Get("Content-Encoding"); encoding != "gzip" {
+		t.Errorf("expected the created pin to be gzipped, got %q", encoding)
+	}
+	if w := servePin(controller.pinMessage, "POST"); w.Code != http.StatusOK {
+		t.Errorf("expected pinning the message again to return the existing pin, got %d", w.Code)
+	}
+}
+
+func TestUnpinMessageReturnsRemovedPin(t *testing.T) {
+	controller, database := newPinController(t, models.PermissionDefault|models.PermissionManageMessages)
+	database.pinned[3] = true
+
+	w := servePin(controller.unpinMessage, "DELETE")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected the pin to be removed, got %d", w.Code)
+	}
+	body, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatalf("unable to read the response: %v", err)
+	}
+	var pin models.Pin
+	if err := json.NewDecoder(body).Decode(&pin); err != nil {
+		t.Fatalf("unable to read the removed pin: %v", err)
+	}
+	if pin.ChannelId != 2 || pin.MessageId != 3 {
+		t.Errorf("unexpected pin was returned: %+v", pin)
+	}
+
+	if w := servePin(controller.unpinMessage, "DELETE"); w.Code != http.StatusNotFound {
+		t.Errorf("expected unpinning a message that isn't pinned to be not found, got %d", w.Code)
+	}
+}
@@ -0,0 +1,112 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"tranquility/app"
+	"tranquility/data"
+	"tranquility/models"
+	"tranquility/services"
+	"unicode/utf8"
+)
+
+type Presence struct {
+	logger          services.Logger
+	database        data.IDatabase
+	websocketServer *services.WebsocketServer
+}
+
+func NewPresenceController(logger services.Logger, database data.IDatabase, websocketServer *services.WebsocketServer) *Presence {
+	return &Presence{logger, database, websocketServer}
+}
+
+func (p *Presence) RegisterRoutes(app *app.App) {
+	app.AddSecureRoute("GET", "/api/presence", p.getPresence)
+	app.AddSecureRoute("PATCH", "/api/presence", p.updatePresence)
+}
+
+func (p *Presence) getPresence(w http.ResponseWriter, r *http.Request) {
+	claims, err := getClaims(r)
+	if err != nil {
+		handleError(w, r, p.logger, err, nil, http.StatusUnauthorized, "error")
+		return
+	}
+
+	presence, err := p.database.GetOwnPresence(r.Context(), claims.ID)
+	if err != nil {
+		handleError(w, r, p.logger, err, claims, http.StatusInternalServerError, "error")
+		return
+	}
+
+	if err = writeJsonBody(w, presence); err != nil {
+		handleError(w, r, p.logger, err, claims, http.StatusInternalServerError, "error")
+		return
+	}
+}
+
+func (p *Presence) updatePresence(w http.ResponseWriter, r *http.Request) {
+	claims, err := getClaims(r)
+	if err != nil {
+		handleError(w, r, p.logger, err, nil, http.StatusUnauthorized, "error")
+		return
+	}
+
+	body, err := getJsonBody[models.Presence](r)
+	if err != nil || !models.IsValidPresenceStatus(body.Status) || body.CustomStatusDuration < 0 ||
+		utf8.RuneCountInString(body.CustomStatus) > models.MaxCustomStatusLength {
+		handleError(w, r, p.logger, fmt.Errorf("an invalid presence was provided: %v", err), claims, http.StatusBadRequest, "warning")
+		return
+	}
+	body.UserId = claims.ID
+
+	if err := p.database.UpdatePresence(r.Context(), body); err != nil {
+		handleError(w, r, p.logger, err, claims, http.StatusInternalServerError, "error")
+		return
+	}
+
+	broadcastPresence(r.Context(), p.logger, p.database, p.websocketServer, claims.ID)
+
+	presence, err := p.database.GetOwnPresence(r.Context(), claims.ID)
+	if err != nil {
+		handleError(w, r, p.logger, err, claims, http.StatusInternalServerError, "error")
+		return
+	}
+
+	if err = writeJsonBody(w, presence); err != nil {
+		handleError(w, r, p.logger, err, claims, http.StatusInternalServerError, "error")
+		return
+	}
+}
+
+// broadcastPresence sends the user's presence, as other users see it, to everyone that shares a guild with them.
+func broadcastPresence(ctx context.Context, logger services.Logger, database data.IDatabase, websocketServer *services.WebsocketServer, userId int32) {
+	presence, err := database.GetPresence(ctx, userId)
+	if err != nil {
+		logger.ERROR(fmt.Sprintf("an error occurred while collecting presence of %d: %v", userId, err))
+		return
+	}
+	receivers, err := database.GetPresenceAudience(ctx, userId)
+	if err != nil {
+		logger.ERROR(fmt.Sprintf("an error occurred while collecting users to send presence of %d: %v", userId, err))
+		return
+	}
+	guildIds, err := database.GetJoinedGuildIds(ctx, userId)
+	if err != nil {
+		logger.ERROR(fmt.Sprintf("an error occurred while collecting guilds to send presence of %d: %v", userId, err))
+		return
+	}
+
+	// Everyone else only receives the update while viewing one of the user's guilds,
+	// but the user's own sessions always do.
+	topic := &models.WebsocketTopic{GuildIds: guildIds}
+	delete(receivers, userId)
+
+	notify(logger, websocketServer, userId, models.NewWebsocketMessage("presence_update", presence), map[int32]bool{userId: true})
+	if len(receivers) == 0 {
+		return
+	}
+	event := models.NewWebsocketMessage("presence_update", presence)
+	event.Topic = topic
+	notify(logger, websocketServer, userId, event, receivers)
+}
@@ -0,0 +1,291 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"tranquility/app"
+	"tranquility/data"
+	"tranquility/models"
+	"tranquility/services"
+)
+
+type Role struct {
+	logger   services.Logger
+	database data.IDatabase
+}
+
+func NewRoleController(logger services.Logger, database data.IDatabase) *Role {
+	return &Role{logger, database}
+}
+
+func (ro *Role) RegisterRoutes(app *app.App) {
+	app.AddSecureRoute("GET", "/api/guild/{guildId}/role", ro.getGuildRoles)
+	app.AddSecureRoute("GET", "/api/guild/{guildId}/member/{userId}/role", ro.getMemberRoles)
+	app.AddSecureRoute("POST", "/api/guild/{guildId}/role", ro.createRole)
+	app.AddSecureRoute("PATCH", "/api/guild/{guildId}/role/{roleId}", ro.updateRole)
+	app.AddSecureRoute("DELETE", "/api/guild/{guildId}/role/{roleId}", ro.deleteRole)
+	app.AddSecureRoute("POST", "/api/guild/{guildId}/role/{roleId}/member/{userId}", ro.addMemberRole)
+	app.AddSecureRoute("DELETE", "/api/guild/{guildId}/role/{roleId}/member/{userId}", ro.removeMemberRole)
+}
+
+func (ro *Role) getGuildRoles(w http.ResponseWriter, r *http.Request) {
+	claims, err := getClaims(r)
+	if err != nil {
+		handleError(w, r, ro.logger, err, nil, http.StatusUnauthorized, "error")
+		return
+	}
+
+	guildId, err := strconv.ParseInt(r.PathValue("guildId"), 10, 32)
+	if err != nil {
+		handleError(w, r, ro.logger, err, claims, http.StatusBadRequest, "warning")
+		return
+	}
+
+	roles, err := ro.database.GetGuildRoles(r.Context(), int32(guildId), claims.ID)
+	if err != nil {
+		handleError(w, r, ro.logger, err, claims, http.StatusInternalServerError, "error")
+		return
+	}
+
+	if err = writeJsonBody(w, roles); err != nil {
+		handleError(w, r, ro.logger, err, claims, http.StatusInternalServerError, "error")
+		return
+	}
+}
+
+func (ro *Role) getMemberRoles(w http.ResponseWriter, r *http.Request) {
+	claims, err := getClaims(r)
+	if err != nil {
+		handleError(w, r, ro.logger, err, nil, http.StatusUnauthorized, "error")
+		return
+	}
+
+	guildId, guildErr := strconv.ParseInt(r.PathValue("guildId"), 10, 32)
+	userId, userErr := strconv.ParseInt(r.PathValue("userId"), 10, 32)
+	if guildErr != nil || userErr != nil {
+		handleError(w, r, ro.logger, errors.Join(guildErr, userErr), claims, http.StatusBadRequest, "warning")
+		return
+	}
+
+	if err := requireGuildPermission(r.Context(), ro.database, int32(guildId), claims.ID, models.PermissionViewChannel); err != nil {
+		handlePermissionError(w, r, ro.logger, err, claims)
+		return
+	}
+
+	roles, err := ro.database.GetMemberRoles(r.Context(), int32(guildId), int32(userId))
+	if err != nil {
+		handleError(w, r, ro.logger, err, claims, http.StatusInternalServerError, "error")
+		return
+	}
+
+	if err = writeJsonBody(w, roles); err != nil {
+		handleError(w, r, ro.logger, err, claims, http.StatusInternalServerError, "error")
+		return
+	}
+}
+
+func (ro *Role) createRole(w http.ResponseWriter, r *http.Request) {
+	claims, err := getClaims(r)
+	if err != nil {
+		handleError(w, r, ro.logger, err, nil, http.StatusUnauthorized, "error")
+		return
+	}
+
+	body, err := getJsonBody[models.Role](r)
+	if err != nil {
+		handleError(w, r, ro.logger, err, claims, http.StatusBadRequest, "warning")
+		return
+	}
+
+	guildId, err := strconv.ParseInt(r.PathValue("guildId"), 10, 32)
+	if err != nil || body.GuildId != int32(guildId) || body.Name == "" {
+		handleError(w, r, ro.logger, fmt.Errorf("an invalid role was provided while creating a role: %v", err), claims, http.StatusBadRequest, "warning")
+		return
+	}
+
+	if err := ro.requireGrantable(r, body.GuildId, claims.ID, body.Permissions); err != nil {
+		handlePermissionError(w, r, ro.logger, err, claims)
+		return
+	}
+
+	role, err := ro.database.CreateRole(r.Context(), body)
+	if err != nil {
+		handleError(w, r, ro.logger, err, claims, http.StatusInternalServerError, "error")
+		return
+	}
+
+	writeAuditLog(r, ro.database, ro.logger, claims, role.GuildId, models.AuditRoleCreate, role.ID, role)
+	if err = writeJsonBodyStatus(w, http.StatusCreated, role); err != nil {
+		handleError(w, r, ro.logger, err, claims, http.StatusInternalServerError, "error")
+		return
+	}
+}
+
+func (ro *Role) updateRole(w http.ResponseWriter, r *http.Request) {
+	claims, err := getClaims(r)
+	if err != nil {
+		handleError(w, r, ro.logger, err, nil, http.StatusUnauthorized, "error")
+		return
+	}
+
+	body, err := getJsonBody[models.RoleUpdate](r)
+	if err != nil {
+		handleError(w, r, ro.logger, err, claims, http.StatusBadRequest, "warning")
+		return
+	}
+
+	guildId, guildErr := strconv.ParseInt(r.PathValue("guildId"), 10, 32)
+	roleId, roleErr := strconv.ParseInt(r.PathValue("roleId"), 10, 32)
+	if guildErr != nil || roleErr != nil {
+		handleError(w, r, ro.logger, errors.Join(guildErr, roleErr), claims, http.StatusBadRequest, "warning")
+		return
+	}
+	body.ID = int32(roleId)
+	body.GuildId = int32(guildId)
+
+	// The user has to be able to grant both the role's current permissions and the ones it's being changed to.
+	if err := ro.requireRoleGrantable(r, body.GuildId, body.ID, claims.ID); err != nil {
+		handlePermissionError(w, r, ro.logger, err, claims)
+		return
+	}
+	if body.Permissions != nil {
+		if err := ro.requireGrantable(r, body.GuildId, claims.ID, *body.Permissions); err != nil {
+			handlePermissionError(w, r, ro.logger, err, claims)
+			return
+		}
+	}
+
+	role, err := ro.database.UpdateRole(r.Context(), body)
+	if err != nil {
+		if errors.Is(err, data.ErrRoleNotFound) {
+			handleError(w, r, ro.logger, err, claims, http.StatusNotFound, "warning")
+			return
+		}
+		handleError(w, r, ro.logger, err, claims, http.StatusInternalServerError, "error")
+		return
+	}
+
+	writeAuditLog(r, ro.database, ro.logger, claims, role.GuildId, models.AuditRoleUpdate, role.ID, role)
+	if err = writeJsonBody(w, role); err != nil {
+		handleError(w, r, ro.logger, err, claims, http.StatusInternalServerError, "error")
+		return
+	}
+}
+
+func (ro *Role) deleteRole(w http.ResponseWriter, r *http.Request) {
+	claims, err := getClaims(r)
+	if err != nil {
+		handleError(w, r, ro.logger, err, nil, http.StatusUnauthorized, "error")
+		return
+	}
+
+	guildId, guildErr := strconv.ParseInt(r.PathValue("guildId"), 10, 32)
+	roleId, roleErr := strconv.ParseInt(r.PathValue("roleId"), 10, 32)
+	if guildErr != nil || roleErr != nil {
+		handleError(w, r, ro.logger, errors.Join(guildErr, roleErr), claims, http.StatusBadRequest, "warning")
+		return
+	}
+
+	if err := ro.requireRoleGrantable(r, int32(guildId), int32(roleId), claims.ID); err != nil {
+		handlePermissionError(w, r, ro.logger, err, claims)
+		return
+	}
+
+	if err := ro.database.DeleteRole(r.Context(), int32(guildId), int32(roleId)); err != nil {
+		if errors.Is(err, data.ErrRoleNotFound) {
+			handleError(w, r, ro.logger, err, claims, http.StatusNotFound, "warning")
+			return
+		}
+		handleError(w, r, ro.logger, err, claims, http.StatusInternalServerError, "error")
+		return
+	}
+
+	writeAuditLog(r, ro.database, ro.logger, claims, int32(guildId), models.AuditRoleDelete, int32(roleId), nil)
+}
+
+func (ro *Role) addMemberRole(w http.ResponseWriter, r *http.Request) {
+	claims, err := getClaims(r)
+	if err != nil {
+		handleError(w, r, ro.logger, err, nil, http.StatusUnauthorized, "error")
+		return
+	}
+
+	guildId, guildErr := strconv.ParseInt(r.PathValue("guildId"), 10, 32)
+	roleId, roleErr := strconv.ParseInt(r.PathValue("roleId"), 10, 32)
+	userId, userErr := strconv.ParseInt(r.PathValue("userId"), 10, 32)
+	if guildErr != nil || roleErr != nil || userErr != nil {
+		handleError(w, r, ro.logger, errors.Join(guildErr, roleErr, userErr), claims, http.StatusBadRequest, "warning")
+		return
+	}
+
+	if err := ro.requireRoleGrantable(r, int32(guildId), int32(roleId), claims.ID); err != nil {
+		handlePermissionError(w, r, ro.logger, err, claims)
+		return
+	}
+
+	if err := ro.database.AddMemberRole(r.Context(), int32(guildId), int32(roleId), int32(userId)); err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateMemberRole):
+			handleError(w, r, ro.logger, err, claims, http.StatusBadRequest, "warning", err.Error())
+		case errors.Is(err, data.ErrMemberNotFound):
+			handleError(w, r, ro.logger, err, claims, http.StatusNotFound, "warning", err.Error())
+		default:
+			handleError(w, r, ro.logger, err, claims, http.StatusInternalServerError, "error")
+		}
+		return
+	}
+
+	writeAuditLog(r, ro.database, ro.logger, claims, int32(guildId), models.AuditMemberRoleAdd, int32(userId), map[string]int32{"role_id": int32(roleId)})
+}
+
+func (ro *Role) removeMemberRole(w http.ResponseWriter, r *http.Request) {
+	claims, err := getClaims(r)
+	if err != nil {
+		handleError(w, r, ro.logger, err, nil, http.StatusUnauthorized, "error")
+		return
+	}
+
+	guildId, guildErr := strconv.ParseInt(r.PathValue("guildId"), 10, 32)
+	roleId, roleErr := strconv.ParseInt(r.PathValue("roleId"), 10, 32)
+	userId, userErr := strconv.ParseInt(r.PathValue("userId"), 10, 32)
+	if guildErr != nil || roleErr != nil || userErr != nil {
+		handleError(w, r, ro.logger, errors.Join(guildErr, roleErr, userErr), claims, http.StatusBadRequest, "warning")
+		return
+	}
+
+	if err := ro.requireRoleGrantable(r, int32(guildId), int32(roleId), claims.ID); err != nil {
+		handlePermissionError(w, r, ro.logger, err, claims)
+		return
+	}
+
+	if err := ro.database.RemoveMemberRole(r.Context(), int32(guildId), int32(roleId), int32(userId)); err != nil {
+		if errors.Is(err, data.ErrRoleNotFound) {
+			handleError(w, r, ro.logger, err, claims, http.StatusNotFound, "warning")
+			return
+		}
+		handleError(w, r, ro.logger, err, claims, http.StatusInternalServerError, "error")
+		return
+	}
+
+	writeAuditLog(r, ro.database, ro.logger, claims, int32(guildId), models.AuditMemberRoleRemove, int32(userId), map[string]int32{"role_id": int32(roleId)})
+}
+
+// requireGrantable makes sure the user can manage roles and is not handing out permissions they do not have themselves.
+func (ro *Role) requireGrantable(r *http.Request, guildId, userId int32, permissions models.Permission) error {
+	return requireGuildPermission(r.Context(), ro.database, guildId, userId, models.PermissionManageRoles|permissions)
+}
+
+func (ro *Role) requireRoleGrantable(r *http.Request, guildId, roleId, userId int32) error {
+	roles, err := ro.database.GetGuildRoles(r.Context(), guildId, userId)
+	if err != nil {
+		return err
+	}
+	for _, role := range roles {
+		if role.ID == roleId {
+			return ro.requireGrantable(r, guildId, userId, role.Permissions)
+		}
+	}
+	return data.ErrRoleNotFound
+}
@@ -2,11 +2,17 @@ package controllers
 
 import (
 	"compress/gzip"
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"reflect"
+	"strconv"
 	"strings"
+	"time"
+	"tranquility/data"
 	"tranquility/middleware"
 	"tranquility/models"
 	"tranquility/services"
@@ -47,6 +53,11 @@ func getJsonBody[T any](r *http.Request) (*T, error) {
 }
 
 func writeJsonBody[T any](w http.ResponseWriter, body T) error {
+	return writeJsonBodyStatus(w, http.StatusOK, body)
+}
+
+// writeJsonBodyStatus writes the body with the given status code, the headers have to be set before the status is written or they are dropped.
+func writeJsonBodyStatus[T any](w http.ResponseWriter, status int, body T) error {
 	v := reflect.ValueOf(body)
 
 	if v.Kind() == reflect.Pointer {
@@ -72,6 +83,7 @@ func writeJsonBody[T any](w http.ResponseWriter, body T) error {
 
 	w.Header().Set("content-type", "application/json")
 	w.Header().Set("Content-Encoding", "gzip")
+	w.WriteHeader(status)
 
 	gzipWriter := gzip.NewWriter(w)
 	defer gzipWriter.Close()
@@ -112,3 +124,234 @@ func handleError(w http.ResponseWriter, r *http.Request, logger services.Logger,
 	}
 	http.Error(w, responseText, code)
 }
+
+// getMessageQuery reads the before, after, around and limit query parameters used to page through messages.
+// The limit is capped instead of rejected so clients don't need to know the server's maximum.
+func getMessageQuery(r *http.Request) (*models.MessageQuery, error) {
+	query := &models.MessageQuery{Limit: models.DefaultMessageLimit}
+	anchors := 0
+	for name, anchor := range map[string]*int32{"before": &query.Before, "after": &query.After, "around": &query.Around} {
+		value := r.URL.Query().Get(name)
+		if value == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(value, 10, 32)
+		if err != nil || id <= 0 {
+			return nil, fmt.Errorf("an invalid %s message id was provided: %s", name, value)
+		}
+		*anchor = int32(id)
+		anchors++
+	}
+	if anchors > 1 {
+		return nil, fmt.Errorf("only one of before, after or around can be provided")
+	}
+
+	if value := r.URL.Query().Get("limit"); value != "" {
+		limit, err := strconv.ParseInt(value, 10, 32)
+		if err != nil || limit <= 0 {
+			return nil, fmt.Errorf("an invalid limit was provided: %s", value)
+		}
+		query.Limit = int32(min(limit, models.MaxMessageLimit))
+	}
+
+	return query, nil
+}
+
+// getThreadId reads the message that started a thread from the path. Routes without a thread return 0.
+func getThreadId(r *http.Request) (int32, error) {
+	value := r.PathValue("messageId")
+	if value == "" {
+		return 0, nil
+	}
+
+	threadId, err := strconv.ParseInt(value, 10, 32)
+	if err != nil || threadId <= 0 {
+		return 0, fmt.Errorf("an invalid thread was provided: %s", value)
+	}
+	return int32(threadId), nil
+}
+
+// getMessageSearch reads the search text and filters from the query parameters.
+// Dates are expected in RFC 3339 format.
+func getMessageSearch(r *http.Request) (*models.MessageSearch, error) {
+	values := r.URL.Query()
+	search := &models.MessageSearch{
+		Query: strings.TrimSpace(values.Get("q")),
+		Limit: models.DefaultSearchLimit,
+	}
+	if search.Query == "" {
+		return nil, fmt.Errorf("no search query was provided")
+	}
+
+	for name, filter := range map[string]*int32{
+		"guild_id":   &search.GuildId,
+		"channel_id": &search.ChannelId,
+		"author_id":  &search.AuthorId,
+		"limit":      &search.Limit,
+		"offset":     &search.Offset,
+	} {
+		value := values.Get(name)
+		if value == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(value, 10, 32)
+		if err != nil || id < 0 {
+			return nil, fmt.Errorf("an invalid %s was provided: %s", name, value)
+		}
+		*filter = int32(id)
+	}
+	if search.Limit <= 0 {
+		return nil, fmt.Errorf("an invalid limit was provided: %d", search.Limit)
+	}
+	search.Limit = min(search.Limit, models.MaxSearchLimit)
+
+	for name, filter := range map[string]**time.Time{"before": &search.Before, "after": &search.After} {
+		value := values.Get(name)
+		if value == "" {
+			continue
+		}
+		date, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return nil, fmt.Errorf("an invalid %s date was provided: %s", name, value)
+		}
+		*filter = &date
+	}
+
+	if value := values.Get("has_attachment"); value != "" {
+		hasAttachment, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("an invalid has_attachment was provided: %s", value)
+		}
+		search.HasAttachment = hasAttachment
+	}
+
+	return search, nil
+}
+
+// getAuditLogQuery reads the before, limit, user_id and action query parameters used to page through a guild's audit log.
+func getAuditLogQuery(r *http.Request) (*models.AuditLogQuery, error) {
+	values := r.URL.Query()
+	query := &models.AuditLogQuery{Limit: models.DefaultAuditLogLimit}
+
+	for name, filter := range map[string]*int32{
+		"before":  &query.Before,
+		"user_id": &query.UserId,
+		"limit":   &query.Limit,
+	} {
+		value := values.Get(name)
+		if value == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(value, 10, 32)
+		if err != nil || id <= 0 {
+			return nil, fmt.Errorf("an invalid %s was provided: %s", name, value)
+		}
+		*filter = int32(id)
+	}
+	query.Limit = min(query.Limit, models.MaxAuditLogLimit)
+
+	if action := values.Get("action"); action != "" {
+		if !models.IsValidAuditLogAction(action) {
+			return nil, fmt.Errorf("an invalid action was provided: %s", action)
+		}
+		query.Action = action
+	}
+
+	return query, nil
+}
+
+// notify sends the event from the user to the receivers connected to the websocket server.
+// Failing to notify is logged instead of failing the request because the change has already been saved.
+func notify(logger services.Logger, websocketServer *services.WebsocketServer, userId int32, event *models.WebsocketMessage, receivers map[int32]bool) {
+	if err := websocketServer.Broadcast(userId, event, receivers); err != nil {
+		logger.ERROR(fmt.Sprintf("an error occurred while broadcasting %s from %d: %v", event.Type, userId, err))
+	}
+}
+
+// writeAuditLog records an administrative action taken by the user in the guild. It's written once the change has
+// been saved, so a failure is logged instead of failing the request, otherwise a retry would make the change twice.
+func writeAuditLog(r *http.Request, db data.IDatabase, logger services.Logger, claims *models.Claims, guildId int32, action string, targetId int32, details any) {
+	entry := &models.AuditLogEntry{
+		GuildId:  guildId,
+		UserId:   claims.ID,
+		Action:   action,
+		TargetId: &targetId,
+	}
+	if targetId == 0 {
+		entry.TargetId = nil
+	}
+	if details != nil {
+		marshaled, err := json.Marshal(details)
+		if err != nil {
+			logger.ERROR(fmt.Sprintf("an error occurred while marshaling details of %s for the audit log of guild %d: %v", action, guildId, err))
+		}
+		entry.Details = marshaled
+	}
+
+	// The change has already been saved, so the entry is still written if the client disconnects.
+	if err := db.CreateAuditLogEntry(context.WithoutCancel(r.Context()), entry); err != nil {
+		requestId, requestErr := getRequestID(r)
+		if requestErr != nil {
+			requestId = requestErr.Error()
+		}
+		logger.ERROR(fmt.Sprintf("requestId: %s: %s of %s in guild %d was not written to the audit log: %v", requestId, action, claims.Username, guildId, err))
+	}
+}
+
+// requireGuildPermission returns data.ErrUserLacksPermission when the user is missing any of the permissions in the guild.
+func requireGuildPermission(ctx context.Context, db data.IDatabase, guildId, userId int32, permission models.Permission) error {
+	permissions, err := db.GetGuildPermissions(ctx, guildId, userId)
+	if err != nil {
+		return err
+	}
+	if !permissions.Has(permission) {
+		return data.ErrUserLacksPermission
+	}
+	return nil
+}
+
+// requireChannelPermission returns data.ErrUserLacksPermission when the user is missing any of the permissions in the channel.
+func requireChannelPermission(ctx context.Context, db data.IDatabase, channelId, userId int32, permission models.Permission) error {
+	permissions, err := db.GetChannelPermissions(ctx, channelId, userId)
+	if err != nil {
+		return err
+	}
+	if !permissions.Has(permission) {
+		return data.ErrUserLacksPermission
+	}
+	return nil
+}
+
+// requireModeratable returns data.ErrUserLacksPermission when the target is the guild owner or has permissions
+// at or above the actor's. It's checked on top of the permission for the action itself.
+func requireModeratable(ctx context.Context, db data.IDatabase, guildId, actorId, targetId int32) error {
+	guild, err := db.GetGuildByID(ctx, guildId, actorId)
+	if err != nil {
+		return err
+	}
+	actor, err := db.GetGuildPermissions(ctx, guildId, actorId)
+	if err != nil {
+		return err
+	}
+	// Users that already left the guild have no permissions and can always be banned.
+	target, err := db.GetGuildPermissions(ctx, guildId, targetId)
+	if err != nil {
+		return err
+	}
+	if !models.CanModerate(guild.OwnerId == actorId, actor, guild.OwnerId == targetId, target) {
+		return data.ErrUserLacksPermission
+	}
+	return nil
+}
+
+// handlePermissionError responds to errors returned by requireGuildPermission and requireChannelPermission.
+func handlePermissionError(w http.ResponseWriter, r *http.Request, logger services.Logger, err error, claims *models.Claims) {
+	switch {
+	case errors.Is(err, data.ErrUserLacksPermission):
+		handleError(w, r, logger, fmt.Errorf("%s attempted an action without permission: %v", claims.Username, err), claims, http.StatusUnauthorized, "warning")
+	case errors.Is(err, data.ErrRoleNotFound) || errors.Is(err, sql.ErrNoRows):
+		handleError(w, r, logger, err, claims, http.StatusNotFound, "warning")
+	default:
+		handleError(w, r, logger, err, claims, http.StatusInternalServerError, "error")
+	}
+}
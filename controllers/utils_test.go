@@ -11,6 +11,7 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 	"tranquility/middleware"
 	"tranquility/models"
 )
@@ -253,6 +254,25 @@ func TestWriteJsonBody(t *testing.T) {
 	}
 }
 
+func TestWriteJsonBodyStatus(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	if err := writeJsonBodyStatus(recorder, http.StatusCreated, TestStruct{StringField: "test"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The result only has the headers that were set before the status was written.
+	result := recorder.Result()
+	if result.StatusCode != http.StatusCreated {
+		t.Errorf("expected status %d, got %d", http.StatusCreated, result.StatusCode)
+	}
+	if result.Header.Get("content-type") != "application/json" {
+		t.Errorf("content-type header not set correctly")
+	}
+	if result.Header.Get("Content-Encoding") != "gzip" {
+		t.Errorf("Content-Encoding header not set correctly")
+	}
+}
+
 func TestHandleError(t *testing.T) {
 	// Create a mock logger
 	mockLogger := &MockLogger{}
@@ -340,6 +360,124 @@ func TestHandleError(t *testing.T) {
 	}
 }
 
+func TestGetMessageQuery(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		want    models.MessageQuery
+		wantErr bool
+	}{
+		{
+			name:  "Defaults",
+			query: "",
+			want:  models.MessageQuery{Limit: models.DefaultMessageLimit},
+		},
+		{
+			name:  "Before with limit",
+			query: "before=120&limit=20",
+			want:  models.MessageQuery{Before: 120, Limit: 20},
+		},
+		{
+			name:  "Around",
+			query: "around=42",
+			want:  models.MessageQuery{Around: 42, Limit: models.DefaultMessageLimit},
+		},
+		{
+			name:  "Limit is capped",
+			query: "after=7&limit=5000",
+			want:  models.MessageQuery{After: 7, Limit: models.MaxMessageLimit},
+		},
+		{
+			name:    "Multiple anchors",
+			query:   "before=10&after=5",
+			wantErr: true,
+		},
+		{
+			name:    "Invalid anchor",
+			query:   "around=abc",
+			wantErr: true,
+		},
+		{
+			name:    "Invalid limit",
+			query:   "limit=0",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/guild/1/channel/1/message?"+tt.query, nil)
+
+			got, err := getMessageQuery(req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getMessageQuery() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && *got != tt.want {
+				t.Errorf("getMessageQuery() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetMessageSearch(t *testing.T) {
+	after := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name    string
+		query   string
+		want    models.MessageSearch
+		wantErr bool
+	}{
+		{
+			name:  "Query only",
+			query: "q=hello+world",
+			want:  models.MessageSearch{Query: "hello world", Limit: models.DefaultSearchLimit},
+		},
+		{
+			name:  "Filters",
+			query: "q=hello&guild_id=1&channel_id=2&author_id=3&after=2024-01-02T03:04:05Z&has_attachment=true&limit=500&offset=25",
+			want: models.MessageSearch{
+				Query:         "hello",
+				GuildId:       1,
+				ChannelId:     2,
+				AuthorId:      3,
+				After:         &after,
+				HasAttachment: true,
+				Limit:         models.MaxSearchLimit,
+				Offset:        25,
+			},
+		},
+		{
+			name:    "Missing query",
+			query:   "q=+&guild_id=1",
+			wantErr: true,
+		},
+		{
+			name:    "Invalid date",
+			query:   "q=hello&before=yesterday",
+			wantErr: true,
+		},
+		{
+			name:    "Invalid limit",
+			query:   "q=hello&limit=0",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/message/search?"+tt.query, nil)
+
+			got, err := getMessageSearch(req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getMessageSearch() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("getMessageSearch() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
 // Mock logger implementation
 type MockLogger struct {
 	LastMessage string
@@ -360,3 +498,52 @@ func (m *MockLogger) INFO(msg string) {
 func (m *MockLogger) TRACE(msg string) {
 	m.LastMessage = msg
 }
+
+func TestGetAuditLogQuery(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		want    models.AuditLogQuery
+		wantErr bool
+	}{
+		{
+			name:  "Defaults",
+			query: "",
+			want:  models.AuditLogQuery{Limit: models.DefaultAuditLogLimit},
+		},
+		{
+			name:  "All filters",
+			query: "before=90&limit=10&user_id=3&action=member_ban",
+			want:  models.AuditLogQuery{Before: 90, Limit: 10, UserId: 3, Action: models.AuditMemberBan},
+		},
+		{
+			name:  "Limit is capped",
+			query: "limit=5000",
+			want:  models.AuditLogQuery{Limit: models.MaxAuditLogLimit},
+		},
+		{
+			name:    "Unknown action",
+			query:   "action=message_create",
+			wantErr: true,
+		},
+		{
+			name:    "Invalid user",
+			query:   "user_id=-1",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/guild/1/audit-log?"+tt.query, nil)
+
+			got, err := getAuditLogQuery(req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getAuditLogQuery() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && *got != tt.want {
+				t.Errorf("getAuditLogQuery() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
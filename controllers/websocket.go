@@ -7,7 +7,6 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
-	"strconv"
 	"time"
 	"tranquility/app"
 	"tranquility/data"
@@ -20,8 +19,25 @@ import (
 )
 
 var (
-	clientTimeout    = 10 * time.Second
-	ErrNoMessageSent = errors.New("no message data was sent from the user")
+	// Clients are told in hello to send a heartbeat this often.
+	heartbeatInterval = 10 * time.Second
+	// The connection is closed once no heartbeat has been received for this long,
+	// which leaves room for heartbeats that were delayed on the way.
+	heartbeatTimeout = heartbeatInterval + 5*time.Second
+
+	ErrNoMessageSent        = errors.New("no message data was sent from the user")
+	ErrWebsocketRateLimited = errors.New("too many messages were sent over the websocket")
+	ErrWebsocketProtocol    = errors.New("a message that could not be read was sent over the websocket")
+
+	// clientEvents are the types the main loop handles once the connection is authenticated, resume is handled before them.
+	clientEvents = map[string]bool{
+		"message":        true,
+		"message_update": true,
+		"message_delete": true,
+		"typing_start":   true,
+		"subscribe":      true,
+		"unsubscribe":    true,
+	}
 )
 
 type WebsocketController struct {
@@ -30,6 +46,8 @@ type WebsocketController struct {
 	websocketServer         *services.WebsocketServer
 	audience                []string
 	pushNotificationService *services.PushNotificationService
+	// serverId marks the connections this server holds so they can be told apart from other servers'.
+	serverId string
 }
 
 func NewWebsocketController(
@@ -38,6 +56,7 @@ func NewWebsocketController(
 	websocketServer *services.WebsocketServer,
 	audience []string,
 	pushNotificationService *services.PushNotificationService,
+	serverId string,
 ) *WebsocketController {
 	return &WebsocketController{
 		db,
@@ -45,33 +64,57 @@ func NewWebsocketController(
 		websocketServer,
 		audience,
 		pushNotificationService,
+		serverId,
 	}
 }
 
 func (wc *WebsocketController) RegisterRoutes(app *app.App) {
-	app.AddRoute("GET", "/ws/{id}/{token}", wc.Websocket)
+	app.AddSecureRoute("POST", "/api/ws/ticket", wc.createTicket)
+	app.AddRoute("GET", "/ws", wc.Websocket)
 }
 
-func (wc *WebsocketController) Websocket(w http.ResponseWriter, r *http.Request) {
-	limiter := rate.NewLimiter(rate.Every(time.Millisecond*100), 10)
-	ctx, cancel := context.WithCancel(r.Context())
-	defer cancel()
-
-	userId, err := strconv.ParseInt(r.PathValue("id"), 10, 32)
+// createTicket mints the short lived ticket a client needs to open a websocket connection.
+func (wc *WebsocketController) createTicket(w http.ResponseWriter, r *http.Request) {
+	claims, err := getClaims(r)
 	if err != nil {
-		handleError(w, r, wc.logger, err, nil, http.StatusBadRequest, "warning")
+		handleError(w, r, wc.logger, err, nil, http.StatusUnauthorized, "error")
 		return
 	}
-	websocketToken := r.PathValue("token")
 
-	user, err := wc.db.WebsocketLogin(ctx, int32(userId), websocketToken)
+	ticket, err := wc.db.CreateWebsocketTicket(r.Context(), claims.ID)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			handleError(w, r, wc.logger, err, nil, http.StatusUnauthorized, "warning")
+		handleError(w, r, wc.logger, err, claims, http.StatusInternalServerError, "error")
+		return
+	}
+
+	if err = writeJsonBodyStatus(w, http.StatusCreated, ticket); err != nil {
+		handleError(w, r, wc.logger, err, claims, http.StatusInternalServerError, "error")
+		return
+	}
+}
+
+func (wc *WebsocketController) Websocket(w http.ResponseWriter, r *http.Request) {
+	// Clients sending more than this are disconnected with models.CloseRateLimited.
+	limiter := rate.NewLimiter(rate.Every(time.Millisecond*100), 10)
+	// Creating, editing and deleting messages is limited further and rejected instead of delayed.
+	sendLimiter := rate.NewLimiter(rate.Every(time.Second), 5)
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	// A ticket passed while connecting is checked before upgrading so the client receives a normal 401.
+	// Clients that would rather keep the ticket out of the URL send it as the first message instead.
+	var user *models.AuthUser
+	if ticket := r.URL.Query().Get("ticket"); ticket != "" {
+		var err error
+		user, err = wc.db.WebsocketLogin(ctx, ticket)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				handleError(w, r, wc.logger, err, nil, http.StatusUnauthorized, "warning")
+				return
+			}
+			handleError(w, r, wc.logger, err, nil, http.StatusInternalServerError, "error")
 			return
 		}
-		handleError(w, r, wc.logger, err, nil, http.StatusInternalServerError, "error")
-		return
 	}
 
 	c, err := websocket.Accept(w, r, &websocket.AcceptOptions{
@@ -81,7 +124,31 @@ func (wc *WebsocketController) Websocket(w http.ResponseWriter, r *http.Request)
 		wc.logger.ERROR(fmt.Sprintf("Error accepting ws conection: %v", err))
 		return
 	}
-	defer c.CloseNow()
+	// closeStatus is sent to the client when the server is the one ending the connection.
+	// It's sent after the connection has been removed from the websocket server so nothing else is written after it.
+	var closeStatus websocket.StatusCode
+	var closeReason string
+	defer func() {
+		if closeStatus == 0 {
+			c.CloseNow()
+			return
+		}
+		c.Close(closeStatus, closeReason)
+	}()
+
+	if err := wc.sendHello(ctx, c); err != nil {
+		wc.logger.ERROR(fmt.Sprintf("Error sending hello to websocket connection: %v", err))
+		return
+	}
+
+	if user == nil {
+		user, err = wc.authenticate(ctx, c)
+		if err != nil {
+			wc.logger.WARNING(fmt.Sprintf("websocket connection was not able to authenticate: %v", err))
+			closeStatus, closeReason = models.CloseAuthenticationFailed, "a valid ticket is required"
+			return
+		}
+	}
 
 	handler := wc.websocketServer.NewHandler()
 	err = handler.Connect(user.ID, c)
@@ -91,60 +158,145 @@ func (wc *WebsocketController) Websocket(w http.ResponseWriter, r *http.Request)
 	}
 	defer func() {
 		if err := handler.Disconnect(user.ID); err != nil {
-			wc.logger.ERROR(fmt.Sprintf("Error disconnecting user to websocket server: %v", err))
+			wc.logger.ERROR(fmt.Sprintf("Error disconnecting user %d on %s from websocket server: %v", user.ID, handler.ConnectionID(), err))
 		}
+		// The request context is usually already canceled once the client has gone away.
+		wc.updatePresenceConnections(context.WithoutCancel(ctx), user.ID, -1)
 	}()
+	wc.updatePresenceConnections(ctx, user.ID, 1)
 
 	incoming := make(chan *models.WebsocketMessage)
 	errChan := make(chan error)
-	ping := make(chan struct{})
+	heartbeat := make(chan struct{})
 
 	go func() {
 		defer close(incoming)
 		for {
-			isPing, err := handleConnection(ctx, c, limiter, incoming)
+			isHeartbeat, err := handleConnection(ctx, c, limiter, incoming)
 			if err != nil {
-				if websocket.CloseStatus(err) == websocket.StatusNormalClosure || err == context.Canceled {
+				if websocket.CloseStatus(err) == websocket.StatusNormalClosure || errors.Is(err, context.Canceled) {
 					return
 				}
-				errChan <- err
+				select {
+				case errChan <- err:
+				case <-ctx.Done():
+				}
+				return
 			}
-			if isPing {
-				ping <- struct{}{}
+			if isHeartbeat {
+				select {
+				case heartbeat <- struct{}{}:
+				case <-ctx.Done():
+					return
+				}
 			}
 		}
 	}()
 
-	ticker := time.NewTicker(clientTimeout)
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
 	lastHeartbeat := time.Now()
 
 	for {
 		select {
 		case <-ticker.C:
-			if time.Since(lastHeartbeat) > clientTimeout {
-				wc.logger.ERROR("connection timeout, disconnecting")
+			if time.Since(lastHeartbeat) > heartbeatTimeout {
+				wc.logger.WARNING(fmt.Sprintf("%s did not send a heartbeat in time, disconnecting", user.Username))
+				closeStatus, closeReason = models.CloseHeartbeatTimeout, "no heartbeat was received"
 				return
 			}
-		case <-ping:
+		case <-heartbeat:
 			lastHeartbeat = time.Now()
-		case msg := <-incoming:
+			wc.reply(handler, user, models.NewWebsocketMessage("heartbeat_ack", nil))
+		case msg, ok := <-incoming:
+			if !ok {
+				return
+			}
+			// Resuming only changes which session the connection belongs to, so there's nothing to broadcast.
+			if msg.Type == "resume" {
+				if err := handler.Resume(user.ID, msg.Data.(*models.WebsocketSession)); err != nil {
+					wc.logger.ERROR(fmt.Sprintf("an error occurred while %s was resuming a websocket session: %v", user.Username, err))
+				}
+				continue
+			}
+
+			request := &models.WebsocketMessage{Type: msg.Type, Nonce: msg.Nonce}
+			// The nonce isn't claimed, so it's left alone in case it belongs to an event that is still being handled.
+			if !clientEvents[msg.Type] {
+				wc.logger.WARNING(fmt.Sprintf("%s sent an unsupported %q event over the websocket", user.Username, msg.Type))
+				event := &models.WebsocketError{Nonce: msg.Nonce, Type: msg.Type, Code: models.WebsocketErrorValidation, Message: "the event type is not supported"}
+				wc.reply(handler, user, models.NewWebsocketMessage("error", event))
+				continue
+			}
+			if !wc.claimNonce(handler, user, msg) {
+				continue
+			}
+			switch msg.Type {
+			case "message", "message_update", "message_delete":
+				if !sendLimiter.Allow() {
+					wc.replyError(handler, user, request, models.WebsocketErrorRateLimited, "messages are being sent too quickly")
+					continue
+				}
+			case "subscribe", "unsubscribe":
+				if err := handler.Subscribe(user.ID, msg.Type == "subscribe", msg.Data.(*models.WebsocketTopic)); err != nil {
+					if errors.Is(err, services.ErrTooManySubscriptions) {
+						wc.replyError(handler, user, request, models.WebsocketErrorValidation, err.Error())
+						continue
+					}
+					wc.logger.ERROR(fmt.Sprintf("an error occurred while %s was changing websocket subscriptions: %v", user.Username, err))
+					wc.replyError(handler, user, request, models.WebsocketErrorInternal, "an error occurred while handling the event")
+					continue
+				}
+				wc.ack(handler, user, request, nil)
+				continue
+			}
+
 			msg, receivers, err := wc.handleIncomingMessage(ctx, user, msg)
 			if err != nil {
 				if errors.Is(err, ErrNoMessageSent) {
 					wc.logger.WARNING(fmt.Sprintf("%s sent an empty message over the websocket: %v", user.Username, err))
+					wc.replyError(handler, user, request, models.WebsocketErrorValidation, err.Error())
+					continue
+				}
+				if errors.Is(err, data.ErrUserLacksPermission) {
+					wc.logger.WARNING(fmt.Sprintf("%s sent a message over the websocket without permission: %v", user.Username, err))
+					wc.replyError(handler, user, request, models.WebsocketErrorPermission, err.Error())
+					continue
+				}
+				if errors.Is(err, data.ErrMessageNotFound) {
+					wc.logger.WARNING(fmt.Sprintf("%s referenced a message that does not exist over the websocket: %v", user.Username, err))
+					wc.replyError(handler, user, request, models.WebsocketErrorNotFound, err.Error())
 					continue
 				}
 				wc.logger.ERROR(fmt.Sprintf("an error occurred while handling request: %v", err))
 				if msg == nil {
+					wc.replyError(handler, user, request, models.WebsocketErrorInternal, "an error occurred while handling the event")
 					wc.logger.ERROR("ending incoming message execution")
 					return
 				}
 
 				wc.logger.ERROR("message was successfully created but receivers were not able to be collected. sending notification to sender.")
 			}
-			handler.SendMessage(user.ID, msg, receivers)
+			// Events such as typing_start are relayed by the websocket server itself.
+			if msg == nil {
+				wc.ack(handler, user, request, nil)
+				continue
+			}
+			wc.ack(handler, user, request, msg.Data)
+			if err := handler.SendMessage(user.ID, msg, receivers); err != nil {
+				wc.logger.ERROR(fmt.Sprintf("message from %s was not able to be sent: %v", user.Username, err))
+			}
 		case err := <-errChan:
-			wc.logger.ERROR(fmt.Sprintf("error reading from websocket: %v", err))
+			switch {
+			case errors.Is(err, ErrWebsocketRateLimited):
+				wc.logger.WARNING(fmt.Sprintf("%s was disconnected for sending too many messages over the websocket", user.Username))
+				closeStatus, closeReason = models.CloseRateLimited, "too many messages were sent"
+			case errors.Is(err, ErrWebsocketProtocol):
+				wc.logger.WARNING(fmt.Sprintf("%s was disconnected for sending an invalid message over the websocket: %v", user.Username, err))
+				closeStatus, closeReason = models.CloseProtocolError, "a message could not be read"
+			default:
+				wc.logger.ERROR(fmt.Sprintf("error reading from websocket: %v", err))
+			}
 			return
 		case <-ctx.Done():
 			return
@@ -152,32 +304,77 @@ func (wc *WebsocketController) Websocket(w http.ResponseWriter, r *http.Request)
 	}
 }
 
-func handleConnection(ctx context.Context, conn *websocket.Conn, limiter *rate.Limiter, incoming chan<- *models.WebsocketMessage) (bool, error) {
-	err := limiter.Wait(ctx)
+// sendHello is written before the connection is handed to the websocket server, which writes everything after it.
+func (wc *WebsocketController) sendHello(ctx context.Context, conn *websocket.Conn) error {
+	hello := &models.WebsocketHello{HeartbeatInterval: heartbeatInterval.Milliseconds()}
+	event, err := models.NewWebsocketEvent(models.NewWebsocketMessage("hello", hello), nil)
 	if err != nil {
-		return false, err
+		return err
 	}
+	frame, err := event.Frame(0)
+	if err != nil {
+		return err
+	}
+
+	writeContext, cancel := context.WithTimeout(ctx, heartbeatInterval)
+	defer cancel()
+	return conn.Write(writeContext, websocket.MessageText, frame)
+}
+
+// authenticate waits for the authenticate message that has to be sent first when no ticket was passed while connecting.
+func (wc *WebsocketController) authenticate(ctx context.Context, conn *websocket.Conn) (*models.AuthUser, error) {
+	readContext, cancel := context.WithTimeout(ctx, heartbeatInterval)
+	defer cancel()
 
+	typ, r, err := conn.Read(readContext)
+	if err != nil {
+		return nil, err
+	}
+	if typ != websocket.MessageText {
+		return nil, fmt.Errorf("unexpected message type: %d", typ)
+	}
+
+	var message models.WebsocketMessageWrapper
+	if err := json.Unmarshal(r, &message); err != nil {
+		return nil, err
+	}
+	if message.Type != "authenticate" {
+		return nil, fmt.Errorf("expected authenticate as the first message but received %s", message.Type)
+	}
+	var ticket models.WebsocketTicket
+	if err := json.Unmarshal(message.Data, &ticket); err != nil || ticket.Ticket == "" {
+		return nil, fmt.Errorf("no ticket was provided to authenticate: %v", err)
+	}
+
+	return wc.db.WebsocketLogin(ctx, ticket.Ticket)
+}
+
+// handleConnection reads the next message from the client and returns true when it was a heartbeat.
+// Ping is the heartbeat sent by clients from before hello advertised the interval.
+func handleConnection(ctx context.Context, conn *websocket.Conn, limiter *rate.Limiter, incoming chan<- *models.WebsocketMessage) (bool, error) {
 	typ, r, err := conn.Read(ctx)
 	if err != nil {
 		return false, err
 	}
+	if !limiter.Allow() {
+		return false, ErrWebsocketRateLimited
+	}
 
 	if typ != websocket.MessageText {
-		return false, fmt.Errorf("unexpected message type: %d", typ)
+		return false, fmt.Errorf("%w: unexpected message type: %d", ErrWebsocketProtocol, typ)
 	}
 
 	var message models.WebsocketMessageWrapper
 	err = json.Unmarshal(r, &message)
 	if err != nil {
-		return false, err
+		return false, fmt.Errorf("%w: %v", ErrWebsocketProtocol, err)
 	}
-	if message.Type == "Ping" {
+	if message.Type == "heartbeat" || message.Type == "Ping" {
 		return true, nil
 	}
 	data, err := message.ToMessage()
 	if err != nil {
-		return false, err
+		return false, fmt.Errorf("%w: %v", ErrWebsocketProtocol, err)
 	}
 
 	select {
@@ -189,6 +386,51 @@ func handleConnection(ctx context.Context, conn *websocket.Conn, limiter *rate.L
 	return false, nil
 }
 
+// claimNonce returns false when the event shouldn't be handled because its nonce is invalid or was already used.
+// A retry of an event that was already handled is sent the same ack again, and a retry of an event that is
+// still being handled is dropped since the ack is on its way.
+func (wc *WebsocketController) claimNonce(handler *services.WebsocketHandler, user *models.AuthUser, msg *models.WebsocketMessage) bool {
+	if msg.Nonce == "" {
+		return true
+	}
+	if len(msg.Nonce) > models.MaxWebsocketNonceLength {
+		message := fmt.Sprintf("the nonce can't be longer than %d characters", models.MaxWebsocketNonceLength)
+		wc.replyError(handler, user, &models.WebsocketMessage{Type: msg.Type}, models.WebsocketErrorValidation, message)
+		return false
+	}
+
+	ack, claimed := wc.websocketServer.ClaimNonce(user.ID, msg.Nonce)
+	if !claimed && ack != nil {
+		wc.reply(handler, user, models.NewWebsocketMessage("ack", ack))
+	}
+	return claimed
+}
+
+// ack tells the sender their event was handled when they sent it with a nonce.
+func (wc *WebsocketController) ack(handler *services.WebsocketHandler, user *models.AuthUser, request *models.WebsocketMessage, data models.WebsocketMessageData) {
+	if request.Nonce == "" {
+		return
+	}
+	ack := &models.WebsocketAck{Nonce: request.Nonce, Type: request.Type, Data: data}
+	wc.websocketServer.CompleteNonce(user.ID, ack)
+	wc.reply(handler, user, models.NewWebsocketMessage("ack", ack))
+}
+
+// replyError tells the sender their event was not handled. The nonce is forgotten so the client is able to retry it.
+func (wc *WebsocketController) replyError(handler *services.WebsocketHandler, user *models.AuthUser, request *models.WebsocketMessage, code, message string) {
+	if request.Nonce != "" {
+		wc.websocketServer.ReleaseNonce(user.ID, request.Nonce)
+	}
+	event := &models.WebsocketError{Nonce: request.Nonce, Type: request.Type, Code: code, Message: message}
+	wc.reply(handler, user, models.NewWebsocketMessage("error", event))
+}
+
+func (wc *WebsocketController) reply(handler *services.WebsocketHandler, user *models.AuthUser, event *models.WebsocketMessage) {
+	if err := handler.Reply(user.ID, event); err != nil {
+		wc.logger.ERROR(fmt.Sprintf("%s was not able to be sent %s: %v", user.Username, event.Type, err))
+	}
+}
+
 func (wc *WebsocketController) handleIncomingMessage(ctx context.Context, user *models.AuthUser, message *models.WebsocketMessage) (*models.WebsocketMessage, map[int32]bool, error) {
 	receivers := map[int32]bool{user.ID: true}
 
@@ -198,11 +440,19 @@ func (wc *WebsocketController) handleIncomingMessage(ctx context.Context, user *
 		if data.Content == "" && len(data.AttachmentIDs) == 0 {
 			return nil, nil, ErrNoMessageSent
 		}
+		required := models.PermissionViewChannel | models.PermissionSendMessages
+		if len(data.AttachmentIDs) > 0 {
+			required |= models.PermissionAttachFiles
+		}
+		if err := requireChannelPermission(ctx, wc.db, data.ChannelID, user.ID, required); err != nil {
+			return nil, nil, err
+		}
 		output, err := wc.db.CreateMessage(ctx, data, user.ID)
 		if err != nil {
 			return nil, nil, err
 		}
 		message.Data = output
+		wc.websocketServer.StopTyping(user.ID, output.ChannelID)
 		rec, err := wc.db.GetChannelMembers(ctx, data.ChannelID)
 		if err != nil {
 			return message, receivers, err
@@ -212,32 +462,67 @@ func (wc *WebsocketController) handleIncomingMessage(ctx context.Context, user *
 			receivers[k] = v
 		}
 
-		notifications, err := wc.db.GetNotificationRecipients(ctx, user.ID, data.ChannelID)
+		// The message has already been saved, so it's still sent and acknowledged without push notifications.
+		// Failing the event would release its nonce and let the client create the message again.
+		notifications, mentioned, err := wc.getNotificationRecipients(ctx, user, output)
 		if err != nil {
-			return nil, nil, fmt.Errorf("an error occurred while collecting push notification receivers: %v", err)
-		}
-		go func() {
-			pushMessage := models.NewPushNotificationMessage(
-				fmt.Sprintf("A new message was just posted in %s", output.Guild),
-				fmt.Sprintf("%s sent a message in %s(%s)", user.Username, output.Guild, output.Channel),
-				fmt.Sprintf("/guild/%d/channel/%d", output.GuildID, output.ChannelID),
-				nil,
-			)
-			for _, x := range notifications {
-				if err := wc.pushNotificationService.SimplePush(
-					&webpush.Subscription{
-						Endpoint: x.Endpoint,
-						Keys: webpush.Keys{
-							Auth:   x.Auth,
-							P256dh: x.P256dh,
-						},
-					},
-					pushMessage,
-				); err != nil {
-					wc.logger.ERROR(fmt.Sprintf("an error occurred while sending notification to %s: %v", user.Username, err))
-				}
-			}
-		}()
+			wc.logger.ERROR(fmt.Sprintf("push notifications for message %d from %s were skipped: %v", output.ID, user.Username, err))
+			break
+		}
+		go wc.sendMessageNotifications(user, output, notifications, mentioned)
+	case "message_update":
+		data := message.Data.(*models.Message)
+		if data.Content == "" {
+			return nil, nil, ErrNoMessageSent
+		}
+		output, err := wc.db.UpdateMessage(ctx, data, user.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+		message.Data = output
+		rec, err := wc.db.GetChannelMembers(ctx, output.ChannelID)
+		if err != nil {
+			return message, receivers, err
+		}
+
+		for k, v := range rec {
+			receivers[k] = v
+		}
+	case "message_delete":
+		data := message.Data.(*models.Message)
+		output, err := wc.db.DeleteMessage(ctx, data.ChannelID, data.ID, user.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+		message.Data = output
+		rec, err := wc.db.GetChannelMembers(ctx, output.ChannelID)
+		if err != nil {
+			return message, receivers, err
+		}
+
+		for k, v := range rec {
+			receivers[k] = v
+		}
+	case "typing_start":
+		data := message.Data.(*models.Typing)
+		// Clients repeat typing_start while the user types, so repeats are handled before touching the database.
+		if wc.websocketServer.ExtendTyping(user.ID, data.ChannelId) {
+			return nil, nil, nil
+		}
+		if err := requireChannelPermission(ctx, wc.db, data.ChannelId, user.ID, models.PermissionViewChannel|models.PermissionSendMessages); err != nil {
+			return nil, nil, err
+		}
+		rec, err := wc.db.GetChannelMembers(ctx, data.ChannelId)
+		if err != nil {
+			return nil, nil, err
+		}
+		delete(rec, user.ID)
+
+		typing := &models.Typing{ChannelId: data.ChannelId, UserId: user.ID, Username: user.Username}
+		if err := wc.websocketServer.StartTyping(typing, rec); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, nil
 	default:
 		wc.logger.ERROR(fmt.Sprintf("an unknown message type was handled by handleIncomingMessage: %s", message.Type))
 		return nil, nil, fmt.Errorf("an unknown message type was passed")
@@ -245,3 +530,144 @@ func (wc *WebsocketController) handleIncomingMessage(ctx context.Context, user *
 
 	return message, receivers, nil
 }
+
+// getNotificationRecipients collects who receives a push notification for the message and who of them were mentioned.
+// Only the participants of a thread are notified instead of the entire channel.
+func (wc *WebsocketController) getNotificationRecipients(ctx context.Context, user *models.AuthUser, message *models.Message) ([]models.PushNotificationInfo, []models.PushNotificationInfo, error) {
+	var notifications []models.PushNotificationInfo
+	var err error
+	if message.ThreadId != nil {
+		notifications, err = wc.db.GetThreadNotificationRecipients(ctx, user.ID, *message.ThreadId)
+	} else {
+		notifications, err = wc.db.GetNotificationRecipients(ctx, user.ID, message.ChannelID)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("an error occurred while collecting push notification receivers: %v", err)
+	}
+
+	var mentioned []models.PushNotificationInfo
+	if message.Mentions != nil {
+		mentioned, err = wc.db.GetMentionNotificationRecipients(ctx, user.ID, message.ID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("an error occurred while collecting mentioned push notification receivers: %v", err)
+		}
+	}
+	return notifications, mentioned, nil
+}
+
+// sendMessageNotifications sends mentioned users a high urgency notification in place of the generic one
+// everyone else receives.
+func (wc *WebsocketController) sendMessageNotifications(user *models.AuthUser, message *models.Message, notifications, mentioned []models.PushNotificationInfo) {
+	pushMessage := models.NewPushNotificationMessage(
+		fmt.Sprintf("A new message was just posted in %s", message.Guild),
+		fmt.Sprintf("%s sent a message in %s(%s)", user.Username, message.Guild, message.Channel),
+		fmt.Sprintf("/guild/%d/channel/%d", message.GuildID, message.ChannelID),
+		nil,
+	)
+	mentionMessage := models.NewPushNotificationMessage(
+		fmt.Sprintf("%s mentioned you in %s(%s)", user.Username, message.Guild, message.Channel),
+		message.Content,
+		fmt.Sprintf("/guild/%d/channel/%d", message.GuildID, message.ChannelID),
+		nil,
+	)
+	// Direct messages don't belong to a guild.
+	if message.GuildID == 0 {
+		pushMessage = models.NewPushNotificationMessage(
+			fmt.Sprintf("%s sent you a direct message", user.Username),
+			message.Content,
+			fmt.Sprintf("/dm/%d", message.ChannelID),
+			nil,
+		)
+		mentionMessage = models.NewPushNotificationMessage(
+			fmt.Sprintf("%s mentioned you in a direct message", user.Username),
+			message.Content,
+			fmt.Sprintf("/dm/%d", message.ChannelID),
+			nil,
+		)
+	}
+
+	mentionedUsers := make(map[int32]bool, len(mentioned))
+	for _, x := range mentioned {
+		mentionedUsers[x.UserID] = true
+		wc.push(user, &x, mentionMessage, webpush.UrgencyHigh, "mentions")
+	}
+	for _, x := range notifications {
+		if !mentionedUsers[x.UserID] {
+			wc.push(user, &x, pushMessage, webpush.UrgencyNormal, "updates")
+		}
+	}
+}
+
+func (wc *WebsocketController) push(user *models.AuthUser, info *models.PushNotificationInfo, message *models.PushNotificationMessage, urgency webpush.Urgency, topic string) {
+	if err := wc.pushNotificationService.Push(
+		&webpush.Subscription{
+			Endpoint: info.Endpoint,
+			Keys: webpush.Keys{
+				Auth:   info.Auth,
+				P256dh: info.P256dh,
+			},
+		},
+		message,
+		urgency,
+		topic,
+	); err != nil {
+		wc.logger.ERROR(fmt.Sprintf("an error occurred while sending notification to %s: %v", user.Username, err))
+	}
+}
+
+// updatePresenceConnections tracks the user's open connections and tells users that share a guild with them
+// when they come online or go offline.
+func (wc *WebsocketController) updatePresenceConnections(ctx context.Context, userId int32, delta int32) {
+	changed, err := wc.db.UpdatePresenceConnections(ctx, wc.serverId, userId, delta)
+	if err != nil {
+		wc.logger.ERROR(fmt.Sprintf("an error occurred while updating presence connections of %d: %v", userId, err))
+		return
+	}
+	if changed {
+		broadcastPresence(ctx, wc.logger, wc.db, wc.websocketServer, userId)
+	}
+}
+
+// ClearPresence removes the connections this server had open before it was restarted, since they were never
+// disconnected. It should be called before the server starts accepting connections.
+func (wc *WebsocketController) ClearPresence(ctx context.Context) error {
+	return wc.db.ClearPresenceConnections(ctx, wc.serverId)
+}
+
+// # This function should be ran in a goroutine.
+//
+// TrackPresence keeps this server's connections from expiring until the context is done. Users whose only
+// connections were on a server that stopped are shown as offline once those connections expire.
+func (wc *WebsocketController) TrackPresence(ctx context.Context) {
+	ticker := time.NewTicker(models.PresenceHeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			expired, err := wc.db.RefreshPresenceConnections(ctx, wc.serverId)
+			if err != nil {
+				wc.logger.ERROR(fmt.Sprintf("an error occurred while refreshing presence connections: %v", err))
+				continue
+			}
+			notified := make(map[int32]bool)
+			for _, userId := range expired {
+				if notified[userId] {
+					continue
+				}
+				notified[userId] = true
+				// The user may still be connected to another server.
+				presence, err := wc.db.GetPresence(ctx, userId)
+				if err != nil {
+					wc.logger.ERROR(fmt.Sprintf("an error occurred while collecting presence of %d: %v", userId, err))
+					continue
+				}
+				if presence.Status == models.PresenceOffline {
+					broadcastPresence(ctx, wc.logger, wc.db, wc.websocketServer, userId)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"tranquility/data"
+	"tranquility/models"
+	"tranquility/services"
+
+	"github.com/coder/websocket"
+)
+
+// messageDatabase saves every message but fails to collect push notification receivers.
+type messageDatabase struct {
+	data.IDatabase
+	created int
+}
+
+func (m *messageDatabase) GetChannelPermissions(ctx context.Context, channelId, userId int32) (models.Permission, error) {
+	return models.PermissionDefault, nil
+}
+
+func (m *messageDatabase) CreateMessage(ctx context.Context, message *models.Message, userId int32) (*models.Message, error) {
+	m.created++
+	return &models.Message{ID: int32(m.created), ChannelID: message.ChannelID, AuthorId: userId, Content: message.Content}, nil
+}
+
+func (m *messageDatabase) GetChannelMembers(ctx context.Context, channelId int32) (map[int32]bool, error) {
+	return map[int32]bool{2: true}, nil
+}
+
+func (m *messageDatabase) GetNotificationRecipients(ctx context.Context, userId, channelId int32) ([]models.PushNotificationInfo, error) {
+	return nil, errors.New("unable to collect receivers")
+}
+
+func TestHandleIncomingMessageIsSentWhenNotificationsFail(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	database := &messageDatabase{}
+	websocketServer := services.NewWebsocketServer(ctx, discardLogger{}, services.NewMemoryBroadcaster())
+	controller := NewWebsocketController(database, discardLogger{}, websocketServer, nil, nil, "test")
+
+	user := &models.AuthUser{ID: 1, Username: "sender"}
+	message := models.NewWebsocketMessage("message", &models.Message{ChannelID: 3, Content: "hello"})
+	output, receivers, err := controller.handleIncomingMessage(ctx, user, message)
+	if err != nil {
+		t.Fatalf("expected the saved message to be sent without push notifications, got %v", err)
+	}
+	if created, ok := output.Data.(*models.Message); !ok || created.ID != 1 {
+		t.Fatalf("expected the created message to be returned, got %+v", output.Data)
+	}
+	if !receivers[1] || !receivers[2] {
+		t.Errorf("expected the sender and channel members to receive the message, got %v", receivers)
+	}
+	if database.created != 1 {
+		t.Errorf("expected the message to be created once, got %d", database.created)
+	}
+}
+
+// connectionDatabase lets any ticket connect as the same user.
+type connectionDatabase struct {
+	data.IDatabase
+}
+
+func (c *connectionDatabase) WebsocketLogin(ctx context.Context, ticket string) (*models.AuthUser, error) {
+	return &models.AuthUser{ID: 1, Username: "user"}, nil
+}
+
+func (c *connectionDatabase) UpdatePresenceConnections(ctx context.Context, serverId string, userId int32, delta int32) (bool, error) {
+	return false, nil
+}
+
+func TestWebsocketRejectsUnsupportedEvents(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	websocketServer := services.NewWebsocketServer(ctx, discardLogger{}, services.NewMemoryBroadcaster())
+	go websocketServer.Run()
+	controller := NewWebsocketController(&connectionDatabase{}, discardLogger{}, websocketServer, nil, nil, "test")
+	server := httptest.NewServer(http.HandlerFunc(controller.Websocket))
+	defer server.Close()
+
+	c, _, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(server.URL, "http")+"?ticket=ticket", nil)
+	if err != nil {
+		t.Fatalf("unable to connect: %v", err)
+	}
+	defer c.CloseNow()
+
+	// Neither has a handler once the connection is authenticated, so both are rejected and the connection stays open.
+	for _, eventType := range []string{"channel", "authenticate"} {
+		request, _ := json.Marshal(map[string]any{"type": eventType, "nonce": eventType, "data": map[string]any{}})
+		if err := c.Write(ctx, websocket.MessageText, request); err != nil {
+			t.Fatalf("unable to send %s: %v", eventType, err)
+		}
+
+		var reply struct {
+			Type string                `json:"type"`
+			Data models.WebsocketError `json:"data"`
+		}
+		for reply.Type != "error" {
+			_, frame, err := c.Read(ctx)
+			if err != nil {
+				t.Fatalf("expected an error reply to %s, the connection was closed: %v", eventType, err)
+			}
+			if err := json.Unmarshal(frame, &reply); err != nil {
+				t.Fatalf("unable to read reply: %v", err)
+			}
+		}
+		if reply.Data.Code != models.WebsocketErrorValidation || reply.Data.Nonce != eventType {
+			t.Errorf("expected a validation error for %s, got %+v", eventType, reply.Data)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"tranquility/models"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type auditLogRepo struct {
+	db *sqlx.DB
+}
+
+func (a *auditLogRepo) CreateAuditLogEntry(ctx context.Context, entry *models.AuditLogEntry) error {
+	details := "{}"
+	if len(entry.Details) > 0 {
+		details = string(entry.Details)
+	}
+
+	_, err := a.db.ExecContext(
+		ctx,
+		`INSERT INTO audit_log (guild_id, user_id, action, target_id, details) VALUES ($1, $2, $3, $4, $5::jsonb)`,
+		entry.GuildId,
+		entry.UserId,
+		entry.Action,
+		entry.TargetId,
+		details,
+	)
+	if err != nil {
+		return fmt.Errorf("an error occurred while writing %s to the audit log of guild %d: %v", entry.Action, entry.GuildId, err)
+	}
+	return nil
+}
+
+// GetAuditLog returns the newest entries of the guild first.
+// Callers are expected to verify the user is allowed to see the audit log.
+func (a *auditLogRepo) GetAuditLog(ctx context.Context, guildId int32, query *models.AuditLogQuery) (*models.AuditLogPage, error) {
+	output := &models.AuditLogPage{Entries: make([]models.AuditLogEntry, 0, query.Limit)}
+
+	// One extra entry is requested to know if there is another page.
+	rows, err := a.db.QueryxContext(
+		ctx,
+		`SELECT
+			al.id,
+			al.guild_id,
+			coalesce(al.user_id, 0) AS user_id,
+			coalesce(a.username, '') AS username,
+			al.action,
+			al.target_id,
+			al.details,
+			al.created_date
+		FROM audit_log al
+		LEFT JOIN auth a ON a.id = al.user_id
+		WHERE al.guild_id = $1
+		AND ($2 = 0 OR al.id < $2)
+		AND ($3 = 0 OR al.user_id = $3)
+		AND ($4 = '' OR al.action = $4)
+		ORDER BY al.id DESC
+		LIMIT $5`,
+		guildId,
+		query.Before,
+		query.UserId,
+		query.Action,
+		query.Limit+1,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("an error occurred while collecting the audit log of guild %d: %v", guildId, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entry models.AuditLogEntry
+		if err := rows.StructScan(&entry); err != nil {
+			return nil, err
+		}
+		output.Entries = append(output.Entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(output.Entries) > int(query.Limit) {
+		output.Entries = output.Entries[:query.Limit]
+		output.HasMore = true
+	}
+	return output, nil
+}
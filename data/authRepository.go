@@ -30,7 +30,6 @@ func (a *authRepo) Login(ctx context.Context, user *models.AuthUser) (*models.Au
 			a.username,
 			a.password,
 			a.refresh_token,
-			a.websocket_token,
 			a.user_handle,
 			at.file_name as avatar_url
 		FROM auth a
@@ -108,18 +107,17 @@ func (a *authRepo) RefreshToken(ctx context.Context, user *models.AuthUser) (*mo
 		ctx,
 		`WITH updated_auth AS (
 			UPDATE auth
-				SET refresh_token = md5(random()::text), websocket_token = md5(random()::text),
+				SET refresh_token = md5(random()::text),
 				updated_date = NOW() AT TIME ZONE 'utc'
 			WHERE id = $1
 				AND refresh_token = $2
-			RETURNING id, username, email, refresh_token, websocket_token, updated_date, user_handle
+			RETURNING id, username, email, refresh_token, updated_date, user_handle
 		)
 		SELECT
 			ur.id,
 			ur.username,
 			ur.email,
 			ur.refresh_token,
-			ur.websocket_token,
 			ur.updated_date,
 			ur.user_handle,
 			at.file_name as avatar_url
@@ -133,15 +131,65 @@ func (a *authRepo) RefreshToken(ctx context.Context, user *models.AuthUser) (*mo
 	return &output, err
 }
 
-func (a *authRepo) WebsocketLogin(ctx context.Context, userId int32, websocketToken string) (*models.AuthUser, error) {
+// CreateWebsocketTicket mints a single use ticket that is valid for models.WebsocketTicketLifetime seconds.
+func (a *authRepo) CreateWebsocketTicket(ctx context.Context, userId int32) (*models.WebsocketTicket, error) {
+	ticket, err := services.GenerateWebsocketTicket()
+	if err != nil {
+		return nil, fmt.Errorf("an error occurred while generating websocket ticket: %v", err)
+	}
+
+	tx, err := a.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("an error occurred while beginning transaction to create websocket ticket: %v", err)
+	}
+	defer tx.Rollback()
+
+	// Tickets that were never used are cleaned up as the user asks for new ones.
+	_, err = tx.ExecContext(
+		ctx,
+		`DELETE FROM websocket_ticket WHERE user_id = $1 AND expires_date <= NOW() AT TIME ZONE 'utc'`,
+		userId,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("an error occurred while removing expired websocket tickets for %d: %v", userId, err)
+	}
+
+	output := models.WebsocketTicket{Ticket: ticket}
+	err = tx.QueryRowxContext(
+		ctx,
+		`INSERT INTO websocket_ticket (user_id, ticket_hash, expires_date)
+		VALUES ($1, $2, (NOW() AT TIME ZONE 'utc') + $3 * INTERVAL '1 second')
+		RETURNING expires_date`,
+		userId,
+		services.HashWebsocketTicket(ticket),
+		models.WebsocketTicketLifetime,
+	).Scan(&output.ExpiresDate)
+	if err != nil {
+		return nil, fmt.Errorf("an error occurred while creating websocket ticket for %d: %v", userId, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("an error occurred while committing websocket ticket: %v", err)
+	}
+	return &output, nil
+}
+
+// WebsocketLogin consumes the ticket whether or not it has expired, so it can never be used twice.
+// sql.ErrNoRows is returned when the ticket does not exist or has expired.
+func (a *authRepo) WebsocketLogin(ctx context.Context, ticket string) (*models.AuthUser, error) {
 	var output models.AuthUser
 
 	err := a.db.QueryRowxContext(
 		ctx,
-		`UPDATE auth SET websocket_token = md5(random()::text) WHERE id = $1 AND websocket_token = $2
-		RETURNING id, username, refresh_token, websocket_token;`,
-		userId,
-		websocketToken,
+		`WITH consumed AS (
+			DELETE FROM websocket_ticket WHERE ticket_hash = $1
+			RETURNING user_id, expires_date
+		)
+		SELECT a.id, a.username
+		FROM consumed c
+		JOIN auth a ON a.id = c.user_id
+		WHERE c.expires_date > NOW() AT TIME ZONE 'utc'`,
+		services.HashWebsocketTicket(ticket),
 	).StructScan(&output)
 	if err != nil {
 		return nil, err
@@ -243,7 +291,7 @@ func (a *authRepo) getWebAuthnCredential(ctx context.Context, rawId, userHandle
 	var userCredentials models.AuthUser
 	err := a.db.QueryRowxContext(
 		ctx,
-		`SELECT a.id, a.username, a.refresh_token, a.websocket_token, a.user_handle
+		`SELECT a.id, a.username, a.refresh_token, a.user_handle
 		FROM auth a
 		JOIN webauthn_credentials wc on wc.user_id = a.id
 		WHERE wc.credential_id = $1 and a.user_handle = $2`,
@@ -23,7 +23,8 @@ type IDatabase interface {
 	Login(ctx context.Context, cred *models.AuthUser, ip string) (*models.AuthUser, error)
 	Register(ctx context.Context, user *models.AuthUser, ip string) (*models.AuthUser, error)
 	RefreshToken(ctx context.Context, user *models.AuthUser) (*models.AuthUser, error)
-	WebsocketLogin(ctx context.Context, userId int32, websocketToken string) (*models.AuthUser, error)
+	CreateWebsocketTicket(ctx context.Context, userId int32) (*models.WebsocketTicket, error)
+	WebsocketLogin(ctx context.Context, ticket string) (*models.AuthUser, error)
 	RegisterUserWebAuthn(ctx context.Context, claims *models.Claims) (*protocol.CredentialCreation, error)
 	CompleteWebauthnRegister(ctx context.Context, claims *models.Claims, r *http.Request) error
 	BeginWebAuthnLogin(ctx context.Context) (string, *protocol.CredentialAssertion, error)
@@ -41,21 +42,88 @@ type IDatabase interface {
 	GetGuildChannel(ctx context.Context, guildId, channelId, userId int32) (*models.Channel, error)
 	CreateGuild(ctx context.Context, guild *models.Guild, userId int32) (*models.Guild, error)
 	CreateChannel(ctx context.Context, channel *models.Channel, userId int32) (*models.Channel, error)
-	GetChannelMessages(ctx context.Context, userId, guildId, channelId, pageNumber int32) ([]models.Message, error)
+	UpdateGuild(ctx context.Context, guild *models.GuildUpdate) (*models.Guild, error)
+	DeleteGuild(ctx context.Context, guildId int32) error
+	UpdateChannel(ctx context.Context, channel *models.Channel) (*models.Channel, error)
+	DeleteChannel(ctx context.Context, guildId, channelId int32) error
+	ReorderChannels(ctx context.Context, order *models.ChannelOrder) error
+	GetChannelMessages(ctx context.Context, userId, guildId, channelId int32, query *models.MessageQuery) (*models.MessagePage, error)
+	SearchMessages(ctx context.Context, userId int32, search *models.MessageSearch) ([]models.MessageSearchResult, error)
+	GetMentionedMessages(ctx context.Context, userId int32, query *models.MessageQuery) (*models.MessagePage, error)
+	GetThreadParticipants(ctx context.Context, channelId, threadId, userId int32) ([]models.AuthUser, error)
 
 	// Member
-	GetMembers(ctx context.Context, guildID int32) ([]models.Member, error)
 	CreateMember(ctx context.Context, member *models.Member) (*models.Member, error)
 	GetChannelMembers(ctx context.Context, channelId int32) (map[int32]bool, error)
+	GetGuildMemberIds(ctx context.Context, guildId int32) (map[int32]bool, error)
+	GetJoinedGuildIds(ctx context.Context, userId int32) ([]int32, error)
+	RemoveMember(ctx context.Context, guildId, userId int32) error
+	BanMember(ctx context.Context, ban *models.Ban) (*models.Ban, error)
+	UnbanMember(ctx context.Context, guildId, userId int32) error
+	GetGuildBans(ctx context.Context, guildId int32) ([]models.Ban, error)
 	GetGuildMembers(ctx context.Context, guildId, userId int32) ([]models.AuthUser, error)
 
+	// Direct Message
+	GetDirectMessageChannels(ctx context.Context, userId int32) ([]models.Channel, error)
+	GetDirectMessageChannel(ctx context.Context, channelId, userId int32) (*models.Channel, error)
+	CreateDirectMessage(ctx context.Context, userId int32, request *models.DirectMessageRequest) (*models.Channel, bool, error)
+	AddDirectMessageMember(ctx context.Context, channelId, userId, memberId int32) error
+	LeaveDirectMessage(ctx context.Context, channelId, userId int32) error
+
+	// Invite
+	CreateInvite(ctx context.Context, invite *models.Invite) (*models.Invite, error)
+	GetGuildInvites(ctx context.Context, guildId int32) ([]models.Invite, error)
+	RevokeInvite(ctx context.Context, guildId int32, code string) error
+	RedeemInvite(ctx context.Context, code string, userId int32) (*models.Guild, error)
+
+	// Role
+	GetGuildRoles(ctx context.Context, guildId, userId int32) ([]models.Role, error)
+	GetMemberRoles(ctx context.Context, guildId, memberId int32) ([]models.Role, error)
+	CreateRole(ctx context.Context, role *models.Role) (*models.Role, error)
+	UpdateRole(ctx context.Context, role *models.RoleUpdate) (*models.Role, error)
+	DeleteRole(ctx context.Context, guildId, roleId int32) error
+	AddMemberRole(ctx context.Context, guildId, roleId, memberId int32) error
+	RemoveMemberRole(ctx context.Context, guildId, roleId, memberId int32) error
+	GetGuildPermissions(ctx context.Context, guildId, userId int32) (models.Permission, error)
+	GetChannelPermissions(ctx context.Context, channelId, userId int32) (models.Permission, error)
+
 	// Websocket
 	CreateMessage(context.Context, *models.Message, int32) (*models.Message, error)
+	UpdateMessage(ctx context.Context, message *models.Message, userId int32) (*models.Message, error)
+	DeleteMessage(ctx context.Context, channelId, messageId, userId int32) (*models.Message, error)
+	GetMessageHistory(ctx context.Context, channelId, messageId, userId int32) (*models.MessageHistory, error)
+
+	// Reaction
+	AddReaction(ctx context.Context, channelId, messageId, userId int32, emoji string) (bool, error)
+	RemoveReaction(ctx context.Context, channelId, messageId, userId int32, emoji string) (bool, error)
+
+	// Pin
+	PinMessage(ctx context.Context, channelId, messageId, userId int32) (*models.Pin, bool, error)
+	UnpinMessage(ctx context.Context, channelId, messageId int32) (*models.Pin, error)
+	GetChannelPins(ctx context.Context, channelId int32) ([]models.PinnedMessage, error)
+
+	// Read State
+	AckMessage(ctx context.Context, userId, channelId, messageId int32) (*models.ReadState, error)
+
+	// Presence
+	GetOwnPresence(ctx context.Context, userId int32) (*models.Presence, error)
+	GetPresence(ctx context.Context, userId int32) (*models.Presence, error)
+	UpdatePresence(ctx context.Context, presence *models.Presence) error
+	UpdatePresenceConnections(ctx context.Context, serverId string, userId int32, delta int32) (bool, error)
+	ClearPresenceConnections(ctx context.Context, serverId string) error
+	RefreshPresenceConnections(ctx context.Context, serverId string) ([]int32, error)
+	GetPresenceAudience(ctx context.Context, userId int32) (map[int32]bool, error)
+
+	// Audit Log
+	CreateAuditLogEntry(ctx context.Context, entry *models.AuditLogEntry) error
+	GetAuditLog(ctx context.Context, guildId int32, query *models.AuditLogQuery) (*models.AuditLogPage, error)
 
 	// Push Notifications
 	SaveUserPushInformation(ctx context.Context, registration *webpush.Subscription, userId int32) error
 	GetUserPushNotificationInfo(ctx context.Context, userId int32) (*models.PushNotificationInfo, error)
 	GetNotificationRecipients(ctx context.Context, userId, channelId int32) ([]models.PushNotificationInfo, error)
+	GetThreadNotificationRecipients(ctx context.Context, userId, threadId int32) ([]models.PushNotificationInfo, error)
+	GetMentionNotificationRecipients(ctx context.Context, userId, messageId int32) ([]models.PushNotificationInfo, error)
 	DeleteUserPushInformation(ctx context.Context, userId int32) error
 
 	// Profile
@@ -0,0 +1,292 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"tranquility/models"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+var (
+	ErrDirectMessageNotAllowed = errors.New("direct messages can only be sent to users that share a guild")
+	ErrDirectMessageFull       = errors.New("the group direct message has too many members")
+)
+
+type directMessageRepo struct {
+	db *sqlx.DB
+}
+
+func (d *directMessageRepo) GetDirectMessageChannels(ctx context.Context, userId int32) ([]models.Channel, error) {
+	output := make([]models.Channel, 0)
+	rows, err := d.db.QueryxContext(
+		ctx,
+		`SELECT c.id, coalesce(c.name, '') AS name, c.message_count, c.type, c.created_date, c.updated_date
+		FROM channel c
+		JOIN channel_member cm ON cm.channel_id = c.id
+		WHERE cm.user_id = $1
+		ORDER BY c.updated_date DESC`,
+		userId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var channel models.Channel
+		if err := rows.StructScan(&channel); err != nil {
+			return nil, err
+		}
+		output = append(output, channel)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range output {
+		members, err := d.getDirectMessageMembers(ctx, output[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		output[i].Members = members
+	}
+
+	return output, nil
+}
+
+// GetDirectMessageChannel returns sql.ErrNoRows when the user is not a participant of the channel.
+func (d *directMessageRepo) GetDirectMessageChannel(ctx context.Context, channelId, userId int32) (*models.Channel, error) {
+	var output models.Channel
+	err := d.db.QueryRowxContext(
+		ctx,
+		`SELECT c.id, coalesce(c.name, '') AS name, c.message_count, c.type, c.created_date, c.updated_date
+		FROM channel c
+		JOIN channel_member cm ON cm.channel_id = c.id
+		WHERE c.id = $1 AND cm.user_id = $2`,
+		channelId,
+		userId,
+	).StructScan(&output)
+	if err != nil {
+		return nil, err
+	}
+
+	members, err := d.getDirectMessageMembers(ctx, output.ID)
+	if err != nil {
+		return nil, err
+	}
+	output.Members = members
+
+	return &output, nil
+}
+
+func (d *directMessageRepo) getDirectMessageMembers(ctx context.Context, channelId int32) ([]models.AuthUser, error) {
+	output := make([]models.AuthUser, 0)
+	rows, err := d.db.QueryContext(
+		ctx,
+		`SELECT a.id, a.username
+		FROM channel_member cm
+		JOIN auth a ON a.id = cm.user_id
+		WHERE cm.channel_id = $1
+		ORDER BY cm.id`,
+		channelId,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("an error occurred while collecting members of direct message %d: %v", channelId, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var member models.AuthUser
+		if err := rows.Scan(&member.ID, &member.Username); err != nil {
+			return nil, err
+		}
+		output = append(output, member)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return output, nil
+}
+
+// CreateDirectMessage starts a conversation between the user and the recipients.
+// A direct message between two users is reused instead of creating another one, in which case created is false.
+func (d *directMessageRepo) CreateDirectMessage(ctx context.Context, userId int32, request *models.DirectMessageRequest) (channelId int32, created bool, err error) {
+	recipients := make([]int32, 0, len(request.UserIds))
+	for _, recipient := range request.UserIds {
+		if recipient != userId && !slices.Contains(recipients, recipient) {
+			recipients = append(recipients, recipient)
+		}
+	}
+	if len(recipients) == 0 {
+		return 0, false, ErrDirectMessageNotAllowed
+	}
+	if len(recipients)+1 > models.MaxGroupDirectMessageMembers {
+		return 0, false, ErrDirectMessageFull
+	}
+
+	if err := d.requireSharedGuild(ctx, userId, recipients); err != nil {
+		return 0, false, err
+	}
+
+	tx, err := d.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, false, fmt.Errorf("an error occurred while beginning transaction to create direct message: %v", err)
+	}
+	defer tx.Rollback()
+
+	channelType := models.ChannelTypeGroupDirectMessage
+	if len(recipients) == 1 {
+		channelType = models.ChannelTypeDirectMessage
+
+		// The pair is locked until the transaction ends so two requests can't both create the direct message.
+		if _, err := tx.ExecContext(
+			ctx,
+			`SELECT pg_advisory_xact_lock((least($1::BIGINT, $2::BIGINT) << 32) | greatest($1::BIGINT, $2::BIGINT))`,
+			userId,
+			recipients[0],
+		); err != nil {
+			return 0, false, fmt.Errorf("an error occurred while locking direct message between %d and %d: %v", userId, recipients[0], err)
+		}
+
+		err := tx.QueryRowxContext(
+			ctx,
+			`SELECT c.id
+			FROM channel c
+			JOIN channel_member sender ON sender.channel_id = c.id AND sender.user_id = $1
+			JOIN channel_member recipient ON recipient.channel_id = c.id AND recipient.user_id = $2
+			WHERE c.type = 'dm'`,
+			userId,
+			recipients[0],
+		).Scan(&channelId)
+		if err == nil {
+			return channelId, false, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return 0, false, fmt.Errorf("an error occurred while looking for an existing direct message: %v", err)
+		}
+	}
+
+	err = tx.QueryRowxContext(
+		ctx,
+		`INSERT INTO channel (name, type) VALUES (nullif($1, ''), $2) RETURNING id`,
+		request.Name,
+		channelType,
+	).Scan(&channelId)
+	if err != nil {
+		return 0, false, fmt.Errorf("an error occurred while creating direct message: %v", err)
+	}
+
+	if _, err := tx.ExecContext(
+		ctx,
+		`INSERT INTO channel_member (channel_id, user_id) SELECT $1, unnest($2::INTEGER[])`,
+		channelId,
+		pq.Array(append([]int32{userId}, recipients...)),
+	); err != nil {
+		return 0, false, fmt.Errorf("an error occurred while adding members to direct message %d: %v", channelId, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, false, fmt.Errorf("an error occurred while committing direct message: %v", err)
+	}
+	return channelId, true, nil
+}
+
+// requireSharedGuild stops users from messaging strangers they have no reason to know about.
+func (d *directMessageRepo) requireSharedGuild(ctx context.Context, userId int32, recipients []int32) error {
+	var shared int
+	err := d.db.QueryRowxContext(
+		ctx,
+		`SELECT count(DISTINCT other.user_id)
+		FROM member self
+		JOIN member other ON other.guild_id = self.guild_id
+		WHERE self.user_id = $1 AND other.user_id = ANY($2::INTEGER[])`,
+		userId,
+		pq.Array(recipients),
+	).Scan(&shared)
+	if err != nil {
+		return fmt.Errorf("an error occurred while checking shared guilds for %d: %v", userId, err)
+	}
+
+	if shared != len(recipients) {
+		return ErrDirectMessageNotAllowed
+	}
+	return nil
+}
+
+// AddDirectMessageMember adds a user to a group direct message the user is already a participant of.
+func (d *directMessageRepo) AddDirectMessageMember(ctx context.Context, channelId, userId, memberId int32) error {
+	channel, err := d.GetDirectMessageChannel(ctx, channelId, userId)
+	if err != nil {
+		return err
+	}
+	if channel.Type != models.ChannelTypeGroupDirectMessage {
+		return ErrUserLacksPermission
+	}
+	if len(channel.Members) >= models.MaxGroupDirectMessageMembers {
+		return ErrDirectMessageFull
+	}
+
+	if err := d.requireSharedGuild(ctx, userId, []int32{memberId}); err != nil {
+		return err
+	}
+
+	if _, err := d.db.ExecContext(
+		ctx,
+		`INSERT INTO channel_member (channel_id, user_id) VALUES ($1, $2)`,
+		channelId,
+		memberId,
+	); err != nil {
+		var pgErr *pq.Error
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return ErrDuplicateMember
+		}
+		return fmt.Errorf("an error occurred while adding %d to direct message %d: %v", memberId, channelId, err)
+	}
+	return nil
+}
+
+// LeaveDirectMessage removes the user from a group direct message. The channel is deleted once everyone has left.
+func (d *directMessageRepo) LeaveDirectMessage(ctx context.Context, channelId, userId int32) error {
+	channel, err := d.GetDirectMessageChannel(ctx, channelId, userId)
+	if err != nil {
+		return err
+	}
+	if channel.Type != models.ChannelTypeGroupDirectMessage {
+		return ErrUserLacksPermission
+	}
+
+	tx, err := d.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("an error occurred while beginning transaction to leave direct message: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(
+		ctx,
+		`DELETE FROM channel_member WHERE channel_id = $1 AND user_id = $2`,
+		channelId,
+		userId,
+	); err != nil {
+		return fmt.Errorf("an error occurred while removing %d from direct message %d: %v", userId, channelId, err)
+	}
+
+	if _, err := tx.ExecContext(
+		ctx,
+		`DELETE FROM channel c
+		WHERE c.id = $1 AND NOT EXISTS (SELECT 1 FROM channel_member cm WHERE cm.channel_id = c.id)`,
+		channelId,
+	); err != nil {
+		return fmt.Errorf("an error occurred while deleting empty direct message %d: %v", channelId, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("an error occurred while committing leaving direct message: %v", err)
+	}
+	return nil
+}
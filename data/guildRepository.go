@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 	"tranquility/models"
 
 	"github.com/jmoiron/sqlx"
@@ -51,10 +52,11 @@ func (g *guildRepo) GetGuildChannels(ctx context.Context, guildId, userId int32)
 	output := make([]models.Channel, 0)
 	rows, err := g.db.QueryContext(
 		ctx,
-		`SELECT c.id, c.name, c.message_count, c.guild_id, c.created_date, c.updated_date
+		`SELECT c.id, c.name, c.message_count, c.guild_id, c.position, c.created_date, c.updated_date
 		 FROM channel c
 		 JOIN member m on c.guild_id = m.guild_id
-		 WHERE m.user_id = $1 AND c.guild_id = $2`,
+		 WHERE m.user_id = $1 AND c.guild_id = $2
+		 ORDER BY c.position, c.id`,
 		&userId,
 		&guildId,
 	)
@@ -65,7 +67,7 @@ func (g *guildRepo) GetGuildChannels(ctx context.Context, guildId, userId int32)
 
 	for rows.Next() {
 		var channel models.Channel
-		if err := rows.Scan(&channel.ID, &channel.Name, &channel.MessageCount, &channel.GuildId, &channel.CreatedDate, &channel.UpdatedDate); err != nil {
+		if err := rows.Scan(&channel.ID, &channel.Name, &channel.MessageCount, &channel.GuildId, &channel.Position, &channel.CreatedDate, &channel.UpdatedDate); err != nil {
 			return nil, err
 		}
 		output = append(output, channel)
@@ -81,7 +83,7 @@ func (g *guildRepo) GetGuildChannel(ctx context.Context, guildId, channelId, use
 	var output models.Channel
 	err := g.db.QueryRowxContext(
 		ctx,
-		`SELECT c.id, c.name, c.message_count, c.guild_id, c.created_date, c.updated_date
+		`SELECT c.id, c.name, c.message_count, c.guild_id, c.position, c.created_date, c.updated_date
 		 FROM channel c
 		 JOIN member m on c.guild_id = m.guild_id
 		 WHERE c.id = $1 AND m.user_id = $2 AND c.guild_id = $3`,
@@ -170,9 +172,10 @@ func (g *guildRepo) CreateChannel(ctx context.Context, channel *models.Channel,
 	var output models.Channel
 	err := g.db.QueryRowxContext(
 		ctx,
-		`INSERT INTO channel (name, guild_id) SELECT $1, $2
+		`INSERT INTO channel (name, guild_id, position)
+		 SELECT $1, $2, (SELECT coalesce(max(position) + 1, 0) FROM channel WHERE guild_id = $2)
 		 WHERE EXISTS (SELECT 1 FROM member WHERE guild_id = $2 AND user_id = $3)
-         RETURNING id, name, message_count, guild_id, created_date, updated_date;`,
+         RETURNING id, name, message_count, guild_id, position, created_date, updated_date;`,
 		channel.Name,
 		channel.GuildId,
 		userId,
@@ -186,3 +189,120 @@ func (g *guildRepo) CreateChannel(ctx context.Context, channel *models.Channel,
 
 	return &output, nil
 }
+
+func (g *guildRepo) UpdateGuild(ctx context.Context, guild *models.GuildUpdate) (*models.Guild, error) {
+	var output models.Guild
+	err := g.db.QueryRowxContext(
+		ctx,
+		`UPDATE guild
+		 SET name = coalesce(nullif($1, ''), name), description = coalesce($2, description),
+		 	updated_date = NOW() AT TIME ZONE 'utc'
+		 WHERE id = $3
+		 RETURNING id, name, description, owner_id, created_date, updated_date;`,
+		guild.Name,
+		guild.Description,
+		guild.ID,
+	).StructScan(&output)
+	if err != nil {
+		return nil, err
+	}
+
+	return &output, nil
+}
+
+// DeleteGuild removes the guild along with its channels, their messages and the guild's audit log.
+// Tombstones are only kept for moderators of a guild that still exists, so nothing of the guild is kept.
+func (g *guildRepo) DeleteGuild(ctx context.Context, guildId int32) error {
+	result, err := g.db.ExecContext(ctx, `DELETE FROM guild WHERE id = $1`, guildId)
+	if err != nil {
+		return fmt.Errorf("an error occurred while deleting guild %d: %v", guildId, err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("an error occurred while getting the number of guilds deleted: %v", err)
+	}
+	if affected != 1 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (g *guildRepo) UpdateChannel(ctx context.Context, channel *models.Channel) (*models.Channel, error) {
+	var output models.Channel
+	err := g.db.QueryRowxContext(
+		ctx,
+		`UPDATE channel
+		 SET name = coalesce(nullif($1, ''), name), updated_date = NOW() AT TIME ZONE 'utc'
+		 WHERE id = $2 AND guild_id = $3
+		 RETURNING id, name, message_count, guild_id, position, created_date, updated_date;`,
+		channel.Name,
+		channel.ID,
+		channel.GuildId,
+	).StructScan(&output)
+	if err != nil {
+		return nil, err
+	}
+
+	return &output, nil
+}
+
+// DeleteChannel removes the channel along with its messages, including the tombstones of deleted ones.
+// The channel being deleted is recorded in the guild's audit log, which is kept.
+func (g *guildRepo) DeleteChannel(ctx context.Context, guildId, channelId int32) error {
+	result, err := g.db.ExecContext(
+		ctx,
+		`DELETE FROM channel WHERE id = $1 AND guild_id = $2`,
+		channelId,
+		guildId,
+	)
+	if err != nil {
+		return fmt.Errorf("an error occurred while deleting channel %d: %v", channelId, err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("an error occurred while getting the number of channels deleted: %v", err)
+	}
+	if affected != 1 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ReorderChannels moves every provided channel to its new position.
+// Nothing is changed if any of the channels don't belong to the guild.
+func (g *guildRepo) ReorderChannels(ctx context.Context, order *models.ChannelOrder) error {
+	tx, err := g.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("an error occurred while beginning transaction to reorder channels: %v", err)
+	}
+	defer tx.Rollback()
+
+	for _, channel := range order.Channels {
+		result, err := tx.ExecContext(
+			ctx,
+			`UPDATE channel SET position = $1, updated_date = NOW() AT TIME ZONE 'utc'
+			 WHERE id = $2 AND guild_id = $3`,
+			channel.Position,
+			channel.ID,
+			order.GuildId,
+		)
+		if err != nil {
+			return fmt.Errorf("an error occurred while moving channel %d: %v", channel.ID, err)
+		}
+
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("an error occurred while getting the number of channels moved: %v", err)
+		}
+		if affected != 1 {
+			return sql.ErrNoRows
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("an error occurred while committing channel order: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"tranquility/models"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+var (
+	ErrInviteNotFound = errors.New("the invite is invalid or has expired")
+)
+
+type inviteRepo struct {
+	db *sqlx.DB
+}
+
+func (i *inviteRepo) CreateInvite(ctx context.Context, invite *models.Invite) (*models.Invite, error) {
+	var output models.Invite
+	err := i.db.QueryRowxContext(
+		ctx,
+		`INSERT INTO invite (code, guild_id, created_by, max_uses, expires_date)
+		VALUES ($1, $2, $3, $4, CASE WHEN $5 > 0 THEN (NOW() AT TIME ZONE 'utc') + $5 * INTERVAL '1 second' END)
+		RETURNING id, code, guild_id, created_by, max_uses, uses, expires_date, revoked, created_date, updated_date`,
+		invite.Code,
+		invite.GuildId,
+		invite.CreatedBy,
+		invite.MaxUses,
+		invite.MaxAge,
+	).StructScan(&output)
+	if err != nil {
+		return nil, fmt.Errorf("an error occurred while creating invite for guild %d: %v", invite.GuildId, err)
+	}
+
+	return &output, nil
+}
+
+// GetGuildInvites returns the invites for the guild that can still be redeemed.
+func (i *inviteRepo) GetGuildInvites(ctx context.Context, guildId int32) ([]models.Invite, error) {
+	output := make([]models.Invite, 0)
+	rows, err := i.db.QueryxContext(
+		ctx,
+		`SELECT i.id, i.code, i.guild_id, i.created_by, a.username AS creator, i.max_uses, i.uses,
+			i.expires_date, i.revoked, i.created_date, i.updated_date
+		FROM invite i
+		JOIN auth a ON a.id = i.created_by
+		WHERE i.guild_id = $1 AND NOT i.revoked
+			AND (i.expires_date IS NULL OR i.expires_date > NOW() AT TIME ZONE 'utc')
+			AND (i.max_uses IS NULL OR i.uses < i.max_uses)
+		ORDER BY i.created_date DESC`,
+		guildId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var invite models.Invite
+		if err := rows.StructScan(&invite); err != nil {
+			return nil, err
+		}
+		output = append(output, invite)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return output, nil
+}
+
+func (i *inviteRepo) RevokeInvite(ctx context.Context, guildId int32, code string) error {
+	result, err := i.db.ExecContext(
+		ctx,
+		`UPDATE invite SET revoked = TRUE, updated_date = NOW() AT TIME ZONE 'utc'
+		WHERE guild_id = $1 AND code = $2 AND NOT revoked`,
+		guildId,
+		code,
+	)
+	if err != nil {
+		return fmt.Errorf("an error occurred while revoking invite %s: %v", code, err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("an error occurred while getting the number of invites revoked: %v", err)
+	}
+	if affected != 1 {
+		return ErrInviteNotFound
+	}
+	return nil
+}
+
+// RedeemInvite adds the user to the invite's guild and returns the id of the guild that was joined.
+// The invite row is locked so two users can't both take the last use.
+func (i *inviteRepo) RedeemInvite(ctx context.Context, code string, userId int32) (int32, error) {
+	tx, err := i.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("an error occurred while beginning transaction to redeem invite: %v", err)
+	}
+	defer tx.Rollback()
+
+	var inviteId, guildId, createdBy int32
+	err = tx.QueryRowxContext(
+		ctx,
+		`SELECT id, guild_id, created_by
+		FROM invite
+		WHERE code = $1 AND NOT revoked
+			AND (expires_date IS NULL OR expires_date > NOW() AT TIME ZONE 'utc')
+			AND (max_uses IS NULL OR uses < max_uses)
+		FOR UPDATE`,
+		code,
+	).Scan(&inviteId, &guildId, &createdBy)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrInviteNotFound
+		}
+		return 0, fmt.Errorf("an error occurred while collecting invite %s: %v", code, err)
+	}
+
+	result, err := tx.ExecContext(
+		ctx,
+		`INSERT INTO member (user_id, guild_id, user_who_added)
+		SELECT $1, $2, $3
+		WHERE NOT EXISTS (
+			SELECT 1 FROM guild_ban b
+			WHERE b.guild_id = $2 AND b.user_id = $1
+			AND (b.expires_date IS NULL OR b.expires_date > NOW() AT TIME ZONE 'utc')
+		)`,
+		userId,
+		guildId,
+		createdBy,
+	)
+	if err != nil {
+		var pgErr *pq.Error
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return 0, ErrDuplicateMember
+		}
+		return 0, fmt.Errorf("an error occurred while adding %d to guild %d: %v", userId, guildId, err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("an error occurred while getting the number of members added: %v", err)
+	}
+	if affected != 1 {
+		return 0, ErrMemberBanned
+	}
+
+	if _, err := tx.ExecContext(
+		ctx,
+		`UPDATE invite SET uses = uses + 1, updated_date = NOW() AT TIME ZONE 'utc' WHERE id = $1`,
+		inviteId,
+	); err != nil {
+		return 0, fmt.Errorf("an error occurred while using invite %s: %v", code, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("an error occurred while committing invite redemption: %v", err)
+	}
+	return guildId, nil
+}
@@ -11,6 +11,11 @@ import (
 	"github.com/lib/pq"
 )
 
+var (
+	ErrMemberBanned     = errors.New("the user is banned from the guild")
+	ErrOwnerCannotLeave = errors.New("the owner can't leave the guild and has to delete it instead")
+)
+
 type memberRepo struct {
 	db *sqlx.DB
 }
@@ -41,66 +46,6 @@ func (m *memberRepo) addGuildMember(ctx context.Context, guildId, userId int32,
 	return nil
 }
 
-func (m *memberRepo) GetMembers(ctx context.Context) ([]models.Member, error) {
-	output := make([]models.Member, 0)
-	rows, err := m.db.QueryContext(
-		ctx,
-		`SELECT a.id as user_id, a.username
-		 FROM auth a;`,
-	)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var model models.Member
-		if err := rows.Scan(&model.ID, &model.Username); err != nil {
-			return nil, err
-		}
-
-		output = append(output, model)
-	}
-	if err := rows.Err(); err != nil {
-		return nil, err
-	}
-
-	return output, nil
-}
-
-func (m *memberRepo) GetNotAddedMembers(ctx context.Context, guildId int32) ([]models.Member, error) {
-	output := make([]models.Member, 0)
-	rows, err := m.db.QueryContext(
-		ctx,
-		`SELECT a.id, a.username
-		 FROM auth a
-		 WHERE NOT EXISTS (
-		 	SELECT 1
-			FROM member m
-			WHERE m.user_id = a.id AND m.guild_id = $1
-		 );`,
-		&guildId,
-	)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var model models.Member
-		if err := rows.Scan(&model.ID, &model.Username); err != nil {
-			return nil, err
-		}
-
-		output = append(output, model)
-	}
-	if err := rows.Err(); err != nil {
-		return nil, err
-	}
-
-	return output, nil
-}
-
 func (m *memberRepo) CreateMember(ctx context.Context, member *models.Member) (*models.Member, error) {
 	tx, err := m.db.BeginTx(ctx, nil)
 	if err != nil {
@@ -112,7 +57,12 @@ func (m *memberRepo) CreateMember(ctx context.Context, member *models.Member) (*
 	err = tx.QueryRowContext(
 		ctx,
 		`INSERT INTO member (user_id, guild_id, user_who_added)
-		 VALUES ($1, $2, $3)
+		 SELECT $1, $2, $3
+		 WHERE NOT EXISTS (
+		 	SELECT 1 FROM guild_ban b
+			WHERE b.guild_id = $2 AND b.user_id = $1
+			AND (b.expires_date IS NULL OR b.expires_date > NOW() AT TIME ZONE 'utc')
+		 )
 		 RETURNING id, user_id, guild_id, user_who_added, created_date, updated_date;`,
 		&member.UserId,
 		&member.GuildId,
@@ -122,6 +72,9 @@ func (m *memberRepo) CreateMember(ctx context.Context, member *models.Member) (*
 		&output.UserWhoAdded, &output.CreatedDate, &output.UpdatedDate,
 	)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrMemberBanned
+		}
 		var pgErr *pq.Error
 		if errors.As(err, &pgErr) {
 			if pgErr.Code == "23505" {
@@ -185,9 +138,7 @@ func (m *memberRepo) GetChannelMembers(ctx context.Context, channelId int32) (ma
 
 	rows, err := m.db.QueryContext(
 		ctx,
-		`SELECT m.user_id FROM member m
-		 JOIN channel c ON c.guild_id = m.guild_id
-		 WHERE c.id = $1`,
+		`SELECT user_id FROM channel_access WHERE channel_id = $1`,
 		&channelId,
 	)
 	if err != nil {
@@ -208,3 +159,202 @@ func (m *memberRepo) GetChannelMembers(ctx context.Context, channelId int32) (ma
 
 	return output, nil
 }
+
+// GetGuildMemberIds returns every member of the guild in the same format as GetChannelMembers.
+func (m *memberRepo) GetGuildMemberIds(ctx context.Context, guildId int32) (map[int32]bool, error) {
+	output := make(map[int32]bool)
+
+	rows, err := m.db.QueryContext(
+		ctx,
+		`SELECT user_id FROM member WHERE guild_id = $1`,
+		&guildId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var userId int32
+		if err := rows.Scan(&userId); err != nil {
+			return nil, err
+		}
+		output[userId] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return output, nil
+}
+
+// GetJoinedGuildIds returns the ids of the guilds the user is a member of, without loading the guilds themselves.
+func (m *memberRepo) GetJoinedGuildIds(ctx context.Context, userId int32) ([]int32, error) {
+	output := make([]int32, 0)
+
+	rows, err := m.db.QueryContext(
+		ctx,
+		`SELECT guild_id FROM member WHERE user_id = $1`,
+		userId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var guildId int32
+		if err := rows.Scan(&guildId); err != nil {
+			return nil, err
+		}
+		output = append(output, guildId)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return output, nil
+}
+
+// RemoveMember is used for both leaving and kicking. The guild owner can't be removed.
+func (m *memberRepo) RemoveMember(ctx context.Context, guildId, userId int32) error {
+	result, err := m.db.ExecContext(
+		ctx,
+		`DELETE FROM member m
+		 USING guild g
+		 WHERE g.id = m.guild_id AND m.guild_id = $1 AND m.user_id = $2 AND g.owner_id <> m.user_id`,
+		guildId,
+		userId,
+	)
+	if err != nil {
+		return fmt.Errorf("an error occurred while removing %d from guild %d: %v", userId, guildId, err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("an error occurred while getting the number of members removed: %v", err)
+	}
+	if affected == 1 {
+		return nil
+	}
+
+	// Nothing was removed, either the user isn't a member or they own the guild.
+	var isOwner bool
+	err = m.db.QueryRowxContext(ctx, `SELECT owner_id = $2 FROM guild WHERE id = $1`, guildId, userId).Scan(&isOwner)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("an error occurred while collecting guild %d to remove member: %v", guildId, err)
+	}
+	if isOwner {
+		return ErrOwnerCannotLeave
+	}
+	return ErrMemberNotFound
+}
+
+// BanMember removes the user from the guild and stops them from joining again until the ban expires.
+// Banning a user that is already banned replaces the reason and expiry of the existing ban.
+func (m *memberRepo) BanMember(ctx context.Context, ban *models.Ban) (*models.Ban, error) {
+	tx, err := m.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("an error occurred while beginning transaction to ban member: %v", err)
+	}
+	defer tx.Rollback()
+
+	var isOwner bool
+	err = tx.QueryRowxContext(
+		ctx,
+		`SELECT owner_id = $2 FROM guild WHERE id = $1`,
+		ban.GuildId,
+		ban.UserId,
+	).Scan(&isOwner)
+	if err != nil {
+		return nil, fmt.Errorf("an error occurred while collecting guild %d to ban member: %v", ban.GuildId, err)
+	}
+	if isOwner {
+		return nil, ErrUserLacksPermission
+	}
+
+	var output models.Ban
+	err = tx.QueryRowxContext(
+		ctx,
+		`INSERT INTO guild_ban (guild_id, user_id, banned_by, reason, expires_date)
+		 VALUES ($1, $2, $3, $4, CASE WHEN $5 > 0 THEN (NOW() AT TIME ZONE 'utc') + $5 * INTERVAL '1 second' END)
+		 ON CONFLICT (guild_id, user_id) DO UPDATE
+		 SET banned_by = EXCLUDED.banned_by, reason = EXCLUDED.reason, expires_date = EXCLUDED.expires_date,
+		 	updated_date = NOW() AT TIME ZONE 'utc'
+		 RETURNING id, guild_id, user_id, banned_by, reason, expires_date, created_date, updated_date`,
+		ban.GuildId,
+		ban.UserId,
+		ban.BannedBy,
+		ban.Reason,
+		ban.Duration,
+	).StructScan(&output)
+	if err != nil {
+		return nil, fmt.Errorf("an error occurred while banning %d from guild %d: %v", ban.UserId, ban.GuildId, err)
+	}
+
+	if _, err := tx.ExecContext(
+		ctx,
+		`DELETE FROM member WHERE guild_id = $1 AND user_id = $2`,
+		ban.GuildId,
+		ban.UserId,
+	); err != nil {
+		return nil, fmt.Errorf("an error occurred while removing banned member %d: %v", ban.UserId, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("an error occurred while committing ban: %v", err)
+	}
+	return &output, nil
+}
+
+func (m *memberRepo) UnbanMember(ctx context.Context, guildId, userId int32) error {
+	result, err := m.db.ExecContext(
+		ctx,
+		`DELETE FROM guild_ban WHERE guild_id = $1 AND user_id = $2`,
+		guildId,
+		userId,
+	)
+	if err != nil {
+		return fmt.Errorf("an error occurred while unbanning %d from guild %d: %v", userId, guildId, err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("an error occurred while getting the number of bans deleted: %v", err)
+	}
+	if affected != 1 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetGuildBans returns the bans that have not expired yet.
+func (m *memberRepo) GetGuildBans(ctx context.Context, guildId int32) ([]models.Ban, error) {
+	output := make([]models.Ban, 0)
+	rows, err := m.db.QueryxContext(
+		ctx,
+		`SELECT b.id, b.guild_id, b.user_id, a.username, b.banned_by, b.reason, b.expires_date, b.created_date, b.updated_date
+		 FROM guild_ban b
+		 JOIN auth a ON a.id = b.user_id
+		 WHERE b.guild_id = $1 AND (b.expires_date IS NULL OR b.expires_date > NOW() AT TIME ZONE 'utc')
+		 ORDER BY b.created_date DESC`,
+		guildId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var ban models.Ban
+		if err := rows.StructScan(&ban); err != nil {
+			return nil, err
+		}
+		output = append(output, ban)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return output, nil
+}
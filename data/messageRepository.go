@@ -5,65 +5,122 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"slices"
 	"tranquility/models"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+var (
+	ErrMessageNotFound = errors.New("the message was not found in the channel")
 )
 
 type messageRepo struct {
 	db *sqlx.DB
 }
 
-func (m *messageRepo) GetChannelMessages(ctx context.Context, userId, guildId, channelId, pageNumber int32) ([]models.Message, error) {
-	var output []models.Message = make([]models.Message, 0)
+// GetChannelMessages returns a page of messages anchored on the message ids in the query.
+// An extra message is requested in each direction to know if there are more messages past the page.
+func (m *messageRepo) GetChannelMessages(ctx context.Context, userId, guildId, channelId int32, query *models.MessageQuery) (*models.MessagePage, error) {
+	var page models.MessagePage
+	var err error
+
+	switch {
+	case query.After != 0:
+		page.Messages, page.HasMoreAfter, err = m.getMessagePage(ctx, userId, guildId, channelId, query.ThreadId, query.After, false, query.Limit)
+		if err != nil {
+			return nil, err
+		}
+		// The anchor itself counts as an older message.
+		boundary := query.After + 1
+		if len(page.Messages) > 0 {
+			boundary = page.Messages[0].ID
+		}
+		_, page.HasMoreBefore, err = m.getMessagePage(ctx, userId, guildId, channelId, query.ThreadId, boundary, true, 0)
+		if err != nil {
+			return nil, err
+		}
+	case query.Around != 0:
+		// The anchor is included with the older half so it's always part of the page.
+		older, hasMoreBefore, err := m.getMessagePage(ctx, userId, guildId, channelId, query.ThreadId, query.Around+1, true, query.Limit-query.Limit/2)
+		if err != nil {
+			return nil, err
+		}
+		newer, hasMoreAfter, err := m.getMessagePage(ctx, userId, guildId, channelId, query.ThreadId, query.Around, false, query.Limit/2)
+		if err != nil {
+			return nil, err
+		}
+		page.Messages, page.HasMoreBefore, page.HasMoreAfter = append(older, newer...), hasMoreBefore, hasMoreAfter
+	default:
+		page.Messages, page.HasMoreBefore, err = m.getMessagePage(ctx, userId, guildId, channelId, query.ThreadId, query.Before, true, query.Limit)
+		if err != nil {
+			return nil, err
+		}
+		// Without an anchor the page already ends with the newest message.
+		if query.Before != 0 {
+			boundary := query.Before - 1
+			if len(page.Messages) > 0 {
+				boundary = page.Messages[len(page.Messages)-1].ID
+			}
+			_, page.HasMoreAfter, err = m.getMessagePage(ctx, userId, guildId, channelId, query.ThreadId, boundary, false, 0)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &page, nil
+}
+
+// getMessagePage collects up to limit messages older or newer than the anchor, sorted from oldest to newest.
+// An anchor of 0 starts from the newest message and a thread id of 0 only collects messages outside of threads.
+// A limit of 0 only checks if there are any messages past the anchor.
+func (m *messageRepo) getMessagePage(ctx context.Context, userId, guildId, channelId, threadId, anchor int32, older bool, limit int32) ([]models.Message, bool, error) {
+	output := make([]models.Message, 0)
 
-	pageSize := int64(50)
-	offset := int64(pageNumber) * pageSize
+	comparison, order := "m.id > $4", "ASC"
+	if older {
+		comparison, order = "($4 = 0 OR m.id < $4)", "DESC"
+	}
 
 	rows, err := m.db.QueryContext(
 		ctx,
-		`SELECT
+		fmt.Sprintf(`SELECT
 			m.id,
 			m.channel_id,
-			m.author,
+			a.username AS author,
 			m.author_id,
 			m.content,
+			m.reply_to_id,
+			m.thread_id,
+			(SELECT count(*) FROM message t WHERE t.thread_id = m.id AND t.deleted_date IS NULL) AS thread_count,
+			EXISTS (SELECT 1 FROM channel_pin cp WHERE cp.message_id = m.id) AS pinned,
 			m.created_date,
 			m.updated_date,
-			coalesce(m.file_name, '') as author_avatar
-		FROM (
-			SELECT
-				m.id,
-				m.channel_id,
-				a.username AS author,
-				m.author_id,
-				m.content,
-				m.created_date,
-				m.updated_date,
-				at.file_name
-			FROM message m
-			JOIN auth a ON a.id = m.author_id
-			JOIN channel c ON m.channel_id = c.id
-			JOIN guild g ON c.guild_id = g.id
-			JOIN member mem ON mem.guild_id = g.id
-			LEFT JOIN profile_mapping pm ON a.id = pm.user_id
-			LEFT JOIN attachment at ON pm.attachment_id = at.id
-			WHERE g.id = $1
-			AND c.id = $2
-			AND mem.user_id = $3
-			ORDER BY m.id DESC
-			OFFSET $4
-			LIMIT $5
-		) AS m
-		ORDER BY created_date ASC;`,
+			coalesce(at.file_name, '') as author_avatar
+		FROM message m
+		JOIN auth a ON a.id = m.author_id
+		JOIN channel c ON m.channel_id = c.id
+		JOIN channel_access ca ON ca.channel_id = c.id AND ca.user_id = $3
+		LEFT JOIN profile_mapping pm ON a.id = pm.user_id
+		LEFT JOIN attachment at ON pm.attachment_id = at.id
+		WHERE coalesce(c.guild_id, 0) = $1
+		AND c.id = $2
+		AND coalesce(m.thread_id, 0) = $6
+		AND m.deleted_date IS NULL
+		AND %s
+		ORDER BY m.id %s
+		LIMIT $5;`, comparison, order),
 		guildId,
 		channelId,
 		userId,
-		offset,
-		pageSize,
+		anchor,
+		limit+1,
+		threadId,
 	)
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 	defer rows.Close()
 
@@ -75,19 +132,31 @@ func (m *messageRepo) GetChannelMessages(ctx context.Context, userId, guildId, c
 			&message.Author,
 			&message.AuthorId,
 			&message.Content,
+			&message.ReplyToId,
+			&message.ThreadId,
+			&message.ThreadCount,
+			&message.Pinned,
 			&message.CreatedDate,
 			&message.UpdatedDate,
 			&message.AuthorAvatar,
 		); err != nil {
-			return nil, err
+			return nil, false, err
 		}
 		output = append(output, message)
 	}
 	if err := rows.Err(); err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
-	return output, nil
+	hasMore := len(output) > int(limit)
+	if hasMore {
+		output = output[:limit]
+	}
+	if older {
+		slices.Reverse(output)
+	}
+
+	return output, hasMore, nil
 }
 
 func (m *messageRepo) CreateMessage(ctx context.Context, message *models.Message, userId int32) (*sqlx.Tx, *models.Message, error) {
@@ -101,39 +170,53 @@ func (m *messageRepo) CreateMessage(ctx context.Context, message *models.Message
 	err = tx.QueryRowxContext(
 		ctx,
 		`WITH im AS (
-			INSERT INTO message (author_id, channel_id, content)
-			SELECT $1, $2, $3
+			INSERT INTO message (author_id, channel_id, content, reply_to_id, thread_id)
+			SELECT $1, $2, $3, $4, $5
 			WHERE EXISTS (
-				SELECT 1 FROM channel c
-				join member m on c.guild_id = m.guild_id
-				where m.user_id = $1 and c.id = $2
-			)
-			RETURNING id, channel_id, author_id, content, created_date, updated_date
+				SELECT 1 FROM channel_access ca
+				WHERE ca.user_id = $1 AND ca.channel_id = $2
 			)
+			AND ($4::INTEGER IS NULL OR EXISTS (
+				SELECT 1 FROM message r WHERE r.id = $4 AND r.channel_id = $2 AND r.deleted_date IS NULL
+			))
+			AND ($5::INTEGER IS NULL OR EXISTS (
+				SELECT 1 FROM message t WHERE t.id = $5 AND t.channel_id = $2 AND t.thread_id IS NULL AND t.deleted_date IS NULL
+			))
+			RETURNING id, channel_id, author_id, content, reply_to_id, thread_id, created_date, updated_date
+			),
+		uc AS (
+			UPDATE channel SET message_count = message_count + 1
+			WHERE id IN (SELECT channel_id FROM im)
+		)
         SELECT
             im.id,
             im.channel_id,
-			c.name as channel_name,
-			g.id as guild_id,
-			g.name as guild_name,
+			coalesce(c.name, '') as channel_name,
+			coalesce(g.id, 0) as guild_id,
+			coalesce(g.name, '') as guild_name,
             a.username as author,
 			coalesce(at.file_name, '') as author_avatar,
             im.author_id,
             im.content,
+            im.reply_to_id,
+            im.thread_id,
             im.created_date,
             im.updated_date
         FROM im
         JOIN auth a ON im.author_id = a.id
 		JOIN channel c on c.id = im.channel_id
-		JOIN guild g on c.guild_id = g.id
+		LEFT JOIN guild g on c.guild_id = g.id
 		LEFT JOIN profile_mapping pm on a.id = pm.user_id
 		LEFT JOIN attachment at on pm.attachment_id = at.id`,
 		userId,
 		message.ChannelID,
 		message.Content,
+		message.ReplyToId,
+		message.ThreadId,
 	).StructScan(&output)
 
 	if err != nil {
+		tx.Rollback()
 		return nil, nil, err
 	}
 
@@ -194,3 +277,605 @@ func (m *messageRepo) GetMessageAttachment(ctx context.Context, messageID int32)
 
 	return attachments, nil
 }
+
+// GetMessage collects the message without checking if the user is able to see it. Deleted messages are not found.
+// Callers are expected to verify permissions before returning it to the user.
+func (m *messageRepo) GetMessage(ctx context.Context, channelId, messageId int32) (*models.Message, error) {
+	var output models.Message
+	err := m.db.QueryRowxContext(
+		ctx,
+		`SELECT
+			m.id,
+			m.channel_id,
+			coalesce(c.name, '') as channel_name,
+			coalesce(g.id, 0) as guild_id,
+			coalesce(g.name, '') as guild_name,
+			a.username as author,
+			m.author_id,
+			m.content,
+			m.created_date,
+			m.updated_date
+		FROM message m
+		JOIN auth a ON m.author_id = a.id
+		JOIN channel c ON c.id = m.channel_id
+		LEFT JOIN guild g ON c.guild_id = g.id
+		WHERE m.id = $1 AND m.channel_id = $2 AND m.deleted_date IS NULL`,
+		messageId,
+		channelId,
+	).StructScan(&output)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrMessageNotFound
+		}
+		return nil, fmt.Errorf("an error occurred while collecting message %d: %v", messageId, err)
+	}
+
+	return &output, nil
+}
+
+func (m *messageRepo) UpdateMessage(ctx context.Context, tx *sqlx.Tx, message *models.Message, userId int32) (*models.Message, error) {
+	var output models.Message
+
+	// The previous content is kept as a revision before it is replaced.
+	result, err := tx.ExecContext(
+		ctx,
+		`INSERT INTO message_revision (message_id, content, created_date)
+		SELECT id, content, updated_date
+		FROM message
+		WHERE id = $1 AND channel_id = $2 AND author_id = $3 AND deleted_date IS NULL AND content IS DISTINCT FROM $4`,
+		message.ID,
+		message.ChannelID,
+		userId,
+		message.Content,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("an error occurred while saving revision of message %d: %v", message.ID, err)
+	}
+	revised, err := result.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("an error occurred while getting the number of revisions saved: %v", err)
+	}
+
+	err = tx.QueryRowxContext(
+		ctx,
+		`WITH um AS (
+			UPDATE message
+			SET content = $1, updated_date = CASE WHEN $5 THEN NOW() AT TIME ZONE 'utc' ELSE updated_date END
+			WHERE id = $2 AND channel_id = $3 AND author_id = $4 AND deleted_date IS NULL
+			RETURNING id, channel_id, author_id, content, reply_to_id, thread_id, created_date, updated_date
+		)
+		SELECT
+			um.id,
+			um.channel_id,
+			coalesce(c.name, '') as channel_name,
+			coalesce(g.id, 0) as guild_id,
+			coalesce(g.name, '') as guild_name,
+			a.username as author,
+			coalesce(at.file_name, '') as author_avatar,
+			um.author_id,
+			um.content,
+			um.reply_to_id,
+			um.thread_id,
+			um.created_date,
+			um.updated_date
+		FROM um
+		JOIN auth a ON um.author_id = a.id
+		JOIN channel c on c.id = um.channel_id
+		LEFT JOIN guild g on c.guild_id = g.id
+		LEFT JOIN profile_mapping pm on a.id = pm.user_id
+		LEFT JOIN attachment at on pm.attachment_id = at.id`,
+		message.Content,
+		message.ID,
+		message.ChannelID,
+		userId,
+		revised == 1,
+	).StructScan(&output)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrMessageNotFound
+		}
+		return nil, fmt.Errorf("an error occurred while updating message %d: %v", message.ID, err)
+	}
+
+	return &output, nil
+}
+
+// DeleteMessage leaves the message and any replies in its thread as tombstones that are hidden from everything
+// except their history.
+func (m *messageRepo) DeleteMessage(ctx context.Context, channelId, messageId, userId int32) error {
+	tx, err := m.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("an error occurred while beginning transaction to delete message: %v", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(
+		ctx,
+		`UPDATE message SET deleted_date = NOW() AT TIME ZONE 'utc', deleted_by = $3
+		WHERE id = $1 AND channel_id = $2 AND deleted_date IS NULL`,
+		messageId,
+		channelId,
+		userId,
+	)
+	if err != nil {
+		return fmt.Errorf("an error occurred while deleting message %d: %v", messageId, err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("an error occurred while getting the number of messages deleted: %v", err)
+	}
+	if affected != 1 {
+		return ErrMessageNotFound
+	}
+
+	// Replies can't be reached once the thread is gone, so they are deleted with it and stop counting as unread.
+	result, err = tx.ExecContext(
+		ctx,
+		`UPDATE message SET deleted_date = NOW() AT TIME ZONE 'utc', deleted_by = $2
+		WHERE thread_id = $1 AND deleted_date IS NULL`,
+		messageId,
+		userId,
+	)
+	if err != nil {
+		return fmt.Errorf("an error occurred while deleting the thread of message %d: %v", messageId, err)
+	}
+
+	replies, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("an error occurred while getting the number of thread replies deleted: %v", err)
+	}
+
+	if _, err := tx.ExecContext(
+		ctx,
+		`DELETE FROM channel_pin WHERE message_id IN (SELECT id FROM message WHERE id = $1 OR thread_id = $1)`,
+		messageId,
+	); err != nil {
+		return fmt.Errorf("an error occurred while unpinning deleted message %d: %v", messageId, err)
+	}
+
+	if _, err := tx.ExecContext(
+		ctx,
+		`UPDATE channel SET message_count = greatest(message_count - $2, 0) WHERE id = $1`,
+		channelId,
+		affected+replies,
+	); err != nil {
+		return fmt.Errorf("an error occurred while counting messages in channel %d: %v", channelId, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("an error occurred while committing deleted message: %v", err)
+	}
+	return nil
+}
+
+// SearchMessages only returns messages from channels the user has access to, ordered by how well they match the query.
+func (m *messageRepo) SearchMessages(ctx context.Context, userId int32, search *models.MessageSearch) ([]models.MessageSearchResult, error) {
+	output := make([]models.MessageSearchResult, 0)
+	rows, err := m.db.QueryxContext(
+		ctx,
+		`WITH query AS (SELECT websearch_to_tsquery('english', $1) AS value)
+		SELECT
+			m.id,
+			m.channel_id,
+			coalesce(c.name, '') AS channel_name,
+			coalesce(g.id, 0) AS guild_id,
+			coalesce(g.name, '') AS guild_name,
+			a.username AS author,
+			m.author_id,
+			coalesce(at.file_name, '') AS author_avatar,
+			m.content,
+			m.reply_to_id,
+			m.thread_id,
+			m.created_date,
+			m.updated_date,
+			ts_headline(
+				'english',
+				replace(replace(replace(coalesce(m.content, ''), '&', '&amp;'), '<', '&lt;'), '>', '&gt;'),
+				query.value,
+				'StartSel=<mark>, StopSel=</mark>, MaxFragments=2'
+			) AS highlight,
+			ts_rank(m.search_vector, query.value) AS rank
+		FROM query, message m
+		JOIN auth a ON a.id = m.author_id
+		JOIN channel c ON c.id = m.channel_id
+		JOIN channel_access ca ON ca.channel_id = c.id AND ca.user_id = $2
+		LEFT JOIN guild g ON g.id = c.guild_id
+		LEFT JOIN profile_mapping pm ON a.id = pm.user_id
+		LEFT JOIN attachment at ON pm.attachment_id = at.id
+		WHERE m.search_vector @@ query.value
+		AND m.deleted_date IS NULL
+		AND ($3 = 0 OR c.guild_id = $3)
+		AND ($4 = 0 OR c.id = $4)
+		AND ($5 = 0 OR m.author_id = $5)
+		AND ($6::TIMESTAMPTZ IS NULL OR m.created_date < $6)
+		AND ($7::TIMESTAMPTZ IS NULL OR m.created_date > $7)
+		AND (NOT $8 OR EXISTS (SELECT 1 FROM attachment_mapping am WHERE am.post_id = m.id))
+		ORDER BY rank DESC, m.id DESC
+		LIMIT $9
+		OFFSET $10`,
+		search.Query,
+		userId,
+		search.GuildId,
+		search.ChannelId,
+		search.AuthorId,
+		search.Before,
+		search.After,
+		search.HasAttachment,
+		search.Limit,
+		search.Offset,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("an error occurred while searching messages: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var result models.MessageSearchResult
+		if err := rows.StructScan(&result); err != nil {
+			return nil, err
+		}
+		output = append(output, result)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return output, nil
+}
+
+// GetMessageReferences collects snippets of the messages being replied to, keyed by message id.
+func (m *messageRepo) GetMessageReferences(ctx context.Context, messageIds []int32) (map[int32]models.MessageReference, error) {
+	output := make(map[int32]models.MessageReference)
+	if len(messageIds) == 0 {
+		return output, nil
+	}
+
+	rows, err := m.db.QueryxContext(
+		ctx,
+		`SELECT m.id, m.author_id, a.username AS author, left(coalesce(m.content, ''), $2) AS content
+		FROM message m
+		JOIN auth a ON a.id = m.author_id
+		WHERE m.id = ANY($1::INTEGER[]) AND m.deleted_date IS NULL`,
+		pq.Array(messageIds),
+		models.MessageReferenceLength,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("an error occurred while collecting replied to messages: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var reference models.MessageReference
+		if err := rows.StructScan(&reference); err != nil {
+			return nil, err
+		}
+		output[reference.ID] = reference
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return output, nil
+}
+
+// AddThreadParticipant adds the user to the thread along with the author of the message that started it.
+func (m *messageRepo) AddThreadParticipant(ctx context.Context, tx *sqlx.Tx, threadId, userId int32) error {
+	if _, err := tx.ExecContext(
+		ctx,
+		`INSERT INTO thread_participant (thread_id, user_id)
+		SELECT DISTINCT $1::INTEGER, participant
+		FROM unnest(ARRAY[$2::INTEGER, (SELECT author_id FROM message WHERE id = $1)]) AS participant
+		WHERE participant IS NOT NULL
+		ON CONFLICT (thread_id, user_id) DO NOTHING`,
+		threadId,
+		userId,
+	); err != nil {
+		return fmt.Errorf("an error occurred while adding %d to thread %d: %v", userId, threadId, err)
+	}
+	return nil
+}
+
+// GetThreadParticipants returns sql.ErrNoRows when the user is unable to see the thread's channel.
+func (m *messageRepo) GetThreadParticipants(ctx context.Context, channelId, threadId, userId int32) ([]models.AuthUser, error) {
+	var hasAccess bool
+	err := m.db.QueryRowxContext(
+		ctx,
+		`SELECT EXISTS (
+			SELECT 1 FROM message t
+			JOIN channel_access ca ON ca.channel_id = t.channel_id AND ca.user_id = $3
+			WHERE t.id = $2 AND t.channel_id = $1
+		)`,
+		channelId,
+		threadId,
+		userId,
+	).Scan(&hasAccess)
+	if err != nil {
+		return nil, fmt.Errorf("an error occurred while checking access to thread %d: %v", threadId, err)
+	}
+	if !hasAccess {
+		return nil, sql.ErrNoRows
+	}
+
+	output := make([]models.AuthUser, 0)
+	rows, err := m.db.QueryContext(
+		ctx,
+		`SELECT a.id, a.username
+		FROM thread_participant tp
+		JOIN auth a ON a.id = tp.user_id
+		WHERE tp.thread_id = $1
+		ORDER BY tp.id`,
+		threadId,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("an error occurred while collecting participants of thread %d: %v", threadId, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var participant models.AuthUser
+		if err := rows.Scan(&participant.ID, &participant.Username); err != nil {
+			return nil, err
+		}
+		output = append(output, participant)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return output, nil
+}
+
+// SaveMessageMentions replaces the mentions of a message. Users that can't see the channel and roles from other guilds
+// are dropped, so the returned mentions are the ones that were actually stored.
+func (m *messageRepo) SaveMessageMentions(ctx context.Context, tx *sqlx.Tx, channelId, messageId int32, mentions *models.MessageMentions) (*models.MessageMentions, error) {
+	output := models.MessageMentions{Users: make([]int32, 0), Roles: make([]int32, 0), Everyone: mentions.Everyone}
+
+	if _, err := tx.ExecContext(
+		ctx,
+		`UPDATE message SET mention_everyone = $2 WHERE id = $1`,
+		messageId,
+		mentions.Everyone,
+	); err != nil {
+		return nil, fmt.Errorf("an error occurred while saving everyone mention of message %d: %v", messageId, err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM message_mention WHERE message_id = $1`, messageId); err != nil {
+		return nil, fmt.Errorf("an error occurred while removing previous mentions of message %d: %v", messageId, err)
+	}
+
+	if len(mentions.Users) > 0 {
+		if err := tx.SelectContext(
+			ctx,
+			&output.Users,
+			`INSERT INTO message_mention (message_id, user_id)
+			SELECT $1, ca.user_id
+			FROM channel_access ca
+			WHERE ca.channel_id = $2 AND ca.user_id = ANY($3::INTEGER[])
+			RETURNING user_id`,
+			messageId,
+			channelId,
+			pq.Array(mentions.Users),
+		); err != nil {
+			return nil, fmt.Errorf("an error occurred while saving user mentions of message %d: %v", messageId, err)
+		}
+	}
+
+	if len(mentions.Roles) > 0 {
+		if err := tx.SelectContext(
+			ctx,
+			&output.Roles,
+			`INSERT INTO message_mention (message_id, role_id)
+			SELECT $1, r.id
+			FROM role r
+			JOIN channel c ON c.guild_id = r.guild_id
+			WHERE c.id = $2 AND r.id = ANY($3::INTEGER[])
+			RETURNING role_id`,
+			messageId,
+			channelId,
+			pq.Array(mentions.Roles),
+		); err != nil {
+			return nil, fmt.Errorf("an error occurred while saving role mentions of message %d: %v", messageId, err)
+		}
+	}
+
+	return &output, nil
+}
+
+// GetMessageMentions collects the mentions of each message, keyed by message id.
+// Messages that don't mention anyone are left out.
+func (m *messageRepo) GetMessageMentions(ctx context.Context, messageIds []int32) (map[int32]*models.MessageMentions, error) {
+	output := make(map[int32]*models.MessageMentions)
+	if len(messageIds) == 0 {
+		return output, nil
+	}
+
+	rows, err := m.db.QueryContext(
+		ctx,
+		`SELECT
+			m.id,
+			m.mention_everyone,
+			coalesce(array_agg(mm.user_id ORDER BY mm.id) FILTER (WHERE mm.user_id IS NOT NULL), '{}') AS users,
+			coalesce(array_agg(mm.role_id ORDER BY mm.id) FILTER (WHERE mm.role_id IS NOT NULL), '{}') AS roles
+		FROM message m
+		LEFT JOIN message_mention mm ON mm.message_id = m.id
+		WHERE m.id = ANY($1::INTEGER[])
+		GROUP BY m.id
+		HAVING m.mention_everyone OR count(mm.id) > 0`,
+		pq.Array(messageIds),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("an error occurred while collecting message mentions: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var messageId int32
+		var users, roles pq.Int32Array
+		var mentions models.MessageMentions
+		if err := rows.Scan(&messageId, &mentions.Everyone, &users, &roles); err != nil {
+			return nil, err
+		}
+		mentions.Users, mentions.Roles = users, roles
+		output[messageId] = &mentions
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return output, nil
+}
+
+// GetMentionedMessages pages through the messages that mention the user directly, through one of their roles
+// or with @everyone, sorted from oldest to newest. Only messages from channels the user can still see are returned.
+func (m *messageRepo) GetMentionedMessages(ctx context.Context, userId int32, query *models.MessageQuery) (*models.MessagePage, error) {
+	var page models.MessagePage
+	var err error
+	page.Messages, page.HasMoreBefore, err = m.getMentionPage(ctx, userId, query.Before, true, query.Limit)
+	if err != nil {
+		return nil, err
+	}
+	if query.Before != 0 {
+		boundary := query.Before - 1
+		if len(page.Messages) > 0 {
+			boundary = page.Messages[len(page.Messages)-1].ID
+		}
+		_, page.HasMoreAfter, err = m.getMentionPage(ctx, userId, boundary, false, 0)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &page, nil
+}
+
+// getMentionPage works like getMessagePage for the messages that mention the user.
+func (m *messageRepo) getMentionPage(ctx context.Context, userId, anchor int32, older bool, limit int32) ([]models.Message, bool, error) {
+	comparison, order := "m.id > $2", "ASC"
+	if older {
+		comparison, order = "($2 = 0 OR m.id < $2)", "DESC"
+	}
+
+	output := make([]models.Message, 0)
+	rows, err := m.db.QueryxContext(
+		ctx,
+		fmt.Sprintf(`SELECT
+			m.id,
+			m.channel_id,
+			coalesce(c.name, '') AS channel_name,
+			coalesce(g.id, 0) AS guild_id,
+			coalesce(g.name, '') AS guild_name,
+			a.username AS author,
+			m.author_id,
+			coalesce(at.file_name, '') AS author_avatar,
+			m.content,
+			m.reply_to_id,
+			m.thread_id,
+			m.created_date,
+			m.updated_date
+		FROM message m
+		JOIN auth a ON a.id = m.author_id
+		JOIN channel c ON c.id = m.channel_id
+		JOIN channel_access ca ON ca.channel_id = c.id AND ca.user_id = $1
+		LEFT JOIN guild g ON g.id = c.guild_id
+		LEFT JOIN profile_mapping pm ON a.id = pm.user_id
+		LEFT JOIN attachment at ON pm.attachment_id = at.id
+		WHERE m.author_id != $1
+		AND m.deleted_date IS NULL
+		AND %s
+		AND (
+			m.mention_everyone
+			OR EXISTS (
+				SELECT 1 FROM message_mention mm
+				WHERE mm.message_id = m.id AND mm.user_id = $1
+			)
+			OR EXISTS (
+				SELECT 1 FROM message_mention mm
+				JOIN member_role mr ON mr.role_id = mm.role_id
+				JOIN member me ON me.id = mr.member_id
+				WHERE mm.message_id = m.id AND me.user_id = $1
+			)
+		)
+		ORDER BY m.id %s
+		LIMIT $3`, comparison, order),
+		userId,
+		anchor,
+		limit+1,
+	)
+	if err != nil {
+		return nil, false, fmt.Errorf("an error occurred while collecting mentions of %d: %v", userId, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var message models.Message
+		if err := rows.StructScan(&message); err != nil {
+			return nil, false, err
+		}
+		output = append(output, message)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, err
+	}
+
+	hasMore := len(output) > int(limit)
+	if hasMore {
+		output = output[:limit]
+	}
+	if older {
+		slices.Reverse(output)
+	}
+
+	return output, hasMore, nil
+}
+
+// GetMessageHistory collects the message, including deleted messages, along with its revisions from oldest to newest.
+// Callers are expected to verify the user is allowed to see the history.
+func (m *messageRepo) GetMessageHistory(ctx context.Context, channelId, messageId int32) (*models.MessageHistory, error) {
+	output := models.MessageHistory{Revisions: make([]models.MessageRevision, 0)}
+	err := m.db.QueryRowxContext(
+		ctx,
+		`SELECT
+			m.id,
+			m.channel_id,
+			coalesce(c.name, '') as channel_name,
+			coalesce(g.id, 0) as guild_id,
+			coalesce(g.name, '') as guild_name,
+			a.username as author,
+			m.author_id,
+			coalesce(m.content, '') as content,
+			m.reply_to_id,
+			m.thread_id,
+			m.created_date,
+			m.updated_date,
+			m.deleted_date,
+			m.deleted_by
+		FROM message m
+		JOIN auth a ON m.author_id = a.id
+		JOIN channel c ON c.id = m.channel_id
+		LEFT JOIN guild g ON c.guild_id = g.id
+		WHERE m.id = $1 AND m.channel_id = $2`,
+		messageId,
+		channelId,
+	).StructScan(&output.Message)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrMessageNotFound
+		}
+		return nil, fmt.Errorf("an error occurred while collecting history of message %d: %v", messageId, err)
+	}
+
+	if err := m.db.SelectContext(
+		ctx,
+		&output.Revisions,
+		`SELECT id, message_id, coalesce(content, '') AS content, created_date
+		FROM message_revision
+		WHERE message_id = $1
+		ORDER BY id`,
+		messageId,
+	); err != nil {
+		return nil, fmt.Errorf("an error occurred while collecting revisions of message %d: %v", messageId, err)
+	}
+
+	return &output, nil
+}
@@ -72,9 +72,8 @@ func (n *notificationRepo) GetNotificationRecipients(ctx context.Context, userId
 		ctx,
 		`SELECT n.user_id, n.endpoint, n.p256dh, n.auth
 		FROM notification n
-		JOIN member m on m.user_id = n.user_id
-		JOIN channel c on c.guild_id = m.guild_id
-		WHERE c.id = $1 and n.user_id != $2`,
+		JOIN channel_access ca on ca.user_id = n.user_id
+		WHERE ca.channel_id = $1 and n.user_id != $2`,
 		channelId,
 		userId,
 	)
@@ -99,6 +98,91 @@ func (n *notificationRepo) GetNotificationRecipients(ctx context.Context, userId
 	return output, nil
 }
 
+// GetThreadNotificationRecipients only returns participants that are still able to see the thread's channel.
+func (n *notificationRepo) GetThreadNotificationRecipients(ctx context.Context, userId, threadId int32) ([]models.PushNotificationInfo, error) {
+	var output []models.PushNotificationInfo
+
+	rows, err := n.db.QueryxContext(
+		ctx,
+		`SELECT n.user_id, n.endpoint, n.p256dh, n.auth
+		FROM notification n
+		JOIN thread_participant tp on tp.user_id = n.user_id
+		JOIN message t on t.id = tp.thread_id
+		JOIN channel_access ca on ca.channel_id = t.channel_id and ca.user_id = n.user_id
+		WHERE tp.thread_id = $1 and n.user_id != $2`,
+		threadId,
+		userId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var info models.PushNotificationInfo
+		if err := rows.StructScan(&info); err != nil {
+			return nil, err
+		}
+
+		output = append(output, info)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return output, nil
+}
+
+// GetMentionNotificationRecipients returns the users mentioned in the message, directly, through a role or with @everyone,
+// that are still able to see its channel.
+func (n *notificationRepo) GetMentionNotificationRecipients(ctx context.Context, userId, messageId int32) ([]models.PushNotificationInfo, error) {
+	var output []models.PushNotificationInfo
+
+	rows, err := n.db.QueryxContext(
+		ctx,
+		`SELECT n.user_id, n.endpoint, n.p256dh, n.auth
+		FROM message m
+		JOIN channel_access ca on ca.channel_id = m.channel_id
+		JOIN notification n on n.user_id = ca.user_id
+		WHERE m.id = $1 and n.user_id != $2
+		and (
+			m.mention_everyone
+			or exists (
+				SELECT 1 FROM message_mention mm
+				WHERE mm.message_id = m.id and mm.user_id = ca.user_id
+			)
+			or exists (
+				SELECT 1 FROM message_mention mm
+				JOIN member_role mr on mr.role_id = mm.role_id
+				JOIN member me on me.id = mr.member_id
+				WHERE mm.message_id = m.id and me.user_id = ca.user_id
+			)
+		)`,
+		messageId,
+		userId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var info models.PushNotificationInfo
+		if err := rows.StructScan(&info); err != nil {
+			return nil, err
+		}
+
+		output = append(output, info)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return output, nil
+}
+
 func (n *notificationRepo) DeleteUserPushInformation(ctx context.Context, userId int32) error {
 	tx, err := n.db.Begin()
 	if err != nil {
@@ -0,0 +1,159 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"tranquility/models"
+
+	"github.com/jmoiron/sqlx"
+)
+
+var (
+	ErrTooManyPins = errors.New("the channel has too many pinned messages")
+	ErrPinNotFound = errors.New("the message is not pinned in the channel")
+)
+
+type pinRepo struct {
+	db *sqlx.DB
+}
+
+// PinMessage returns false when the message was already pinned, along with the existing pin.
+func (p *pinRepo) PinMessage(ctx context.Context, channelId, messageId, userId int32) (*models.Pin, bool, error) {
+	tx, err := p.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, false, fmt.Errorf("an error occurred while beginning transaction to pin message: %v", err)
+	}
+	defer tx.Rollback()
+
+	// The channel is locked so two pins can't both be added past the limit.
+	var pinCount int
+	var guildId int32
+	err = tx.QueryRowxContext(
+		ctx,
+		`WITH locked AS (SELECT id, guild_id FROM channel WHERE id = $1 FOR UPDATE)
+		SELECT coalesce(locked.guild_id, 0), (SELECT count(*) FROM channel_pin cp WHERE cp.channel_id = locked.id)
+		FROM locked
+		WHERE EXISTS (SELECT 1 FROM message m WHERE m.id = $2 AND m.channel_id = locked.id AND m.deleted_date IS NULL)`,
+		channelId,
+		messageId,
+	).Scan(&guildId, &pinCount)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, false, ErrMessageNotFound
+		}
+		return nil, false, fmt.Errorf("an error occurred while counting pins of channel %d: %v", channelId, err)
+	}
+
+	var existing models.Pin
+	err = tx.QueryRowxContext(
+		ctx,
+		`SELECT channel_id, message_id, coalesce(pinned_by, 0) AS pinned_by, created_date FROM channel_pin WHERE message_id = $1`,
+		messageId,
+	).StructScan(&existing)
+	if err == nil {
+		existing.GuildId = guildId
+		return &existing, false, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, false, fmt.Errorf("an error occurred while checking if message %d is pinned: %v", messageId, err)
+	}
+	if pinCount >= models.MaxChannelPins {
+		return nil, false, ErrTooManyPins
+	}
+
+	output := models.Pin{GuildId: guildId}
+	err = tx.QueryRowxContext(
+		ctx,
+		`INSERT INTO channel_pin (channel_id, message_id, pinned_by) VALUES ($1, $2, $3)
+		RETURNING channel_id, message_id, pinned_by, created_date`,
+		channelId,
+		messageId,
+		userId,
+	).StructScan(&output)
+	if err != nil {
+		return nil, false, fmt.Errorf("an error occurred while pinning message %d: %v", messageId, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, false, fmt.Errorf("an error occurred while committing pin: %v", err)
+	}
+	return &output, true, nil
+}
+
+func (p *pinRepo) UnpinMessage(ctx context.Context, channelId, messageId int32) (*models.Pin, error) {
+	var output models.Pin
+	err := p.db.QueryRowxContext(
+		ctx,
+		`WITH dp AS (
+			DELETE FROM channel_pin WHERE channel_id = $1 AND message_id = $2
+			RETURNING channel_id, message_id, pinned_by, created_date
+		)
+		SELECT dp.channel_id, coalesce(c.guild_id, 0) AS guild_id, dp.message_id, coalesce(dp.pinned_by, 0) AS pinned_by, dp.created_date
+		FROM dp
+		JOIN channel c ON c.id = dp.channel_id`,
+		channelId,
+		messageId,
+	).StructScan(&output)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrPinNotFound
+		}
+		return nil, fmt.Errorf("an error occurred while unpinning message %d: %v", messageId, err)
+	}
+	return &output, nil
+}
+
+// GetChannelPins returns the pinned messages of the channel, most recently pinned first.
+// Callers are expected to verify the user is able to see the channel.
+func (p *pinRepo) GetChannelPins(ctx context.Context, channelId int32) ([]models.PinnedMessage, error) {
+	output := make([]models.PinnedMessage, 0)
+	rows, err := p.db.QueryxContext(
+		ctx,
+		`SELECT
+			m.id,
+			m.channel_id,
+			coalesce(c.name, '') AS channel_name,
+			coalesce(g.id, 0) AS guild_id,
+			coalesce(g.name, '') AS guild_name,
+			a.username AS author,
+			m.author_id,
+			coalesce(at.file_name, '') AS author_avatar,
+			m.content,
+			m.reply_to_id,
+			m.thread_id,
+			m.created_date,
+			m.updated_date,
+			coalesce(cp.pinned_by, 0) AS pinned_by,
+			cp.created_date AS pinned_date
+		FROM channel_pin cp
+		JOIN message m ON m.id = cp.message_id
+		JOIN auth a ON a.id = m.author_id
+		JOIN channel c ON c.id = m.channel_id
+		LEFT JOIN guild g ON g.id = c.guild_id
+		LEFT JOIN profile_mapping pm ON a.id = pm.user_id
+		LEFT JOIN attachment at ON pm.attachment_id = at.id
+		WHERE cp.channel_id = $1
+		ORDER BY cp.id DESC`,
+		channelId,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("an error occurred while collecting pins of channel %d: %v", channelId, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var pinned models.PinnedMessage
+		if err := rows.StructScan(&pinned); err != nil {
+			return nil, err
+		}
+		pinned.Pinned = true
+		output = append(output, pinned)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return output, nil
+}
@@ -26,10 +26,20 @@ var (
 type Postgres struct {
 	authRepo
 	attachmentRepo
+	auditLogRepo
+	directMessageRepo
 	guildRepo
+	inviteRepo
 	messageRepo
 	memberRepo
 	notificationRepo
+	pinRepo
+	presenceRepo
+	reactionRepo
+	readStateRepo
+	roleRepo
+	// db is shared with the repos and the websocket broadcaster.
+	db               *sqlx.DB
 	fileHandler      *services.FileHandler
 	jwtHandler       *services.JWTHandler
 	cloudflare       *services.CloudflareService
@@ -53,18 +63,27 @@ func CreatePostgres(
 	}
 
 	return &Postgres{
-		authRepo:         authRepo{db},
-		attachmentRepo:   attachmentRepo{db},
-		guildRepo:        guildRepo{db},
-		messageRepo:      messageRepo{db},
-		memberRepo:       memberRepo{db},
-		notificationRepo: notificationRepo{db},
-		fileHandler:      fileHandler,
-		jwtHandler:       jwtHandler,
-		cloudflare:       cloudflare,
-		pushNotification: pushNotification,
-		webAuthn:         webAuthn,
-		webAuthnSessions: webAuthnSessions,
+		authRepo:          authRepo{db},
+		attachmentRepo:    attachmentRepo{db},
+		auditLogRepo:      auditLogRepo{db},
+		directMessageRepo: directMessageRepo{db},
+		guildRepo:         guildRepo{db},
+		inviteRepo:        inviteRepo{db},
+		messageRepo:       messageRepo{db},
+		memberRepo:        memberRepo{db},
+		notificationRepo:  notificationRepo{db},
+		pinRepo:           pinRepo{db},
+		presenceRepo:      presenceRepo{db},
+		reactionRepo:      reactionRepo{db},
+		readStateRepo:     readStateRepo{db},
+		roleRepo:          roleRepo{db},
+		db:                db,
+		fileHandler:       fileHandler,
+		jwtHandler:        jwtHandler,
+		cloudflare:        cloudflare,
+		pushNotification:  pushNotification,
+		webAuthn:          webAuthn,
+		webAuthnSessions:  webAuthnSessions,
 	}, nil
 }
 
@@ -211,7 +230,7 @@ func (p *Postgres) GetJoinedGuilds(ctx context.Context, userId int32) ([]models.
 	}
 
 	for i := range guilds {
-		channels, err := p.guildRepo.GetGuildChannels(ctx, guilds[i].ID, userId)
+		channels, err := p.GetGuildChannels(ctx, guilds[i].ID, userId)
 		if err != nil {
 			return nil, err
 		}
@@ -227,6 +246,100 @@ func (p *Postgres) GetJoinedGuilds(ctx context.Context, userId int32) ([]models.
 	return guilds, nil
 }
 
+func (p *Postgres) GetGuildChannels(ctx context.Context, guildId, userId int32) ([]models.Channel, error) {
+	channels, err := p.guildRepo.GetGuildChannels(ctx, guildId, userId)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.resolveReadStates(ctx, userId, channels); err != nil {
+		return nil, err
+	}
+	return channels, nil
+}
+
+func (p *Postgres) GetDirectMessageChannels(ctx context.Context, userId int32) ([]models.Channel, error) {
+	channels, err := p.directMessageRepo.GetDirectMessageChannels(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.resolveReadStates(ctx, userId, channels); err != nil {
+		return nil, err
+	}
+	return channels, nil
+}
+
+// resolveReadStates fills in the unread and mention counts of every channel for the user.
+func (p *Postgres) resolveReadStates(ctx context.Context, userId int32, channels []models.Channel) error {
+	channelIds := make([]int32, len(channels))
+	for i := range channels {
+		channelIds[i] = channels[i].ID
+	}
+
+	states, err := p.readStateRepo.GetReadStates(ctx, userId, channelIds)
+	if err != nil {
+		return err
+	}
+	for i := range channels {
+		if state, ok := states[channels[i].ID]; ok {
+			channels[i].ReadState = &state
+		}
+	}
+	return nil
+}
+
+// AckMessage moves the user's read marker in the channel and returns the read state after the change.
+func (p *Postgres) AckMessage(ctx context.Context, userId, channelId, messageId int32) (*models.ReadState, error) {
+	if err := p.readStateRepo.AckMessage(ctx, userId, channelId, messageId); err != nil {
+		return nil, err
+	}
+
+	states, err := p.readStateRepo.GetReadStates(ctx, userId, []int32{channelId})
+	if err != nil {
+		return nil, err
+	}
+	state, ok := states[channelId]
+	if !ok {
+		return nil, fmt.Errorf("the read state of channel %d was not found after acknowledging message %d", channelId, messageId)
+	}
+	return &state, nil
+}
+
+// GetGuildMembers includes the presence of every member as other users see it.
+func (p *Postgres) GetGuildMembers(ctx context.Context, guildId, userId int32) ([]models.AuthUser, error) {
+	members, err := p.memberRepo.GetGuildMembers(ctx, guildId, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	userIds := make([]int32, len(members))
+	for i := range members {
+		userIds[i] = members[i].ID
+	}
+	presences, err := p.presenceRepo.GetPresences(ctx, userIds)
+	if err != nil {
+		return nil, err
+	}
+	for i := range members {
+		if presence, ok := presences[members[i].ID]; ok {
+			members[i].Presence = &presence
+		}
+	}
+	return members, nil
+}
+
+// GetPresence returns the presence of the user as other users see it.
+func (p *Postgres) GetPresence(ctx context.Context, userId int32) (*models.Presence, error) {
+	presences, err := p.presenceRepo.GetPresences(ctx, []int32{userId})
+	if err != nil {
+		return nil, err
+	}
+	presence, ok := presences[userId]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &presence, nil
+}
+
 func (p *Postgres) CreateGuild(ctx context.Context, guild *models.Guild, userId int32) (*models.Guild, error) {
 	tx, guild, err := p.guildRepo.CreateGuild(ctx, guild, userId)
 	if err != nil {
@@ -247,12 +360,51 @@ func (p *Postgres) CreateGuild(ctx context.Context, guild *models.Guild, userId
 	return guild, nil
 }
 
-func (p *Postgres) GetMembers(ctx context.Context, guildId int32) ([]models.Member, error) {
-	if guildId == -1 {
-		return p.memberRepo.GetMembers(ctx)
-	} else {
-		return p.memberRepo.GetNotAddedMembers(ctx, guildId)
+func (p *Postgres) CreateInvite(ctx context.Context, invite *models.Invite) (*models.Invite, error) {
+	code, err := services.GenerateInviteCode()
+	if err != nil {
+		return nil, fmt.Errorf("an error occurred while generating invite code: %v", err)
 	}
+	invite.Code = code
+
+	return p.inviteRepo.CreateInvite(ctx, invite)
+}
+
+func (p *Postgres) RedeemInvite(ctx context.Context, code string, userId int32) (*models.Guild, error) {
+	guildId, err := p.inviteRepo.RedeemInvite(ctx, code, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	guild, err := p.GetGuildByID(ctx, guildId, userId)
+	if err != nil {
+		return nil, err
+	}
+	channels, err := p.guildRepo.GetGuildChannels(ctx, guild.ID, userId)
+	if err != nil {
+		return nil, err
+	}
+	members, err := p.GetGuildMembers(ctx, guild.ID, userId)
+	if err != nil {
+		return nil, err
+	}
+	guild.Channels = channels
+	guild.Members = members
+
+	return guild, nil
+}
+
+func (p *Postgres) CreateDirectMessage(ctx context.Context, userId int32, request *models.DirectMessageRequest) (*models.Channel, bool, error) {
+	channelId, created, err := p.directMessageRepo.CreateDirectMessage(ctx, userId, request)
+	if err != nil {
+		return nil, false, err
+	}
+
+	channel, err := p.directMessageRepo.GetDirectMessageChannel(ctx, channelId, userId)
+	if err != nil {
+		return nil, false, fmt.Errorf("an error occurred while collecting direct message %d after creating it: %v", channelId, err)
+	}
+	return channel, created, nil
 }
 
 func (p *Postgres) SaveUserPushInformation(ctx context.Context, registration *webpush.Subscription, userId int32) error {
@@ -288,7 +440,11 @@ func (p *Postgres) SaveUserPushInformation(ctx context.Context, registration *we
 func (p *Postgres) CreateMessage(ctx context.Context, message *models.Message, userId int32) (*models.Message, error) {
 	tx, messageData, err := p.messageRepo.CreateMessage(ctx, message, userId)
 	if err != nil {
-		return nil, fmt.Errorf("an error occurred while creating message: %s", err)
+		// Nothing is inserted when the reply or thread isn't a message in the channel that can be used.
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrMessageNotFound
+		}
+		return nil, fmt.Errorf("an error occurred while creating message: %w", err)
 	}
 	defer tx.Rollback()
 
@@ -308,8 +464,22 @@ func (p *Postgres) CreateMessage(ctx context.Context, message *models.Message, u
 		}
 	}
 
+	if messageData.ThreadId != nil {
+		if err := p.messageRepo.AddThreadParticipant(ctx, tx, *messageData.ThreadId, userId); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := p.saveMessageMentions(ctx, tx, messageData, userId); err != nil {
+		return nil, err
+	}
+
 	tx.Commit()
 
+	if err := p.resolveMessageReplies(ctx, messageData); err != nil {
+		return nil, err
+	}
+
 	attachments, err := p.messageRepo.GetMessageAttachment(ctx, messageData.ID)
 	if err != nil {
 		return nil, fmt.Errorf("unable to get message attachment while creating: %v", err)
@@ -325,11 +495,206 @@ func (p *Postgres) CreateMessage(ctx context.Context, message *models.Message, u
 	return messageData, nil
 }
 
-func (p *Postgres) GetChannelMessages(ctx context.Context, userId, guildId, channelId, pageNumber int32) ([]models.Message, error) {
-	messages, err := p.messageRepo.GetChannelMessages(ctx, userId, guildId, channelId, pageNumber)
+// UpdateMessage changes the content of a message. Only the author of the message is able to edit it.
+func (p *Postgres) UpdateMessage(ctx context.Context, message *models.Message, userId int32) (*models.Message, error) {
+	existing, err := p.messageRepo.GetMessage(ctx, message.ChannelID, message.ID)
+	if err != nil {
+		return nil, err
+	}
+	if existing.AuthorId != userId {
+		return nil, ErrUserLacksPermission
+	}
+
+	permissions, err := p.roleRepo.GetChannelPermissions(ctx, message.ChannelID, userId)
+	if err != nil {
+		return nil, err
+	}
+	if !permissions.Has(models.PermissionViewChannel | models.PermissionSendMessages) {
+		return nil, ErrUserLacksPermission
+	}
+
+	tx, err := p.messageRepo.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("an error occurred while beginning transaction to update message %d: %v", message.ID, err)
+	}
+	defer tx.Rollback()
+
+	messageData, err := p.messageRepo.UpdateMessage(ctx, tx, message, userId)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.saveMessageMentions(ctx, tx, messageData, userId); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("an error occurred while committing update of message %d: %v", message.ID, err)
+	}
+	if err := p.resolveMessageReplies(ctx, messageData); err != nil {
+		return nil, err
+	}
+
+	if err := p.resolveMessageFiles(ctx, messageData); err != nil {
+		return nil, fmt.Errorf("an error occurred while collecting files after updating message %d: %v", messageData.ID, err)
+	}
+	return messageData, nil
+}
+
+// DeleteMessage removes a message from the channel. The author is always able to delete their own message,
+// otherwise the user is required to be able to manage messages.
+//
+// The returned message only contains enough information to notify the channel of the deletion.
+func (p *Postgres) DeleteMessage(ctx context.Context, channelId, messageId, userId int32) (*models.Message, error) {
+	existing, err := p.messageRepo.GetMessage(ctx, channelId, messageId)
+	if err != nil {
+		return nil, err
+	}
+
+	permissions, err := p.roleRepo.GetChannelPermissions(ctx, channelId, userId)
+	if err != nil {
+		return nil, err
+	}
+	if !permissions.Has(models.PermissionViewChannel) {
+		return nil, ErrUserLacksPermission
+	}
+	if existing.AuthorId != userId && !permissions.Has(models.PermissionManageMessages) {
+		return nil, ErrUserLacksPermission
+	}
+
+	if err := p.messageRepo.DeleteMessage(ctx, channelId, messageId, userId); err != nil {
+		return nil, err
+	}
+
+	return &models.Message{
+		ID:        existing.ID,
+		ChannelID: existing.ChannelID,
+		GuildID:   existing.GuildID,
+	}, nil
+}
+
+// saveMessageMentions stores the mentions written in the message's content. @everyone is ignored when the
+// author isn't allowed to use it, leaving it as plain text.
+func (p *Postgres) saveMessageMentions(ctx context.Context, tx *sqlx.Tx, message *models.Message, userId int32) error {
+	mentions := models.ParseMentions(message.Content)
+	if mentions.Everyone {
+		permissions, err := p.roleRepo.GetChannelPermissions(ctx, message.ChannelID, userId)
+		if err != nil {
+			return err
+		}
+		mentions.Everyone = permissions.Has(models.PermissionMentionEveryone)
+	}
+
+	saved, err := p.messageRepo.SaveMessageMentions(ctx, tx, message.ChannelID, message.ID, mentions)
+	if err != nil {
+		return err
+	}
+	if saved.Everyone || len(saved.Users) > 0 || len(saved.Roles) > 0 {
+		message.Mentions = saved
+	}
+	return nil
+}
+
+// GetMessageHistory is only available to the author of the message and users able to manage messages in the channel.
+func (p *Postgres) GetMessageHistory(ctx context.Context, channelId, messageId, userId int32) (*models.MessageHistory, error) {
+	permissions, err := p.roleRepo.GetChannelPermissions(ctx, channelId, userId)
+	if err != nil {
+		return nil, err
+	}
+	if !permissions.Has(models.PermissionViewChannel) {
+		return nil, ErrUserLacksPermission
+	}
+
+	history, err := p.messageRepo.GetMessageHistory(ctx, channelId, messageId)
+	if err != nil {
+		return nil, err
+	}
+	if history.Message.AuthorId != userId && !permissions.Has(models.PermissionManageMessages) {
+		return nil, ErrUserLacksPermission
+	}
+	return history, nil
+}
+
+// resolveMessageReplies fills in the snippet of the original message for every message that is a reply.
+func (p *Postgres) resolveMessageReplies(ctx context.Context, messages ...*models.Message) error {
+	replyIds := make([]int32, 0)
+	for _, message := range messages {
+		if message.ReplyToId != nil {
+			replyIds = append(replyIds, *message.ReplyToId)
+		}
+	}
+	if len(replyIds) == 0 {
+		return nil
+	}
+
+	references, err := p.messageRepo.GetMessageReferences(ctx, replyIds)
+	if err != nil {
+		return err
+	}
+	for _, message := range messages {
+		if message.ReplyToId == nil {
+			continue
+		}
+		if reference, ok := references[*message.ReplyToId]; ok {
+			message.ReplyTo = &reference
+		}
+	}
+	return nil
+}
+
+// resolveMessageFiles replaces the stored file names of the author's avatar and message attachments with their urls.
+func (p *Postgres) resolveMessageFiles(ctx context.Context, message *models.Message) error {
+	if message.AuthorAvatar != "" {
+		url, err := p.fileHandler.GetFileUrl(message.AuthorAvatar)
+		if err != nil {
+			return fmt.Errorf("error getting %s avatar: %v", message.Author, err)
+		}
+		message.AuthorAvatar = url
+	}
+
+	attachments, err := p.messageRepo.GetMessageAttachment(ctx, message.ID)
+	if err != nil {
+		return fmt.Errorf("unable to get message attachment: %v", err)
+	}
+	for i := range attachments {
+		url, err := p.fileHandler.GetFileUrl(attachments[i].FileName)
+		if err != nil {
+			return fmt.Errorf("unable to get url path for message attachment: %v", err)
+		}
+		message.Attachment = append(message.Attachment, url)
+	}
+	return nil
+}
+
+func (p *Postgres) GetChannelMessages(ctx context.Context, userId, guildId, channelId int32, query *models.MessageQuery) (*models.MessagePage, error) {
+	page, err := p.messageRepo.GetChannelMessages(ctx, userId, guildId, channelId, query)
 	if err != nil {
 		return nil, fmt.Errorf("an error occurred while getting channel messages: %v", err)
 	}
+	messages := page.Messages
+
+	replies := make([]*models.Message, len(messages))
+	for i := range messages {
+		replies[i] = &messages[i]
+	}
+	if err := p.resolveMessageReplies(ctx, replies...); err != nil {
+		return nil, err
+	}
+
+	messageIds := make([]int32, len(messages))
+	for i := range messages {
+		messageIds[i] = messages[i].ID
+	}
+	reactions, err := p.reactionRepo.GetMessageReactions(ctx, messageIds, userId)
+	if err != nil {
+		return nil, err
+	}
+	mentions, err := p.messageRepo.GetMessageMentions(ctx, messageIds)
+	if err != nil {
+		return nil, err
+	}
+	for i := range messages {
+		messages[i].Reactions = reactions[messages[i].ID]
+		messages[i].Mentions = mentions[messages[i].ID]
+	}
 
 	for i := range messages {
 		if messages[i].AuthorAvatar != "" {
@@ -355,7 +720,74 @@ func (p *Postgres) GetChannelMessages(ctx context.Context, userId, guildId, chan
 		}
 	}
 
-	return messages, nil
+	return page, nil
+}
+
+func (p *Postgres) SearchMessages(ctx context.Context, userId int32, search *models.MessageSearch) ([]models.MessageSearchResult, error) {
+	results, err := p.messageRepo.SearchMessages(ctx, userId, search)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range results {
+		if err := p.resolveMessageFiles(ctx, &results[i].Message); err != nil {
+			return nil, fmt.Errorf("an error occurred while collecting files for search results: %v", err)
+		}
+	}
+
+	return results, nil
+}
+
+func (p *Postgres) GetMentionedMessages(ctx context.Context, userId int32, query *models.MessageQuery) (*models.MessagePage, error) {
+	page, err := p.messageRepo.GetMentionedMessages(ctx, userId, query)
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]*models.Message, len(page.Messages))
+	messageIds := make([]int32, len(page.Messages))
+	for i := range page.Messages {
+		messages[i] = &page.Messages[i]
+		messageIds[i] = page.Messages[i].ID
+	}
+	if err := p.resolveMessageReplies(ctx, messages...); err != nil {
+		return nil, err
+	}
+
+	mentions, err := p.messageRepo.GetMessageMentions(ctx, messageIds)
+	if err != nil {
+		return nil, err
+	}
+	for _, message := range messages {
+		message.Mentions = mentions[message.ID]
+		if err := p.resolveMessageFiles(ctx, message); err != nil {
+			return nil, fmt.Errorf("an error occurred while collecting files for mentions: %v", err)
+		}
+	}
+
+	return page, nil
+}
+
+func (p *Postgres) GetChannelPins(ctx context.Context, channelId int32) ([]models.PinnedMessage, error) {
+	pins, err := p.pinRepo.GetChannelPins(ctx, channelId)
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]*models.Message, len(pins))
+	for i := range pins {
+		messages[i] = &pins[i].Message
+	}
+	if err := p.resolveMessageReplies(ctx, messages...); err != nil {
+		return nil, err
+	}
+	for _, message := range messages {
+		if err := p.resolveMessageFiles(ctx, message); err != nil {
+			return nil, fmt.Errorf("an error occurred while collecting files for pinned messages: %v", err)
+		}
+	}
+
+	return pins, nil
 }
 
 func (p *Postgres) RegisterUserWebAuthn(ctx context.Context, claims *models.Claims) (*protocol.CredentialCreation, error) {
@@ -0,0 +1,238 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"tranquility/models"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+type presenceRepo struct {
+	db *sqlx.DB
+}
+
+// GetOwnPresence returns the status the user picked, even while they aren't connected.
+// Users that have never picked a status are online.
+func (p *presenceRepo) GetOwnPresence(ctx context.Context, userId int32) (*models.Presence, error) {
+	output := models.Presence{UserId: userId, Status: models.PresenceOnline}
+	err := p.db.QueryRowxContext(
+		ctx,
+		`SELECT
+			user_id,
+			status,
+			CASE WHEN custom_status_expires_date <= (NOW() AT TIME ZONE 'utc') THEN '' ELSE coalesce(custom_status, '') END AS custom_status,
+			CASE WHEN custom_status_expires_date <= (NOW() AT TIME ZONE 'utc') THEN NULL ELSE custom_status_expires_date END AS custom_status_expires_date
+		FROM presence
+		WHERE user_id = $1`,
+		userId,
+	).StructScan(&output)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("an error occurred while collecting presence of %d: %v", userId, err)
+	}
+
+	return &output, nil
+}
+
+func (p *presenceRepo) UpdatePresence(ctx context.Context, presence *models.Presence) error {
+	if _, err := p.db.ExecContext(
+		ctx,
+		`INSERT INTO presence (user_id, status, custom_status, custom_status_expires_date)
+		VALUES (
+			$1,
+			$2,
+			nullif($3, ''),
+			CASE WHEN $3 != '' AND $4 > 0 THEN (NOW() AT TIME ZONE 'utc') + $4 * INTERVAL '1 second' END
+		)
+		ON CONFLICT (user_id) DO UPDATE
+		SET status = EXCLUDED.status,
+			custom_status = EXCLUDED.custom_status,
+			custom_status_expires_date = EXCLUDED.custom_status_expires_date,
+			updated_date = NOW() AT TIME ZONE 'utc'`,
+		presence.UserId,
+		presence.Status,
+		presence.CustomStatus,
+		presence.CustomStatusDuration,
+	); err != nil {
+		return fmt.Errorf("an error occurred while updating presence of %d: %v", presence.UserId, err)
+	}
+	return nil
+}
+
+// UpdatePresenceConnections adds delta to the number of connections the user has open on the server.
+// It returns true when the user went from having no connections on any server to having one, or back.
+func (p *presenceRepo) UpdatePresenceConnections(ctx context.Context, serverId string, userId int32, delta int32) (bool, error) {
+	tx, err := p.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("an error occurred while beginning transaction to update connections of %d: %v", userId, err)
+	}
+	defer tx.Rollback()
+
+	// Locking the user's presence keeps two servers from both deciding the user came online.
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext('presence'), $1)`, userId); err != nil {
+		return false, fmt.Errorf("an error occurred while locking connections of %d: %v", userId, err)
+	}
+	before, err := p.isConnected(ctx, tx, userId)
+	if err != nil {
+		return false, err
+	}
+
+	if _, err := tx.ExecContext(
+		ctx,
+		`INSERT INTO presence_connection (server_id, user_id, connections) VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, server_id) DO UPDATE
+		SET connections = presence_connection.connections + $3, heartbeat_date = NOW() AT TIME ZONE 'utc'`,
+		serverId,
+		userId,
+		delta,
+	); err != nil {
+		return false, fmt.Errorf("an error occurred while updating connections of %d: %v", userId, err)
+	}
+	if _, err := tx.ExecContext(
+		ctx,
+		`DELETE FROM presence_connection WHERE server_id = $1 AND user_id = $2 AND connections <= 0`,
+		serverId,
+		userId,
+	); err != nil {
+		return false, fmt.Errorf("an error occurred while removing closed connections of %d: %v", userId, err)
+	}
+
+	after, err := p.isConnected(ctx, tx, userId)
+	if err != nil {
+		return false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("an error occurred while committing connections of %d: %v", userId, err)
+	}
+	return before != after, nil
+}
+
+func (p *presenceRepo) isConnected(ctx context.Context, tx *sqlx.Tx, userId int32) (bool, error) {
+	var connected bool
+	if err := tx.QueryRowxContext(
+		ctx,
+		`SELECT EXISTS (
+			SELECT 1 FROM presence_connection
+			WHERE user_id = $1 AND heartbeat_date > (NOW() AT TIME ZONE 'utc') - $2 * INTERVAL '1 second'
+		)`,
+		userId,
+		models.PresenceHeartbeatExpiry.Seconds(),
+	).Scan(&connected); err != nil {
+		return false, fmt.Errorf("an error occurred while checking connections of %d: %v", userId, err)
+	}
+	return connected, nil
+}
+
+// ClearPresenceConnections removes the connections the server had open before it was restarted.
+func (p *presenceRepo) ClearPresenceConnections(ctx context.Context, serverId string) error {
+	if _, err := p.db.ExecContext(ctx, `DELETE FROM presence_connection WHERE server_id = $1`, serverId); err != nil {
+		return fmt.Errorf("an error occurred while clearing connections of server %s: %v", serverId, err)
+	}
+	return nil
+}
+
+// RefreshPresenceConnections keeps the server's connections from expiring and deletes the ones other servers
+// stopped refreshing. It returns the users whose expired connections were deleted.
+func (p *presenceRepo) RefreshPresenceConnections(ctx context.Context, serverId string) ([]int32, error) {
+	if _, err := p.db.ExecContext(
+		ctx,
+		`UPDATE presence_connection SET heartbeat_date = NOW() AT TIME ZONE 'utc' WHERE server_id = $1`,
+		serverId,
+	); err != nil {
+		return nil, fmt.Errorf("an error occurred while refreshing connections of server %s: %v", serverId, err)
+	}
+
+	// Every server runs the cleanup, but each expired row is only deleted and returned once.
+	output := make([]int32, 0)
+	rows, err := p.db.QueryContext(
+		ctx,
+		`DELETE FROM presence_connection
+		WHERE heartbeat_date <= (NOW() AT TIME ZONE 'utc') - $1 * INTERVAL '1 second'
+		RETURNING user_id`,
+		models.PresenceHeartbeatExpiry.Seconds(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("an error occurred while deleting expired connections: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var userId int32
+		if err := rows.Scan(&userId); err != nil {
+			return nil, err
+		}
+		output = append(output, userId)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return output, nil
+}
+
+// GetPresences returns what other users see for each user, keyed by user id.
+func (p *presenceRepo) GetPresences(ctx context.Context, userIds []int32) (map[int32]models.Presence, error) {
+	output := make(map[int32]models.Presence)
+	if len(userIds) == 0 {
+		return output, nil
+	}
+
+	rows, err := p.db.QueryxContext(
+		ctx,
+		`SELECT user_id, status, custom_status, custom_status_expires_date
+		FROM user_presence
+		WHERE user_id = ANY($1::INTEGER[])`,
+		pq.Array(userIds),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("an error occurred while collecting presences: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var presence models.Presence
+		if err := rows.StructScan(&presence); err != nil {
+			return nil, err
+		}
+		output[presence.UserId] = presence
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return output, nil
+}
+
+// GetPresenceAudience returns every user that shares a guild with the user, including the user.
+func (p *presenceRepo) GetPresenceAudience(ctx context.Context, userId int32) (map[int32]bool, error) {
+	output := map[int32]bool{userId: true}
+
+	rows, err := p.db.QueryContext(
+		ctx,
+		`SELECT DISTINCT other.user_id
+		FROM member self
+		JOIN member other ON other.guild_id = self.guild_id
+		WHERE self.user_id = $1`,
+		userId,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("an error occurred while collecting users that share a guild with %d: %v", userId, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int32
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		output[id] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return output, nil
+}
@@ -0,0 +1,135 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"tranquility/models"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+var (
+	ErrTooManyReactions = errors.New("the message has too many different reactions")
+)
+
+type reactionRepo struct {
+	db *sqlx.DB
+}
+
+// AddReaction returns false when the user had already reacted to the message with the emoji.
+func (r *reactionRepo) AddReaction(ctx context.Context, channelId, messageId, userId int32, emoji string) (bool, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("an error occurred while beginning transaction to add reaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	// The message is locked so two new emoji can't both be added past the limit.
+	var emojiCount int
+	var hasEmoji bool
+	err = tx.QueryRowxContext(
+		ctx,
+		`WITH locked AS (SELECT id FROM message WHERE id = $1 AND channel_id = $2 AND deleted_date IS NULL FOR UPDATE)
+		SELECT count(DISTINCT mr.emoji), coalesce(bool_or(mr.emoji = $3), false)
+		FROM locked
+		LEFT JOIN message_reaction mr ON mr.message_id = locked.id
+		GROUP BY locked.id`,
+		messageId,
+		channelId,
+		emoji,
+	).Scan(&emojiCount, &hasEmoji)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, ErrMessageNotFound
+		}
+		return false, fmt.Errorf("an error occurred while collecting reactions for message %d: %v", messageId, err)
+	}
+	if !hasEmoji && emojiCount >= models.MaxMessageReactions {
+		return false, ErrTooManyReactions
+	}
+
+	result, err := tx.ExecContext(
+		ctx,
+		`INSERT INTO message_reaction (message_id, user_id, emoji) VALUES ($1, $2, $3)
+		ON CONFLICT (message_id, user_id, emoji) DO NOTHING`,
+		messageId,
+		userId,
+		emoji,
+	)
+	if err != nil {
+		return false, fmt.Errorf("an error occurred while adding reaction to message %d: %v", messageId, err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("an error occurred while getting the number of reactions added: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("an error occurred while committing reaction: %v", err)
+	}
+	return affected == 1, nil
+}
+
+// RemoveReaction returns false when the user had not reacted to the message with the emoji.
+func (r *reactionRepo) RemoveReaction(ctx context.Context, channelId, messageId, userId int32, emoji string) (bool, error) {
+	result, err := r.db.ExecContext(
+		ctx,
+		`DELETE FROM message_reaction mr
+		USING message m
+		WHERE m.id = mr.message_id AND m.channel_id = $1 AND mr.message_id = $2 AND mr.user_id = $3 AND mr.emoji = $4`,
+		channelId,
+		messageId,
+		userId,
+		emoji,
+	)
+	if err != nil {
+		return false, fmt.Errorf("an error occurred while removing reaction from message %d: %v", messageId, err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("an error occurred while getting the number of reactions removed: %v", err)
+	}
+	return affected == 1, nil
+}
+
+// GetMessageReactions collects the reaction counts of each message, keyed by message id.
+func (r *reactionRepo) GetMessageReactions(ctx context.Context, messageIds []int32, userId int32) (map[int32][]models.Reaction, error) {
+	output := make(map[int32][]models.Reaction)
+	if len(messageIds) == 0 {
+		return output, nil
+	}
+
+	rows, err := r.db.QueryContext(
+		ctx,
+		`SELECT message_id, emoji, count(*) AS count, bool_or(user_id = $2) AS me
+		FROM message_reaction
+		WHERE message_id = ANY($1::INTEGER[])
+		GROUP BY message_id, emoji
+		ORDER BY message_id, min(id)`,
+		pq.Array(messageIds),
+		userId,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("an error occurred while collecting message reactions: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var messageId int32
+		var reaction models.Reaction
+		if err := rows.Scan(&messageId, &reaction.Emoji, &reaction.Count, &reaction.Me); err != nil {
+			return nil, err
+		}
+		output[messageId] = append(output[messageId], reaction)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return output, nil
+}
@@ -0,0 +1,98 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"tranquility/models"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+type readStateRepo struct {
+	db *sqlx.DB
+}
+
+// AckMessage marks every message up to and including the message as read.
+// Acknowledging an older message moves the marker back, which lets clients mark messages as unread.
+func (r *readStateRepo) AckMessage(ctx context.Context, userId, channelId, messageId int32) error {
+	var acked int32
+	err := r.db.QueryRowxContext(
+		ctx,
+		`INSERT INTO read_state (user_id, channel_id, last_read_message_id)
+		SELECT $1, m.channel_id, m.id
+		FROM message m
+		WHERE m.id = $3 AND m.channel_id = $2
+		ON CONFLICT (user_id, channel_id) DO UPDATE
+		SET last_read_message_id = EXCLUDED.last_read_message_id, updated_date = NOW() AT TIME ZONE 'utc'
+		RETURNING last_read_message_id`,
+		userId,
+		channelId,
+		messageId,
+	).Scan(&acked)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrMessageNotFound
+		}
+		return fmt.Errorf("an error occurred while acknowledging message %d for %d: %v", messageId, userId, err)
+	}
+	return nil
+}
+
+// GetReadStates counts the unread messages and mentions of each channel, keyed by channel id.
+// Callers are expected to only pass channels the user is able to see.
+func (r *readStateRepo) GetReadStates(ctx context.Context, userId int32, channelIds []int32) (map[int32]models.ReadState, error) {
+	output := make(map[int32]models.ReadState)
+	if len(channelIds) == 0 {
+		return output, nil
+	}
+
+	rows, err := r.db.QueryxContext(
+		ctx,
+		`SELECT
+			c.id AS channel_id,
+			coalesce(c.guild_id, 0) AS guild_id,
+			coalesce(rs.last_read_message_id, 0) AS last_read_message_id,
+			count(m.id) AS unread_count,
+			count(m.id) FILTER (WHERE
+				m.mention_everyone
+				OR EXISTS (
+					SELECT 1 FROM message_mention mm
+					WHERE mm.message_id = m.id AND mm.user_id = $1
+				)
+				OR EXISTS (
+					SELECT 1 FROM message_mention mm
+					JOIN member_role mr ON mr.role_id = mm.role_id
+					JOIN member me ON me.id = mr.member_id
+					WHERE mm.message_id = m.id AND me.user_id = $1
+				)
+			) AS mention_count
+		FROM channel c
+		LEFT JOIN read_state rs ON rs.channel_id = c.id AND rs.user_id = $1
+		LEFT JOIN message m ON m.channel_id = c.id AND m.id > coalesce(rs.last_read_message_id, 0) AND m.author_id != $1
+			AND m.deleted_date IS NULL
+		WHERE c.id = ANY($2::INTEGER[])
+		GROUP BY c.id, rs.last_read_message_id`,
+		userId,
+		pq.Array(channelIds),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("an error occurred while collecting read states of %d: %v", userId, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var state models.ReadState
+		if err := rows.StructScan(&state); err != nil {
+			return nil, err
+		}
+		output[state.ChannelId] = state
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return output, nil
+}
@@ -0,0 +1,327 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"tranquility/models"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+var (
+	ErrRoleNotFound        = errors.New("the role was not found in the guild")
+	ErrMemberNotFound      = errors.New("the user is not a member of the guild")
+	ErrDuplicateMemberRole = errors.New("the member already has this role")
+)
+
+type roleRepo struct {
+	db *sqlx.DB
+}
+
+func (r *roleRepo) GetGuildRoles(ctx context.Context, guildId, userId int32) ([]models.Role, error) {
+	output := make([]models.Role, 0)
+	rows, err := r.db.QueryxContext(
+		ctx,
+		`SELECT r.id, r.name, r.guild_id, coalesce(bit_or(ri.value), 0) AS permissions, r.created_date, r.updated_date
+		FROM role r
+		JOIN member m ON m.guild_id = r.guild_id AND m.user_id = $2
+		LEFT JOIN role_intent ri ON ri.role_id = r.id
+		WHERE r.guild_id = $1
+		GROUP BY r.id
+		ORDER BY r.id`,
+		guildId,
+		userId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var role models.Role
+		if err := rows.StructScan(&role); err != nil {
+			return nil, err
+		}
+		output = append(output, role)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return output, nil
+}
+
+func (r *roleRepo) GetMemberRoles(ctx context.Context, guildId, memberId int32) ([]models.Role, error) {
+	output := make([]models.Role, 0)
+	rows, err := r.db.QueryxContext(
+		ctx,
+		`SELECT r.id, r.name, r.guild_id, coalesce(bit_or(ri.value), 0) AS permissions, r.created_date, r.updated_date
+		FROM member m
+		JOIN member_role mr ON mr.member_id = m.id
+		JOIN role r ON r.id = mr.role_id
+		LEFT JOIN role_intent ri ON ri.role_id = r.id
+		WHERE m.guild_id = $1 AND m.user_id = $2
+		GROUP BY r.id
+		ORDER BY r.id`,
+		guildId,
+		memberId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var role models.Role
+		if err := rows.StructScan(&role); err != nil {
+			return nil, err
+		}
+		output = append(output, role)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return output, nil
+}
+
+func (r *roleRepo) CreateRole(ctx context.Context, role *models.Role) (*models.Role, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("an error occurred while beginning transaction to create role: %v", err)
+	}
+	defer tx.Rollback()
+
+	var output models.Role
+	err = tx.QueryRowxContext(
+		ctx,
+		`INSERT INTO role (name, guild_id) VALUES ($1, $2)
+		RETURNING id, name, guild_id, created_date, updated_date`,
+		role.Name,
+		role.GuildId,
+	).StructScan(&output)
+	if err != nil {
+		return nil, fmt.Errorf("an error occurred while inserting role for guild %d: %v", role.GuildId, err)
+	}
+
+	if err := r.setRoleIntents(ctx, tx, output.ID, role.Permissions); err != nil {
+		return nil, err
+	}
+	output.Permissions = role.Permissions
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("an error occurred while committing role creation: %v", err)
+	}
+	return &output, nil
+}
+
+// UpdateRole only replaces the role's intents when permissions are part of the update.
+func (r *roleRepo) UpdateRole(ctx context.Context, role *models.RoleUpdate) (*models.Role, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("an error occurred while beginning transaction to update role: %v", err)
+	}
+	defer tx.Rollback()
+
+	var output models.Role
+	err = tx.QueryRowxContext(
+		ctx,
+		`UPDATE role
+		SET name = coalesce(nullif($1, ''), name), updated_date = NOW() AT TIME ZONE 'utc'
+		WHERE id = $2 AND guild_id = $3
+		RETURNING id, name, guild_id, created_date, updated_date`,
+		role.Name,
+		role.ID,
+		role.GuildId,
+	).StructScan(&output)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRoleNotFound
+		}
+		return nil, fmt.Errorf("an error occurred while updating role %d: %v", role.ID, err)
+	}
+
+	if role.Permissions != nil {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM role_intent WHERE role_id = $1`, output.ID); err != nil {
+			return nil, fmt.Errorf("an error occurred while clearing intents for role %d: %v", output.ID, err)
+		}
+		if err := r.setRoleIntents(ctx, tx, output.ID, *role.Permissions); err != nil {
+			return nil, err
+		}
+		output.Permissions = *role.Permissions
+	} else {
+		err = tx.QueryRowxContext(
+			ctx,
+			`SELECT coalesce(bit_or(value), 0) FROM role_intent WHERE role_id = $1`,
+			output.ID,
+		).Scan(&output.Permissions)
+		if err != nil {
+			return nil, fmt.Errorf("an error occurred while collecting intents for role %d: %v", output.ID, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("an error occurred while committing role update: %v", err)
+	}
+	return &output, nil
+}
+
+func (r *roleRepo) setRoleIntents(ctx context.Context, tx *sqlx.Tx, roleId int32, permissions models.Permission) error {
+	for _, intent := range permissions.Intents() {
+		if _, err := tx.ExecContext(
+			ctx,
+			`INSERT INTO role_intent (role_id, value) VALUES ($1, $2)`,
+			roleId,
+			intent,
+		); err != nil {
+			return fmt.Errorf("an error occurred while inserting intent %d for role %d: %v", intent, roleId, err)
+		}
+	}
+	return nil
+}
+
+func (r *roleRepo) DeleteRole(ctx context.Context, guildId, roleId int32) error {
+	result, err := r.db.ExecContext(
+		ctx,
+		`DELETE FROM role WHERE id = $1 AND guild_id = $2`,
+		roleId,
+		guildId,
+	)
+	if err != nil {
+		return fmt.Errorf("an error occurred while deleting role %d: %v", roleId, err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("an error occurred while getting the number of roles deleted: %v", err)
+	}
+	if affected != 1 {
+		return ErrRoleNotFound
+	}
+	return nil
+}
+
+func (r *roleRepo) AddMemberRole(ctx context.Context, guildId, roleId, memberId int32) error {
+	result, err := r.db.ExecContext(
+		ctx,
+		`INSERT INTO member_role (member_id, role_id)
+		SELECT m.id, r.id
+		FROM member m
+		JOIN role r ON r.guild_id = m.guild_id
+		WHERE m.guild_id = $1 AND r.id = $2 AND m.user_id = $3`,
+		guildId,
+		roleId,
+		memberId,
+	)
+	if err != nil {
+		var pgErr *pq.Error
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return ErrDuplicateMemberRole
+		}
+		return fmt.Errorf("an error occurred while adding role %d to %d: %v", roleId, memberId, err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("an error occurred while getting the number of member roles inserted: %v", err)
+	}
+	if affected != 1 {
+		return ErrMemberNotFound
+	}
+	return nil
+}
+
+func (r *roleRepo) RemoveMemberRole(ctx context.Context, guildId, roleId, memberId int32) error {
+	result, err := r.db.ExecContext(
+		ctx,
+		`DELETE FROM member_role mr
+		USING member m
+		WHERE mr.member_id = m.id AND m.guild_id = $1 AND mr.role_id = $2 AND m.user_id = $3`,
+		guildId,
+		roleId,
+		memberId,
+	)
+	if err != nil {
+		return fmt.Errorf("an error occurred while removing role %d from %d: %v", roleId, memberId, err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("an error occurred while getting the number of member roles deleted: %v", err)
+	}
+	if affected != 1 {
+		return ErrRoleNotFound
+	}
+	return nil
+}
+
+// GetGuildPermissions returns the permissions the user has in the guild.
+// A user that is not a member of the guild has no permissions.
+func (r *roleRepo) GetGuildPermissions(ctx context.Context, guildId, userId int32) (models.Permission, error) {
+	var isOwner bool
+	var granted models.Permission
+	err := r.db.QueryRowxContext(
+		ctx,
+		`SELECT g.owner_id = m.user_id AS is_owner, coalesce(bit_or(ri.value), 0) AS granted
+		FROM member m
+		JOIN guild g ON g.id = m.guild_id
+		LEFT JOIN member_role mr ON mr.member_id = m.id
+		LEFT JOIN role_intent ri ON ri.role_id = mr.role_id
+		WHERE m.guild_id = $1 AND m.user_id = $2
+		GROUP BY g.owner_id, m.user_id`,
+		guildId,
+		userId,
+	).Scan(&isOwner, &granted)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("an error occurred while collecting permissions for %d in guild %d: %v", userId, guildId, err)
+	}
+
+	return models.ResolvePermissions(isOwner, granted), nil
+}
+
+// GetChannelPermissions returns the permissions the user has in the guild that owns the channel.
+// Direct message channels don't belong to a guild so only their participants have permissions.
+func (r *roleRepo) GetChannelPermissions(ctx context.Context, channelId, userId int32) (models.Permission, error) {
+	var guildId sql.NullInt32
+	err := r.db.QueryRowxContext(
+		ctx,
+		`SELECT guild_id FROM channel WHERE id = $1`,
+		channelId,
+	).Scan(&guildId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("an error occurred while collecting the guild for channel %d: %v", channelId, err)
+	}
+
+	if !guildId.Valid {
+		return r.getDirectMessagePermissions(ctx, channelId, userId)
+	}
+
+	return r.GetGuildPermissions(ctx, guildId.Int32, userId)
+}
+
+func (r *roleRepo) getDirectMessagePermissions(ctx context.Context, channelId, userId int32) (models.Permission, error) {
+	var isParticipant bool
+	err := r.db.QueryRowxContext(
+		ctx,
+		`SELECT EXISTS (SELECT 1 FROM channel_member WHERE channel_id = $1 AND user_id = $2)`,
+		channelId,
+		userId,
+	).Scan(&isParticipant)
+	if err != nil {
+		return 0, fmt.Errorf("an error occurred while checking if %d is in direct message %d: %v", userId, channelId, err)
+	}
+
+	if !isParticipant {
+		return 0, nil
+	}
+	return models.PermissionDirectMessage, nil
+}
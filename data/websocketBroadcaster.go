@@ -0,0 +1,165 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+	"tranquility/models"
+	"tranquility/services"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+const (
+	websocketEventChannel = "websocket_event"
+	// Postgres rejects NOTIFY payloads of 8000 bytes or more, so larger events are stored in
+	// the websocket_event table and only their id is sent through the notification.
+	maxNotifyPayloadSize = 7900
+	// Stored events only need to live long enough for every server to read them.
+	websocketEventLifetime = time.Minute
+	// Pinging makes sure the listener's connection is still alive when no events are being sent.
+	listenerPingInterval = 90 * time.Second
+)
+
+// postgresNotification is the payload sent through NOTIFY. Only one of the fields will be set.
+type postgresNotification struct {
+	ID    int64                  `json:"id,omitempty"`
+	Event *models.WebsocketEvent `json:"event,omitempty"`
+}
+
+// PostgresBroadcaster uses LISTEN/NOTIFY so every API server receives every websocket event.
+//
+// Events are published through the database's pool, while listening needs a dedicated connection
+// that is opened from the connection string.
+type PostgresBroadcaster struct {
+	db               *sqlx.DB
+	connectionString string
+	logger           services.Logger
+}
+
+func NewPostgresBroadcaster(database *Postgres, connectionString string, logger services.Logger) *PostgresBroadcaster {
+	return &PostgresBroadcaster{
+		db:               database.db,
+		connectionString: connectionString,
+		logger:           logger,
+	}
+}
+
+func (p *PostgresBroadcaster) Publish(ctx context.Context, event *models.WebsocketEvent) error {
+	payload, err := json.Marshal(postgresNotification{Event: event})
+	if err != nil {
+		return fmt.Errorf("an error occurred while marshaling %s event for postgres: %v", event.Type, err)
+	}
+
+	if len(payload) > maxNotifyPayloadSize {
+		eventBytes, err := json.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("an error occurred while marshaling %s event to be stored: %v", event.Type, err)
+		}
+
+		var id int64
+		if err := p.db.QueryRowxContext(
+			ctx,
+			`INSERT INTO websocket_event (payload) VALUES ($1) RETURNING id`,
+			eventBytes,
+		).Scan(&id); err != nil {
+			return fmt.Errorf("an error occurred while storing %s event: %v", event.Type, err)
+		}
+
+		payload, err = json.Marshal(postgresNotification{ID: id})
+		if err != nil {
+			return fmt.Errorf("an error occurred while marshaling stored %s event id: %v", event.Type, err)
+		}
+	}
+
+	if _, err := p.db.ExecContext(ctx, `SELECT pg_notify($1, $2)`, websocketEventChannel, string(payload)); err != nil {
+		return fmt.Errorf("an error occurred while notifying servers of %s event: %v", event.Type, err)
+	}
+	return nil
+}
+
+func (p *PostgresBroadcaster) Listen(ctx context.Context, deliver func(*models.WebsocketEvent)) error {
+	listener := pq.NewListener(p.connectionString, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			p.logger.ERROR(fmt.Sprintf("websocket broadcaster listener event %d: %v", event, err))
+		}
+	})
+	defer listener.Close()
+
+	if err := listener.Listen(websocketEventChannel); err != nil {
+		return fmt.Errorf("an error occurred while listening to %s: %v", websocketEventChannel, err)
+	}
+
+	cleanup := time.NewTicker(websocketEventLifetime)
+	defer cleanup.Stop()
+	ping := time.NewTicker(listenerPingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-cleanup.C:
+			p.clearStoredEvents(ctx)
+		case <-ping.C:
+			if err := listener.Ping(); err != nil {
+				p.logger.ERROR(fmt.Sprintf("websocket broadcaster was unable to ping postgres: %v", err))
+			}
+		case notification := <-listener.Notify:
+			// A nil notification is sent after the listener reconnects. Events sent while disconnected are lost.
+			if notification == nil {
+				p.logger.WARNING("websocket broadcaster reconnected to postgres")
+				continue
+			}
+			event, err := p.readNotification(ctx, notification.Extra)
+			if err != nil {
+				p.logger.ERROR(fmt.Sprintf("websocket broadcaster was unable to read notification: %v", err))
+				continue
+			}
+			deliver(event)
+		}
+	}
+}
+
+func (p *PostgresBroadcaster) readNotification(ctx context.Context, payload string) (*models.WebsocketEvent, error) {
+	var notification postgresNotification
+	if err := json.Unmarshal([]byte(payload), &notification); err != nil {
+		return nil, fmt.Errorf("an error occurred while unmarshaling notification: %v", err)
+	}
+	if notification.Event != nil {
+		return notification.Event, nil
+	}
+
+	var eventBytes []byte
+	if err := p.db.QueryRowxContext(
+		ctx,
+		`SELECT payload FROM websocket_event WHERE id = $1`,
+		notification.ID,
+	).Scan(&eventBytes); err != nil {
+		return nil, fmt.Errorf("an error occurred while collecting stored event %d: %v", notification.ID, err)
+	}
+
+	var event models.WebsocketEvent
+	if err := json.Unmarshal(eventBytes, &event); err != nil {
+		return nil, fmt.Errorf("an error occurred while unmarshaling stored event %d: %v", notification.ID, err)
+	}
+	return &event, nil
+}
+
+// Every server runs the cleanup, which is fine because deleting an already deleted event does nothing.
+func (p *PostgresBroadcaster) clearStoredEvents(ctx context.Context) {
+	result, err := p.db.ExecContext(
+		ctx,
+		`DELETE FROM websocket_event WHERE created_date < (NOW() AT TIME ZONE 'utc') - $1 * INTERVAL '1 second'`,
+		websocketEventLifetime.Seconds(),
+	)
+	if err != nil {
+		p.logger.ERROR(fmt.Sprintf("an error occurred while clearing stored websocket events: %v", err))
+		return
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected > 0 {
+		p.logger.INFO(fmt.Sprintf("%d stored websocket events have been cleared", affected))
+	}
+}
@@ -0,0 +1,8 @@
+CREATE TABLE member_role (
+    member_id INTEGER REFERENCES member(id) ON DELETE CASCADE,
+    role_id INTEGER REFERENCES role(id) ON DELETE CASCADE,
+    created_date TIMESTAMPTZ DEFAULT (NOW() AT TIME ZONE 'utc'),
+    UNIQUE (member_id, role_id)
+);
+
+CREATE UNIQUE INDEX idx_role_intent_role_value ON role_intent (role_id, value);
@@ -0,0 +1,5 @@
+CREATE TABLE websocket_event (
+    id BIGSERIAL PRIMARY KEY,
+    payload BYTEA NOT NULL,
+    created_date TIMESTAMPTZ DEFAULT (NOW() AT TIME ZONE 'utc')
+);
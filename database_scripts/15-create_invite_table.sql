@@ -0,0 +1,14 @@
+CREATE TABLE invite (
+    id SERIAL PRIMARY KEY,
+    code TEXT NOT NULL UNIQUE,
+    guild_id INTEGER REFERENCES guild(id) ON DELETE CASCADE,
+    created_by INTEGER REFERENCES auth(id) ON DELETE CASCADE,
+    max_uses INTEGER,
+    uses INTEGER DEFAULT 0,
+    expires_date TIMESTAMPTZ,
+    revoked BOOLEAN DEFAULT FALSE,
+    created_date TIMESTAMPTZ DEFAULT (NOW() AT TIME ZONE 'utc'),
+    updated_date TIMESTAMPTZ DEFAULT (NOW() AT TIME ZONE 'utc')
+);
+
+CREATE INDEX idx_invite_guild_id ON invite (guild_id);
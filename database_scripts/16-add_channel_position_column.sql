@@ -0,0 +1,9 @@
+ALTER TABLE channel ADD COLUMN position INTEGER DEFAULT 0;
+
+UPDATE channel c
+SET position = ordered.position
+FROM (
+    SELECT id, ROW_NUMBER() OVER (PARTITION BY guild_id ORDER BY id) - 1 AS position
+    FROM channel
+) ordered
+WHERE ordered.id = c.id;
@@ -0,0 +1,11 @@
+CREATE TABLE guild_ban (
+    id SERIAL PRIMARY KEY,
+    guild_id INTEGER REFERENCES guild(id) ON DELETE CASCADE,
+    user_id INTEGER REFERENCES auth(id) ON DELETE CASCADE,
+    banned_by INTEGER REFERENCES auth(id) ON DELETE SET NULL,
+    reason TEXT,
+    expires_date TIMESTAMPTZ,
+    created_date TIMESTAMPTZ DEFAULT (NOW() AT TIME ZONE 'utc'),
+    updated_date TIMESTAMPTZ DEFAULT (NOW() AT TIME ZONE 'utc'),
+    UNIQUE (guild_id, user_id)
+);
@@ -0,0 +1,4 @@
+ALTER TABLE message ADD COLUMN search_vector tsvector
+    GENERATED ALWAYS AS (to_tsvector('english', coalesce(content, ''))) STORED;
+
+CREATE INDEX idx_message_search_vector ON message USING GIN (search_vector);
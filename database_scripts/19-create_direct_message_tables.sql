@@ -0,0 +1,24 @@
+-- Guild channels keep their guild_id. Direct message channels have no guild and use channel_member instead.
+ALTER TABLE channel ADD COLUMN type TEXT NOT NULL DEFAULT 'guild'
+    CHECK (type IN ('guild', 'dm', 'group_dm'));
+
+CREATE TABLE channel_member (
+    id SERIAL PRIMARY KEY,
+    channel_id INTEGER REFERENCES channel(id) ON DELETE CASCADE,
+    user_id INTEGER REFERENCES auth(id) ON DELETE CASCADE,
+    created_date TIMESTAMPTZ DEFAULT (NOW() AT TIME ZONE 'utc'),
+    updated_date TIMESTAMPTZ DEFAULT (NOW() AT TIME ZONE 'utc'),
+    UNIQUE (channel_id, user_id)
+);
+
+CREATE INDEX idx_channel_member_user_id ON channel_member (user_id);
+
+-- channel_access lists every user that is able to see a channel, regardless of the channel type.
+CREATE VIEW channel_access AS
+SELECT c.id AS channel_id, m.user_id
+FROM channel c
+JOIN member m ON m.guild_id = c.guild_id
+WHERE c.type = 'guild'
+UNION ALL
+SELECT cm.channel_id, cm.user_id
+FROM channel_member cm;
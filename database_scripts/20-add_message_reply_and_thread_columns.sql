@@ -0,0 +1,13 @@
+-- reply_to_id quotes another message while thread_id places the message in the thread started from its parent.
+ALTER TABLE message ADD COLUMN reply_to_id INTEGER REFERENCES message(id) ON DELETE SET NULL;
+ALTER TABLE message ADD COLUMN thread_id INTEGER REFERENCES message(id) ON DELETE CASCADE;
+
+CREATE INDEX idx_message_thread_id ON message (thread_id);
+
+CREATE TABLE thread_participant (
+    id SERIAL PRIMARY KEY,
+    thread_id INTEGER REFERENCES message(id) ON DELETE CASCADE,
+    user_id INTEGER REFERENCES auth(id) ON DELETE CASCADE,
+    created_date TIMESTAMPTZ DEFAULT (NOW() AT TIME ZONE 'utc'),
+    UNIQUE (thread_id, user_id)
+);
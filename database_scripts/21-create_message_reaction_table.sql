@@ -0,0 +1,9 @@
+-- emoji holds a Unicode emoji. Guild custom emoji will be stored in their own column once they exist.
+CREATE TABLE message_reaction (
+    id SERIAL PRIMARY KEY,
+    message_id INTEGER REFERENCES message(id) ON DELETE CASCADE,
+    user_id INTEGER REFERENCES auth(id) ON DELETE CASCADE,
+    emoji TEXT NOT NULL,
+    created_date TIMESTAMPTZ DEFAULT (NOW() AT TIME ZONE 'utc'),
+    UNIQUE (message_id, user_id, emoji)
+);
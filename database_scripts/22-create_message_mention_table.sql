@@ -0,0 +1,17 @@
+-- Mentions are parsed from the content of a message whenever it is sent or edited.
+-- Each row mentions either a single user or every member of a role.
+ALTER TABLE message ADD COLUMN mention_everyone BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE message_mention (
+    id SERIAL PRIMARY KEY,
+    message_id INTEGER REFERENCES message(id) ON DELETE CASCADE,
+    user_id INTEGER REFERENCES auth(id) ON DELETE CASCADE,
+    role_id INTEGER REFERENCES role(id) ON DELETE CASCADE,
+    created_date TIMESTAMPTZ DEFAULT (NOW() AT TIME ZONE 'utc'),
+    CHECK ((user_id IS NULL) <> (role_id IS NULL))
+);
+
+CREATE INDEX idx_message_mention_message_id ON message_mention (message_id);
+CREATE INDEX idx_message_mention_user_id ON message_mention (user_id);
+CREATE INDEX idx_message_mention_role_id ON message_mention (role_id);
+CREATE INDEX idx_message_mention_everyone ON message (channel_id) WHERE mention_everyone;
@@ -0,0 +1,15 @@
+-- last_read_message_id is not a foreign key so deleting the last read message doesn't lose the user's place.
+CREATE TABLE read_state (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER REFERENCES auth(id) ON DELETE CASCADE,
+    channel_id INTEGER REFERENCES channel(id) ON DELETE CASCADE,
+    last_read_message_id INTEGER NOT NULL DEFAULT 0,
+    created_date TIMESTAMPTZ DEFAULT (NOW() AT TIME ZONE 'utc'),
+    updated_date TIMESTAMPTZ DEFAULT (NOW() AT TIME ZONE 'utc'),
+    UNIQUE (user_id, channel_id)
+);
+
+CREATE INDEX idx_message_channel_id_id ON message (channel_id, id);
+
+-- message_count was never kept up to date before messages started updating it.
+UPDATE channel c SET message_count = (SELECT count(*) FROM message m WHERE m.channel_id = c.id);
@@ -0,0 +1,29 @@
+-- status is the status the user picked. connections is the number of websocket connections the user has open
+-- across every server, which decides if the user is shown as online at all.
+CREATE TABLE presence (
+    user_id INTEGER PRIMARY KEY REFERENCES auth(id) ON DELETE CASCADE,
+    status TEXT NOT NULL DEFAULT 'online' CHECK (status IN ('online', 'idle', 'dnd', 'offline')),
+    custom_status TEXT,
+    custom_status_expires_date TIMESTAMPTZ,
+    connections INTEGER NOT NULL DEFAULT 0,
+    created_date TIMESTAMPTZ DEFAULT (NOW() AT TIME ZONE 'utc'),
+    updated_date TIMESTAMPTZ DEFAULT (NOW() AT TIME ZONE 'utc')
+);
+
+-- user_presence is what other users see. Users without connections, or that picked offline to appear invisible,
+-- are offline and their custom status is hidden along with expired ones.
+CREATE VIEW user_presence AS
+SELECT
+    a.id AS user_id,
+    CASE WHEN coalesce(p.connections, 0) = 0 THEN 'offline' ELSE p.status END AS status,
+    CASE
+        WHEN coalesce(p.connections, 0) = 0 OR p.status = 'offline' THEN ''
+        WHEN p.custom_status_expires_date IS NOT NULL AND p.custom_status_expires_date <= (NOW() AT TIME ZONE 'utc') THEN ''
+        ELSE coalesce(p.custom_status, '')
+    END AS custom_status,
+    CASE
+        WHEN coalesce(p.connections, 0) = 0 OR p.status = 'offline' OR coalesce(p.custom_status, '') = '' THEN NULL
+        ELSE p.custom_status_expires_date
+    END AS custom_status_expires_date
+FROM auth a
+LEFT JOIN presence p ON p.user_id = a.id;
@@ -0,0 +1,10 @@
+CREATE TABLE channel_pin (
+    id SERIAL PRIMARY KEY,
+    channel_id INTEGER REFERENCES channel(id) ON DELETE CASCADE,
+    message_id INTEGER REFERENCES message(id) ON DELETE CASCADE,
+    pinned_by INTEGER REFERENCES auth(id) ON DELETE SET NULL,
+    created_date TIMESTAMPTZ DEFAULT (NOW() AT TIME ZONE 'utc'),
+    UNIQUE (message_id)
+);
+
+CREATE INDEX idx_channel_pin_channel_id ON channel_pin (channel_id);
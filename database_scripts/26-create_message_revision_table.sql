@@ -0,0 +1,14 @@
+-- Each revision is a previous version of a message's content, dated when that version was written.
+CREATE TABLE message_revision (
+    id SERIAL PRIMARY KEY,
+    message_id INTEGER REFERENCES message(id) ON DELETE CASCADE,
+    content TEXT,
+    created_date TIMESTAMPTZ DEFAULT (NOW() AT TIME ZONE 'utc')
+);
+
+CREATE INDEX idx_message_revision_message_id ON message_revision (message_id);
+
+-- Deleted messages are kept as tombstones so moderators are able to review them.
+-- Deleting the whole channel or guild still removes its messages, tombstones included, since there is nothing left to moderate.
+ALTER TABLE message ADD COLUMN deleted_date TIMESTAMPTZ;
+ALTER TABLE message ADD COLUMN deleted_by INTEGER REFERENCES auth(id) ON DELETE SET NULL;
@@ -0,0 +1,12 @@
+-- The log is removed along with its guild, once the guild is deleted there is nobody left to review it.
+CREATE TABLE audit_log (
+    id SERIAL PRIMARY KEY,
+    guild_id INTEGER REFERENCES guild(id) ON DELETE CASCADE,
+    user_id INTEGER REFERENCES auth(id) ON DELETE SET NULL,
+    action TEXT NOT NULL,
+    target_id INTEGER,
+    details JSONB NOT NULL DEFAULT '{}',
+    created_date TIMESTAMPTZ DEFAULT (NOW() AT TIME ZONE 'utc')
+);
+
+CREATE INDEX idx_audit_log_guild_id ON audit_log (guild_id, id DESC);
@@ -0,0 +1,13 @@
+-- Only a hash of the ticket is stored since the ticket itself is enough to connect as the user.
+CREATE TABLE websocket_ticket (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER REFERENCES auth(id) ON DELETE CASCADE,
+    ticket_hash TEXT NOT NULL UNIQUE,
+    expires_date TIMESTAMPTZ NOT NULL,
+    created_date TIMESTAMPTZ DEFAULT (NOW() AT TIME ZONE 'utc')
+);
+
+CREATE INDEX idx_websocket_ticket_user_id ON websocket_ticket (user_id);
+
+-- Websockets are authenticated with tickets now, so the long-lived token is no longer needed.
+ALTER TABLE auth DROP COLUMN websocket_token;
@@ -0,0 +1,38 @@
+-- Connections are counted per server instead of in presence so users aren't left online by a server that stopped
+-- without disconnecting them. Servers refresh heartbeat_date on their rows while running and clear them on startup,
+-- and rows that haven't been refreshed within the expiry are ignored and eventually deleted.
+CREATE TABLE presence_connection (
+    server_id TEXT NOT NULL,
+    user_id INTEGER NOT NULL REFERENCES auth(id) ON DELETE CASCADE,
+    connections INTEGER NOT NULL,
+    heartbeat_date TIMESTAMPTZ NOT NULL DEFAULT (NOW() AT TIME ZONE 'utc'),
+    PRIMARY KEY (user_id, server_id)
+);
+
+CREATE INDEX presence_connection_server_id_idx ON presence_connection (server_id);
+
+DROP VIEW user_presence;
+ALTER TABLE presence DROP COLUMN connections;
+
+-- The 90 seconds must match models.PresenceHeartbeatExpiry.
+CREATE VIEW user_presence AS
+SELECT
+    a.id AS user_id,
+    CASE WHEN NOT connected.value THEN 'offline' ELSE coalesce(p.status, 'online') END AS status,
+    CASE
+        WHEN NOT connected.value OR p.status = 'offline' THEN ''
+        WHEN p.custom_status_expires_date IS NOT NULL AND p.custom_status_expires_date <= (NOW() AT TIME ZONE 'utc') THEN ''
+        ELSE coalesce(p.custom_status, '')
+    END AS custom_status,
+    CASE
+        WHEN NOT connected.value OR p.status = 'offline' OR coalesce(p.custom_status, '') = '' THEN NULL
+        ELSE p.custom_status_expires_date
+    END AS custom_status_expires_date
+FROM auth a
+LEFT JOIN presence p ON p.user_id = a.id
+CROSS JOIN LATERAL (
+    SELECT EXISTS (
+        SELECT 1 FROM presence_connection c
+        WHERE c.user_id = a.id AND c.heartbeat_date > (NOW() AT TIME ZONE 'utc') - INTERVAL '90 seconds'
+    ) AS value
+) connected;
@@ -53,7 +53,15 @@ func main() {
 		panic(err)
 	}
 
-	websocketServer := services.NewWebsocketServer(ctx, logger)
+	var broadcaster services.WebsocketBroadcaster
+	switch config.WebsocketBroadcaster {
+	case "postgres":
+		broadcaster = data.NewPostgresBroadcaster(database, config.ConnectionString, logger)
+	default:
+		broadcaster = services.NewMemoryBroadcaster()
+	}
+
+	websocketServer := services.NewWebsocketServer(ctx, logger, broadcaster)
 	go websocketServer.Run()
 
 	server := app.CreateApp(logger, jwtHandler)
@@ -70,29 +78,51 @@ func main() {
 	controllers.NewGuildController(
 		logger,
 		database,
+		websocketServer,
 	).RegisterRoutes(&server)
 	controllers.NewMessageController(
 		logger,
 		database,
+		websocketServer,
 	).RegisterRoutes(&server)
-	controllers.NewWebsocketController(
+	websocketController := controllers.NewWebsocketController(
 		database,
 		logger,
 		websocketServer,
 		config.JWTConfig.Audience,
 		pushNotification,
+		config.ServerId,
+	)
+	if err := websocketController.ClearPresence(ctx); err != nil {
+		panic(err)
+	}
+	go websocketController.TrackPresence(ctx)
+	websocketController.RegisterRoutes(&server)
+	controllers.NewPushNotificationController(
+		logger,
+		database,
 	).RegisterRoutes(&server)
-	controllers.NewMemberController(
+	controllers.NewProfileController(
 		logger,
 		database,
 	).RegisterRoutes(&server)
-	controllers.NewPushNotificationController(
+	controllers.NewRoleController(
 		logger,
 		database,
 	).RegisterRoutes(&server)
-	controllers.NewProfileController(
+	controllers.NewInviteController(
+		logger,
+		database,
+	).RegisterRoutes(&server)
+	controllers.NewDirectMessageController(
 		logger,
 		database,
+		websocketServer,
+	).RegisterRoutes(&server)
+	controllers.NewPresenceController(
+		logger,
+		database,
+		websocketServer,
 	).RegisterRoutes(&server)
 
 	mux := middleware.RequestLog(server, logger)
@@ -0,0 +1,81 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	AuditChannelCreate    = "channel_create"
+	AuditChannelUpdate    = "channel_update"
+	AuditChannelDelete    = "channel_delete"
+	AuditChannelReorder   = "channel_reorder"
+	AuditMemberAdd        = "member_add"
+	AuditMemberKick       = "member_kick"
+	AuditMemberBan        = "member_ban"
+	AuditMemberUnban      = "member_unban"
+	AuditRoleCreate       = "role_create"
+	AuditRoleUpdate       = "role_update"
+	AuditRoleDelete       = "role_delete"
+	AuditMemberRoleAdd    = "member_role_add"
+	AuditMemberRoleRemove = "member_role_remove"
+	AuditInviteCreate     = "invite_create"
+	AuditInviteRevoke     = "invite_revoke"
+	AuditGuildUpdate      = "guild_update"
+)
+
+const (
+	DefaultAuditLogLimit = 50
+	MaxAuditLogLimit     = 100
+)
+
+var auditLogActions = map[string]bool{
+	AuditChannelCreate:    true,
+	AuditChannelUpdate:    true,
+	AuditChannelDelete:    true,
+	AuditChannelReorder:   true,
+	AuditMemberAdd:        true,
+	AuditMemberKick:       true,
+	AuditMemberBan:        true,
+	AuditMemberUnban:      true,
+	AuditRoleCreate:       true,
+	AuditRoleUpdate:       true,
+	AuditRoleDelete:       true,
+	AuditMemberRoleAdd:    true,
+	AuditMemberRoleRemove: true,
+	AuditInviteCreate:     true,
+	AuditInviteRevoke:     true,
+	AuditGuildUpdate:      true,
+}
+
+func IsValidAuditLogAction(action string) bool {
+	return auditLogActions[action]
+}
+
+// AuditLogEntry records an administrative action taken in a guild.
+// The target is the id of whatever the action was taken on, such as the channel, member or role,
+// and details holds a snapshot of the change.
+type AuditLogEntry struct {
+	ID          int32           `json:"id" db:"id"`
+	GuildId     int32           `json:"guild_id" db:"guild_id"`
+	UserId      int32           `json:"user_id" db:"user_id"`
+	Username    string          `json:"username" db:"username"`
+	Action      string          `json:"action" db:"action"`
+	TargetId    *int32          `json:"target_id,omitempty" db:"target_id"`
+	Details     json.RawMessage `json:"details" db:"details"`
+	CreatedDate *time.Time      `json:"created_date,omitempty" db:"created_date"`
+}
+
+// AuditLogQuery pages backwards through the audit log starting before the entry id.
+// The user and action filters are optional.
+type AuditLogQuery struct {
+	Before int32
+	Limit  int32
+	UserId int32
+	Action string
+}
+
+type AuditLogPage struct {
+	Entries []AuditLogEntry `json:"entries"`
+	HasMore bool            `json:"has_more"`
+}
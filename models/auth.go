@@ -15,9 +15,9 @@ type AuthUser struct {
 	Avatar          *string    `json:"avatar_url,omitempty" db:"avatar_url"`
 	Token           string     `json:"token,omitempty"`
 	RefreshToken    string     `json:"refresh_token,omitempty" db:"refresh_token"`
-	WebsocketToken  string     `json:"websocket_token,omitempty" db:"websocket_token"`
 	Turnstile       string     `json:"turnstile,omitempty"`
 	UserHandle      []byte     `json:"userHandle,omitempty" db:"user_handle"`
+	Presence        *Presence  `json:"presence,omitempty" db:"-"`
 	CreatedDate     *time.Time `json:"created_date,omitempty" db:"created_date"`
 	UpdatedDate     *time.Time `json:"updated_date,omitempty" db:"updated_date"`
 }
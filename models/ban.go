@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+type Ban struct {
+	ID       int32  `json:"id,omitempty" db:"id"`
+	GuildId  int32  `json:"guild_id,omitempty" db:"guild_id"`
+	UserId   int32  `json:"user_id,omitempty" db:"user_id"`
+	Username string `json:"username,omitempty" db:"username"`
+	// BannedBy is nil once the user who created the ban has deleted their account.
+	BannedBy *int32 `json:"banned_by,omitempty" db:"banned_by"`
+	Reason   string `json:"reason,omitempty" db:"reason"`
+	// Duration is the number of seconds the ban lasts for. It's only used while creating a ban.
+	Duration    int32      `json:"duration,omitempty"`
+	ExpiresDate *time.Time `json:"expires_date,omitempty" db:"expires_date"`
+	CreatedDate *time.Time `json:"created_date,omitempty" db:"created_date"`
+	UpdatedDate *time.Time `json:"updated_date,omitempty" db:"updated_date"`
+}
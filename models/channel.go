@@ -2,13 +2,42 @@ package models
 
 import "time"
 
+const (
+	ChannelTypeGuild              = "guild"
+	ChannelTypeDirectMessage      = "dm"
+	ChannelTypeGroupDirectMessage = "group_dm"
+	// The most users allowed in a group direct message, including the user that created it.
+	MaxGroupDirectMessageMembers = 10
+)
+
 type Channel struct {
-	ID           int32      `json:"id,omitempty" db:"id"`
-	Name         string     `json:"name,omitempty" db:"name"`
-	MessageCount string     `json:"message_count,omitempty" db:"message_count"`
-	GuildId      int32      `json:"guild_id,omitempty" db:"guild_id"`
-	CreatedDate  *time.Time `json:"created_date,omitempty" db:"created_date"`
-	UpdatedDate  *time.Time `json:"updated_date,omitempty" db:"updated_date"`
+	ID           int32  `json:"id,omitempty" db:"id"`
+	Name         string `json:"name,omitempty" db:"name"`
+	MessageCount string `json:"message_count,omitempty" db:"message_count"`
+	GuildId      int32  `json:"guild_id,omitempty" db:"guild_id"`
+	Position     int32  `json:"position" db:"position"`
+	Type         string `json:"type,omitempty" db:"type"`
+	// Members is only collected for direct message channels because guild channels share the guild's members.
+	Members []AuthUser `json:"members,omitempty"`
+	// ReadState is only collected when the channels are listed for the user they belong to.
+	ReadState   *ReadState `json:"read_state,omitempty" db:"-"`
+	CreatedDate *time.Time `json:"created_date,omitempty" db:"created_date"`
+	UpdatedDate *time.Time `json:"updated_date,omitempty" db:"updated_date"`
 }
 
 func (m Channel) WebsocketData() {}
+
+// ChannelOrder is used to move many channels within a guild at once.
+type ChannelOrder struct {
+	GuildId  int32     `json:"guild_id"`
+	Channels []Channel `json:"channels"`
+}
+
+func (c ChannelOrder) WebsocketData() {}
+
+// DirectMessageRequest is used to start a conversation outside of a guild.
+// A single user creates a direct message while multiple users create a group direct message.
+type DirectMessageRequest struct {
+	UserIds []int32 `json:"user_ids"`
+	Name    string  `json:"name,omitempty"`
+}
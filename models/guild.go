@@ -12,3 +12,13 @@ type Guild struct {
 	CreatedDate *time.Time `json:"created_date,omitempty" db:"created_date"`
 	UpdatedDate *time.Time `json:"updated_date,omitempty" db:"updated_date"`
 }
+
+func (g Guild) WebsocketData() {}
+
+// GuildUpdate changes the name or description of a guild. Anything left out of the request is kept as it is,
+// and an empty description clears it.
+type GuildUpdate struct {
+	ID          int32   `json:"-"`
+	Name        string  `json:"name,omitempty"`
+	Description *string `json:"description,omitempty"`
+}
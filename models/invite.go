@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+type Invite struct {
+	ID        int32  `json:"id,omitempty" db:"id"`
+	Code      string `json:"code,omitempty" db:"code"`
+	GuildId   int32  `json:"guild_id,omitempty" db:"guild_id"`
+	CreatedBy int32  `json:"created_by,omitempty" db:"created_by"`
+	Creator   string `json:"creator,omitempty" db:"creator"`
+	// A nil MaxUses allows the invite to be used until it expires or is revoked.
+	MaxUses *int32 `json:"max_uses,omitempty" db:"max_uses"`
+	Uses    int32  `json:"uses" db:"uses"`
+	// MaxAge is the number of seconds the invite is valid for. It's only used while creating an invite.
+	MaxAge      int32      `json:"max_age,omitempty"`
+	ExpiresDate *time.Time `json:"expires_date,omitempty" db:"expires_date"`
+	Revoked     bool       `json:"revoked,omitempty" db:"revoked"`
+	CreatedDate *time.Time `json:"created_date,omitempty" db:"created_date"`
+	UpdatedDate *time.Time `json:"updated_date,omitempty" db:"updated_date"`
+}
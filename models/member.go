@@ -11,3 +11,5 @@ type Member struct {
 	CreatedDate  *time.Time `json:"created_date,omitempty" db:"created_date"`
 	UpdatedDate  *time.Time `json:"updated_date,omitempty" db:"updated_date"`
 }
+
+func (m Member) WebsocketData() {}
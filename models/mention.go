@@ -0,0 +1,49 @@
+package models
+
+import (
+	"regexp"
+	"slices"
+	"strconv"
+)
+
+// Mentions past this number are ignored so a single message can't notify an unbounded number of users and roles.
+const MaxMessageMentions = 50
+
+var (
+	userMentionPattern     = regexp.MustCompile(`<@(\d+)>`)
+	roleMentionPattern     = regexp.MustCompile(`<@&(\d+)>`)
+	everyoneMentionPattern = regexp.MustCompile(`(^|[^\w<])@everyone\b`)
+)
+
+// MessageMentions is the structured form of the mentions written in a message.
+// Users are written as <@userId>, roles as <@&roleId> and everyone in the channel as @everyone.
+type MessageMentions struct {
+	Users    []int32 `json:"users"`
+	Roles    []int32 `json:"roles"`
+	Everyone bool    `json:"everyone"`
+}
+
+// ParseMentions collects the distinct user and role ids mentioned in the content, in the order they were written.
+// It does not check that the users or roles exist, or that the author is allowed to mention everyone.
+func ParseMentions(content string) *MessageMentions {
+	return &MessageMentions{
+		Users:    parseMentionIds(userMentionPattern, content),
+		Roles:    parseMentionIds(roleMentionPattern, content),
+		Everyone: everyoneMentionPattern.MatchString(content),
+	}
+}
+
+func parseMentionIds(pattern *regexp.Regexp, content string) []int32 {
+	output := make([]int32, 0)
+	for _, match := range pattern.FindAllStringSubmatch(content, -1) {
+		id, err := strconv.ParseInt(match[1], 10, 32)
+		if err != nil || id <= 0 || slices.Contains(output, int32(id)) {
+			continue
+		}
+		output = append(output, int32(id))
+		if len(output) == MaxMessageMentions {
+			break
+		}
+	}
+	return output
+}
@@ -2,20 +2,107 @@ package models
 
 import "time"
 
+// Message.ReplyTo is nil when the original message has been deleted.
+// Message.ThreadId is the id of the message the thread was started from.
 type Message struct {
-	ID            int32      `json:"id,omitempty" db:"id"`
-	ChannelID     int32      `json:"channel_id,omitempty" db:"channel_id"`
-	Channel       string     `json:"channel" db:"channel_name"`
-	GuildID       int32      `json:"guild_id" db:"guild_id"`
-	Guild         string     `json:"guild" db:"guild_name"`
-	Author        string     `json:"author,omitempty" db:"author"`
-	AuthorId      int32      `json:"author_id,omitempty" db:"author_id"`
-	AuthorAvatar  string     `json:"author_avatar,omitempty" db:"author_avatar"`
-	Content       string     `json:"content,omitempty" db:"content"`
-	AttachmentIDs []int32    `json:"attachment_ids,omitempty"`
-	Attachment    []string   `json:"attachments,omitempty"`
-	CreatedDate   *time.Time `json:"created_date,omitempty" db:"created_date"`
-	UpdatedDate   *time.Time `json:"updated_date,omitempty" db:"updated_date"`
+	ID            int32             `json:"id,omitempty" db:"id"`
+	ChannelID     int32             `json:"channel_id,omitempty" db:"channel_id"`
+	Channel       string            `json:"channel" db:"channel_name"`
+	GuildID       int32             `json:"guild_id" db:"guild_id"`
+	Guild         string            `json:"guild" db:"guild_name"`
+	Author        string            `json:"author,omitempty" db:"author"`
+	AuthorId      int32             `json:"author_id,omitempty" db:"author_id"`
+	AuthorAvatar  string            `json:"author_avatar,omitempty" db:"author_avatar"`
+	Content       string            `json:"content,omitempty" db:"content"`
+	ReplyToId     *int32            `json:"reply_to_id,omitempty" db:"reply_to_id"`
+	ReplyTo       *MessageReference `json:"reply_to,omitempty" db:"-"`
+	ThreadId      *int32            `json:"thread_id,omitempty" db:"thread_id"`
+	ThreadCount   int32             `json:"thread_count,omitempty" db:"thread_count"`
+	Pinned        bool              `json:"pinned,omitempty" db:"pinned"`
+	Reactions     []Reaction        `json:"reactions,omitempty" db:"-"`
+	Mentions      *MessageMentions  `json:"mentions,omitempty" db:"-"`
+	AttachmentIDs []int32           `json:"attachment_ids,omitempty"`
+	Attachment    []string          `json:"attachments,omitempty"`
+	CreatedDate   *time.Time        `json:"created_date,omitempty" db:"created_date"`
+	UpdatedDate   *time.Time        `json:"updated_date,omitempty" db:"updated_date"`
+	// DeletedDate and DeletedBy are only collected with the history of a message.
+	DeletedDate *time.Time `json:"deleted_date,omitempty" db:"deleted_date"`
+	DeletedBy   *int32     `json:"deleted_by,omitempty" db:"deleted_by"`
 }
 
 func (m Message) WebsocketData() {}
+
+// MessageRevision is a previous version of a message's content. CreatedDate is when that version was written.
+type MessageRevision struct {
+	ID          int32      `json:"id" db:"id"`
+	MessageId   int32      `json:"message_id" db:"message_id"`
+	Content     string     `json:"content" db:"content"`
+	CreatedDate *time.Time `json:"created_date" db:"created_date"`
+}
+
+// MessageHistory is only shown to the author of the message and moderators, even after the message is deleted.
+type MessageHistory struct {
+	Message   Message           `json:"message"`
+	Revisions []MessageRevision `json:"revisions"`
+}
+
+// The number of characters of the original message included with a reply.
+const MessageReferenceLength = 100
+
+// MessageReference is a short snippet of the message being replied to.
+type MessageReference struct {
+	ID       int32  `json:"id" db:"id"`
+	AuthorId int32  `json:"author_id" db:"author_id"`
+	Author   string `json:"author" db:"author"`
+	Content  string `json:"content" db:"content"`
+}
+
+const (
+	DefaultMessageLimit = 50
+	MaxMessageLimit     = 100
+)
+
+// MessageQuery selects a page of messages relative to an anchor message.
+// Only one of Before, After or Around is set. When none are set the newest messages are returned.
+type MessageQuery struct {
+	Before int32
+	After  int32
+	Around int32
+	Limit  int32
+	// ThreadId pages through the messages in a thread instead of the channel.
+	ThreadId int32
+}
+
+// MessagePage is always sorted from oldest to newest.
+type MessagePage struct {
+	Messages []Message `json:"messages"`
+	// HasMoreBefore is true when older messages exist before the page, no matter which cursor was used.
+	HasMoreBefore bool `json:"has_more_before"`
+	// HasMoreAfter is true when newer messages exist after the page, no matter which cursor was used.
+	HasMoreAfter bool `json:"has_more_after"`
+}
+
+const (
+	DefaultSearchLimit = 25
+	MaxSearchLimit     = 100
+)
+
+// MessageSearch holds the text and filters used to search messages. Zero values are not used as filters.
+type MessageSearch struct {
+	Query         string
+	GuildId       int32
+	ChannelId     int32
+	AuthorId      int32
+	Before        *time.Time
+	After         *time.Time
+	HasAttachment bool
+	Limit         int32
+	Offset        int32
+}
+
+type MessageSearchResult struct {
+	Message
+	// Highlight is an HTML escaped snippet of the message with matching words wrapped in <mark> tags.
+	Highlight string  `json:"highlight" db:"highlight"`
+	Rank      float32 `json:"rank" db:"rank"`
+}
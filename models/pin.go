@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// The most messages that can be pinned in a single channel.
+const MaxChannelPins = 50
+
+// Pin is sent over the websocket when a message is pinned or unpinned.
+type Pin struct {
+	ChannelId   int32      `json:"channel_id" db:"channel_id"`
+	GuildId     int32      `json:"guild_id,omitempty" db:"guild_id"`
+	MessageId   int32      `json:"message_id" db:"message_id"`
+	PinnedBy    int32      `json:"pinned_by" db:"pinned_by"`
+	CreatedDate *time.Time `json:"created_date,omitempty" db:"created_date"`
+}
+
+func (p Pin) WebsocketData() {}
+
+type PinnedMessage struct {
+	Message
+	PinnedBy   int32      `json:"pinned_by" db:"pinned_by"`
+	PinnedDate *time.Time `json:"pinned_date" db:"pinned_date"`
+}
@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+const (
+	PresenceOnline       = "online"
+	PresenceIdle         = "idle"
+	PresenceDoNotDisturb = "dnd"
+	// PresenceOffline is shown for users that aren't connected. Picking it while connected makes the user appear invisible.
+	PresenceOffline = "offline"
+
+	MaxCustomStatusLength = 128
+
+	// Every server refreshes the connections it holds this often.
+	PresenceHeartbeatInterval = 30 * time.Second
+	// Connections that haven't been refreshed for this long belong to a server that stopped and are ignored.
+	// The user_presence view uses the same expiry.
+	PresenceHeartbeatExpiry = 90 * time.Second
+)
+
+// Presence is shown to every user that shares a guild with the user.
+// CustomStatusDuration is only used while setting the status and is the number of seconds until the custom status
+// is cleared, where 0 keeps it until it is changed.
+type Presence struct {
+	UserId                  int32      `json:"user_id" db:"user_id"`
+	Status                  string     `json:"status" db:"status"`
+	CustomStatus            string     `json:"custom_status,omitempty" db:"custom_status"`
+	CustomStatusDuration    int32      `json:"custom_status_duration,omitempty" db:"-"`
+	CustomStatusExpiresDate *time.Time `json:"custom_status_expires_date,omitempty" db:"custom_status_expires_date"`
+}
+
+func (p Presence) WebsocketData() {}
+
+func IsValidPresenceStatus(status string) bool {
+	switch status {
+	case PresenceOnline, PresenceIdle, PresenceDoNotDisturb, PresenceOffline:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,110 @@
+package models
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// The most different emoji a single message can be reacted with.
+	MaxMessageReactions = 20
+	// Long enough for family and flag sequences that are made of many code points.
+	maxEmojiLength = 32
+)
+
+// Reaction is the total number of users that reacted to a message with an emoji.
+type Reaction struct {
+	Emoji string `json:"emoji" db:"emoji"`
+	Count int32  `json:"count" db:"count"`
+	// Me is true when the user that requested the message has reacted with the emoji.
+	Me bool `json:"me" db:"me"`
+}
+
+// ReactionEvent is sent over the websocket when a user adds or removes a reaction.
+type ReactionEvent struct {
+	MessageId int32  `json:"message_id"`
+	ChannelId int32  `json:"channel_id"`
+	GuildId   int32  `json:"guild_id,omitempty"`
+	UserId    int32  `json:"user_id"`
+	Emoji     string `json:"emoji"`
+}
+
+func (r ReactionEvent) WebsocketData() {}
+
+// IsValidEmoji makes sure the value is a single Unicode emoji: one emoji followed only by modifiers, a pair of
+// regional indicators for a flag, a keycap, or emoji joined into one with zero width joiners.
+// It does not check that the sequence is an emoji that actually exists.
+func IsValidEmoji(emoji string) bool {
+	if emoji == "" || len(emoji) > maxEmojiLength || !utf8.ValidString(emoji) {
+		return false
+	}
+
+	// joined is true when the next emoji continues the sequence, which is only at the start and after a joiner.
+	joined := true
+	// unpaired is true after the first regional indicator of a flag.
+	unpaired := false
+	hasEmoji := false
+	for i, r := range emoji {
+		switch {
+		case r == 0x200D:
+			if joined || unpaired {
+				return false
+			}
+			joined = true
+		case r == 0xFE0F, r == 0x20E3, r >= 0x1F3FB && r <= 0x1F3FF, r >= 0xE0020 && r <= 0xE007F:
+			// Variation selectors, keycaps, skin tones and tag sequences only modify the emoji before them.
+			if joined || unpaired {
+				return false
+			}
+		case r >= 0x1F1E6 && r <= 0x1F1FF:
+			if unpaired {
+				unpaired = false
+				continue
+			}
+			if !joined {
+				return false
+			}
+			joined, unpaired, hasEmoji = false, true, true
+		case isEmojiCodePoint(r):
+			if !joined {
+				return false
+			}
+			joined, hasEmoji = false, true
+		case r == '#' || r == '*' || (r >= '0' && r <= '9'):
+			// Keycap emoji start with a plain character followed by the keycap modifiers.
+			if i != 0 {
+				return false
+			}
+			joined = false
+		default:
+			return false
+		}
+	}
+
+	if joined || unpaired {
+		return false
+	}
+	return hasEmoji || strings.HasSuffix(emoji, "\u20E3")
+}
+
+func isEmojiCodePoint(r rune) bool {
+	switch {
+	case r >= 0x1F000 && r <= 0x1FAFF:
+		return true
+	case r >= 0x2600 && r <= 0x27BF:
+		return true
+	case r >= 0x2300 && r <= 0x23FF:
+		return true
+	case r >= 0x2B00 && r <= 0x2BFF:
+		return true
+	case r == 0x00A9 || r == 0x00AE || r == 0x203C || r == 0x2049 || r == 0x2122 || r == 0x2139:
+		return true
+	case r >= 0x2190 && r <= 0x21FF:
+		return true
+	case r == 0x24C2 || r == 0x25AA || r == 0x25AB || r == 0x25B6 || r == 0x25C0 || (r >= 0x25FB && r <= 0x25FE):
+		return true
+	case r == 0x3030 || r == 0x303D || r == 0x3297 || r == 0x3299:
+		return true
+	}
+	return false
+}
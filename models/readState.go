@@ -0,0 +1,13 @@
+package models
+
+// ReadState is how far a user has read in a channel. Messages sent by the user are never counted as unread.
+type ReadState struct {
+	ChannelId         int32 `json:"channel_id" db:"channel_id"`
+	GuildId           int32 `json:"guild_id,omitempty" db:"guild_id"`
+	LastReadMessageId int32 `json:"last_read_message_id" db:"last_read_message_id"`
+	UnreadCount       int32 `json:"unread_count" db:"unread_count"`
+	// MentionCount is the number of unread messages that mention the user directly, through a role or with @everyone.
+	MentionCount int32 `json:"mention_count" db:"mention_count"`
+}
+
+func (r ReadState) WebsocketData() {}
@@ -2,18 +2,99 @@ package models
 
 import "time"
 
+// Permission is a bitfield of the actions a member is allowed to take within a guild.
+// Each bit is stored as its own role_intent row so roles can be granted and revoked one intent at a time.
+type Permission int32
+
+const (
+	PermissionViewChannel Permission = 1 << iota
+	PermissionSendMessages
+	PermissionAttachFiles
+	PermissionInviteMembers
+	PermissionManageMessages
+	PermissionManageChannels
+	PermissionKickMembers
+	PermissionBanMembers
+	PermissionManageRoles
+	PermissionManageGuild
+	// Administrator grants every permission, including ones added after the role was created.
+	PermissionAdministrator
+	PermissionAddReactions
+	// MentionEveryone allows @everyone to notify every user that can see the channel.
+	PermissionMentionEveryone
+
+	// New permissions must be added above this line so PermissionAll stays correct.
+	permissionEnd
+)
+
+const (
+	// PermissionAll should only be used for guild owners and administrators.
+	PermissionAll Permission = permissionEnd - 1
+	// PermissionDefault is given to every member of a guild regardless of their roles.
+	PermissionDefault Permission = PermissionViewChannel | PermissionSendMessages | PermissionAttachFiles | PermissionInviteMembers |
+		PermissionAddReactions
+	// PermissionDirectMessage is given to every participant of a direct message. Nobody is able to moderate them.
+	PermissionDirectMessage Permission = PermissionViewChannel | PermissionSendMessages | PermissionAttachFiles | PermissionAddReactions
+)
+
+// Has returns true only when every bit in permission is set.
+func (p Permission) Has(permission Permission) bool {
+	return p&permission == permission
+}
+
+// Intents splits the permission into the individual bits that are stored in role_intent.
+func (p Permission) Intents() []Permission {
+	output := make([]Permission, 0)
+	for bit := Permission(1); bit < permissionEnd; bit <<= 1 {
+		if p&bit != 0 {
+			output = append(output, bit)
+		}
+	}
+	return output
+}
+
+// ResolvePermissions combines the permissions granted through a member's roles with the guild defaults.
+func ResolvePermissions(isOwner bool, granted Permission) Permission {
+	if isOwner || granted.Has(PermissionAdministrator) {
+		return PermissionAll
+	}
+	return (PermissionDefault | granted) & PermissionAll
+}
+
+// CanModerate returns true when the actor is allowed to kick or ban the target. The guild owner can moderate every
+// other member, while everyone else can only moderate members that have fewer permissions than they do and none
+// they lack, so moderators can't remove administrators or each other.
+func CanModerate(actorIsOwner bool, actor Permission, targetIsOwner bool, target Permission) bool {
+	if targetIsOwner {
+		return false
+	}
+	if actorIsOwner {
+		return true
+	}
+	return actor.Has(target) && actor != target
+}
+
 type Intent struct {
-	ID          int32      `json:"id,omitempty"`
-	RoleID      int32      `json:"role_id,omitempty"`
-	Value       int32      `json:"value,omitempty"`
-	CreatedDate *time.Time `json:"created_date,omitempty"`
-	UpdatedDate *time.Time `json:"updated_date,omitempty"`
+	ID          int32      `json:"id,omitempty" db:"id"`
+	RoleID      int32      `json:"role_id,omitempty" db:"role_id"`
+	Value       int32      `json:"value,omitempty" db:"value"`
+	CreatedDate *time.Time `json:"created_date,omitempty" db:"created_date"`
+	UpdatedDate *time.Time `json:"updated_date,omitempty" db:"updated_date"`
 }
 
 type Role struct {
-	ID          int32      `json:"id,omitempty"`
-	Name        string     `json:"name,omitempty"`
-	GuildId     int32      `json:"guild_id,omitempty"`
-	CreatedDate *time.Time `json:"created_date,omitempty"`
-	UpdatedDate *time.Time `json:"updated_date,omitempty"`
+	ID          int32      `json:"id,omitempty" db:"id"`
+	Name        string     `json:"name,omitempty" db:"name"`
+	GuildId     int32      `json:"guild_id,omitempty" db:"guild_id"`
+	Permissions Permission `json:"permissions" db:"permissions"`
+	CreatedDate *time.Time `json:"created_date,omitempty" db:"created_date"`
+	UpdatedDate *time.Time `json:"updated_date,omitempty" db:"updated_date"`
+}
+
+// RoleUpdate changes the name or permissions of a role. Anything left out of the request is kept as it is.
+type RoleUpdate struct {
+	ID          int32       `json:"-"`
+	GuildId     int32       `json:"-"`
+	Name        string      `json:"name,omitempty"`
+	Permissions *Permission `json:"permissions,omitempty"`
 }
@@ -0,0 +1,11 @@
+package models
+
+// Typing is sent by clients as typing_start while the user is writing a message in a channel.
+// The server fills in who is typing before relaying it to the rest of the channel.
+type Typing struct {
+	ChannelId int32  `json:"channel_id"`
+	UserId    int32  `json:"user_id,omitempty"`
+	Username  string `json:"username,omitempty"`
+}
+
+func (t Typing) WebsocketData() {}
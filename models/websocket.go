@@ -3,6 +3,7 @@ package models
 import (
 	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/coder/websocket"
 )
@@ -17,16 +18,26 @@ type WebsocketMessageData interface {
 type WebsocketMessageWrapper struct {
 	Type string          `json:"type"`
 	Data json.RawMessage `json:"data,omitempty"`
+	// Seq is only set on events sent by the server. It increases by one for every event sent to the session.
+	Seq int64 `json:"seq,omitempty"`
+	// Nonce is chosen by the client so it can match the ack or error sent back to it with what it sent.
+	Nonce string `json:"nonce,omitempty"`
 }
 
 func (wm *WebsocketMessageWrapper) ToMessage() (*WebsocketMessage, error) {
 	var data WebsocketMessageData
 
 	switch wm.Type {
-	case "message":
+	case "message", "message_update", "message_delete":
 		data = &Message{}
 	case "channel":
 		data = &Channel{}
+	case "typing_start":
+		data = &Typing{}
+	case "resume":
+		data = &WebsocketSession{}
+	case "subscribe", "unsubscribe":
+		data = &WebsocketTopic{}
 	case "":
 		return nil, fmt.Errorf("no type was provided to the message")
 	default:
@@ -39,36 +50,173 @@ func (wm *WebsocketMessageWrapper) ToMessage() (*WebsocketMessage, error) {
 		}
 	}
 
-	return &WebsocketMessage{wm.Type, data}, nil
+	return &WebsocketMessage{Type: wm.Type, Data: data, Nonce: wm.Nonce}, nil
 }
 
 // This is what is used in the handler to process and send data to the websocket server.
 type WebsocketMessage struct {
 	Type string               `json:"type"`
 	Data WebsocketMessageData `json:"data,omitempty"`
+	// Nonce is only kept to reply to the sender and isn't sent to the other receivers.
+	Nonce string `json:"-"`
+	// Topic is set on high volume events so they only reach sessions that are viewing what the event is about.
+	Topic *WebsocketTopic `json:"-"`
 }
 
 func NewWebsocketMessage(dataType string, data WebsocketMessageData) *WebsocketMessage {
 	return &WebsocketMessage{
-		dataType,
-		data,
+		Type: dataType,
+		Data: data,
 	}
 }
 
+const MaxWebsocketNonceLength = 64
+
+// Error codes sent to the client in an error event.
+const (
+	WebsocketErrorValidation  = "validation"
+	WebsocketErrorPermission  = "permission"
+	WebsocketErrorNotFound    = "not_found"
+	WebsocketErrorRateLimited = "rate_limited"
+	WebsocketErrorInternal    = "internal"
+)
+
+// WebsocketAck is sent only to the connection that sent the nonce once its event has been handled.
+// Data is what was created or changed, such as the new message.
+type WebsocketAck struct {
+	Nonce string               `json:"nonce"`
+	Type  string               `json:"type"`
+	Data  WebsocketMessageData `json:"data,omitempty"`
+}
+
+func (a WebsocketAck) WebsocketData() {}
+
+// WebsocketError is sent only to the connection whose event was not able to be handled.
+type WebsocketError struct {
+	Nonce   string `json:"nonce,omitempty"`
+	Type    string `json:"type"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e WebsocketError) WebsocketData() {}
+
+// WebsocketEvent is a message that has already been serialized so it can be shared between servers.
+type WebsocketEvent struct {
+	Type    string          `json:"type"`
+	Data    json.RawMessage `json:"data,omitempty"`
+	Targets []int32         `json:"targets"`
+	Topic   *WebsocketTopic `json:"topic,omitempty"`
+}
+
+func NewWebsocketEvent(message *WebsocketMessage, targets map[int32]bool) (*WebsocketEvent, error) {
+	var data json.RawMessage
+	if message.Data != nil {
+		bytes, err := json.Marshal(message.Data)
+		if err != nil {
+			return nil, fmt.Errorf("an error occurred while marshaling %s event data: %v", message.Type, err)
+		}
+		data = bytes
+	}
+
+	eventTargets := make([]int32, 0, len(targets))
+	for userId := range targets {
+		eventTargets = append(eventTargets, userId)
+	}
+
+	return &WebsocketEvent{
+		Type:    message.Type,
+		Data:    data,
+		Targets: eventTargets,
+		Topic:   message.Topic,
+	}, nil
+}
+
+// Frame is what gets written to the client's connection.
+func (e *WebsocketEvent) Frame(seq int64) ([]byte, error) {
+	return json.Marshal(WebsocketMessageWrapper{Type: e.Type, Data: e.Data, Seq: seq})
+}
+
+// WebsocketSession is sent to the client in ready and resumed, and sent back by the client in resume
+// with the sequence number of the last event it received.
+type WebsocketSession struct {
+	SessionId string `json:"session_id"`
+	Seq       int64  `json:"seq"`
+}
+
+func (s WebsocketSession) WebsocketData() {}
+
+// Application close codes sent when the server ends a connection, so clients can decide whether to reconnect,
+// resume their session or ask the user to log in again.
+const (
+	// No heartbeat was received within the interval advertised in hello. The session can be resumed.
+	CloseHeartbeatTimeout websocket.StatusCode = 4000
+	// The ticket was missing, invalid or expired. A new ticket is needed before reconnecting.
+	CloseAuthenticationFailed websocket.StatusCode = 4001
+	// The client sent more than the server allows. Clients should wait before reconnecting.
+	CloseRateLimited websocket.StatusCode = 4002
+	// Another connection resumed the session. The closed connection should not reconnect.
+	CloseSessionReplaced websocket.StatusCode = 4003
+	// The server is restarting. The client can reconnect and resume right away.
+	CloseServerShutdown websocket.StatusCode = 4004
+	// The client sent a message that could not be read, such as invalid json or a binary message.
+	CloseProtocolError websocket.StatusCode = 4005
+)
+
+// WebsocketHello is the first message sent on every connection. Clients are expected to send heartbeat
+// every HeartbeatInterval milliseconds, which the server answers with heartbeat_ack.
+type WebsocketHello struct {
+	HeartbeatInterval int64 `json:"heartbeat_interval"`
+}
+
+func (h WebsocketHello) WebsocketData() {}
+
+// The most guilds and channels a single session can be subscribed to.
+const MaxWebsocketSubscriptions = 200
+
+// WebsocketTopic is the guilds and channels a high volume event is about, such as typing and presence.
+// The event is only delivered to sessions subscribed to one of them.
+//
+// Clients send it in subscribe and unsubscribe to choose which guilds and channels they're viewing.
+// Sessions that have never subscribed receive every event. Events without a topic, such as messages,
+// mentions and direct messages, are always delivered.
+type WebsocketTopic struct {
+	GuildIds   []int32 `json:"guild_ids,omitempty"`
+	ChannelIds []int32 `json:"channel_ids,omitempty"`
+}
+
+func (t WebsocketTopic) WebsocketData() {}
+
+// How many seconds a websocket ticket can be used for after it's created.
+const WebsocketTicketLifetime = 30
+
+// WebsocketTicket authenticates a single websocket connection. It's either passed in the ticket query parameter
+// while connecting, or sent as the data of an authenticate message as the first message after connecting.
+type WebsocketTicket struct {
+	Ticket      string     `json:"ticket"`
+	ExpiresDate *time.Time `json:"expires_date,omitempty"`
+}
+
+func (t WebsocketTicket) WebsocketData() {}
+
 type WebsocketCommand struct {
 	Type                string
 	UserId              int32
+	ConnectionId        string
 	Message             *WebsocketMessage
 	Connection          *websocket.Conn
+	Session             *WebsocketSession
+	Topic               *WebsocketTopic
 	NotificationTargets map[int32]bool
 	AcknowledgeChannel  chan<- error
 }
 
-func NewWebsocketConnectCommand(userId int32, conn *websocket.Conn) (*WebsocketCommand, <-chan error) {
+func NewWebsocketConnectCommand(userId int32, connectionId string, conn *websocket.Conn) (*WebsocketCommand, <-chan error) {
 	errorChannel := make(chan error)
 	return &WebsocketCommand{
 			Type:               "connect",
 			UserId:             userId,
+			ConnectionId:       connectionId,
 			Message:            nil,
 			Connection:         conn,
 			AcknowledgeChannel: errorChannel,
@@ -76,11 +224,12 @@ func NewWebsocketConnectCommand(userId int32, conn *websocket.Conn) (*WebsocketC
 		errorChannel
 }
 
-func NewWebsocketDisconnectCommand(userId int32) (*WebsocketCommand, <-chan error) {
+func NewWebsocketDisconnectCommand(userId int32, connectionId string) (*WebsocketCommand, <-chan error) {
 	errorChannel := make(chan error)
 	return &WebsocketCommand{
 			Type:               "disconnect",
 			UserId:             userId,
+			ConnectionId:       connectionId,
 			Message:            nil,
 			AcknowledgeChannel: errorChannel,
 		},
@@ -98,3 +247,43 @@ func NewWebsocketMessageCommand(userId int32, data *WebsocketMessage, targets ma
 		},
 		errorChannel
 }
+
+func NewWebsocketResumeCommand(userId int32, connectionId string, session *WebsocketSession) (*WebsocketCommand, <-chan error) {
+	errorChannel := make(chan error)
+	return &WebsocketCommand{
+			Type:               "resume",
+			UserId:             userId,
+			ConnectionId:       connectionId,
+			Session:            session,
+			AcknowledgeChannel: errorChannel,
+		},
+		errorChannel
+}
+
+func NewWebsocketSubscribeCommand(userId int32, connectionId string, subscribe bool, topic *WebsocketTopic) (*WebsocketCommand, <-chan error) {
+	errorChannel := make(chan error)
+	commandType := "unsubscribe"
+	if subscribe {
+		commandType = "subscribe"
+	}
+	return &WebsocketCommand{
+			Type:               commandType,
+			UserId:             userId,
+			ConnectionId:       connectionId,
+			Topic:              topic,
+			AcknowledgeChannel: errorChannel,
+		},
+		errorChannel
+}
+
+func NewWebsocketReplyCommand(userId int32, connectionId string, data *WebsocketMessage) (*WebsocketCommand, <-chan error) {
+	errorChannel := make(chan error)
+	return &WebsocketCommand{
+			Type:               "reply",
+			UserId:             userId,
+			ConnectionId:       connectionId,
+			Message:            data,
+			AcknowledgeChannel: errorChannel,
+		},
+		errorChannel
+}
@@ -0,0 +1,23 @@
+package services
+
+import (
+	"crypto/rand"
+	"math/big"
+)
+
+const inviteCodeAlphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// GenerateInviteCode creates a random code that is short enough to be shared by hand.
+func GenerateInviteCode() (string, error) {
+	code := make([]byte, 10)
+	max := big.NewInt(int64(len(inviteCodeAlphabet)))
+	for i := range code {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code[i] = inviteCodeAlphabet[n.Int64()]
+	}
+
+	return string(code), nil
+}
@@ -0,0 +1,85 @@
+package services
+
+import (
+	"sync"
+	"time"
+	"tranquility/models"
+)
+
+// How long a nonce is remembered after the event it was sent with has been handled.
+// A retry with the same nonce inside the window is answered with the original ack instead of being handled again.
+var nonceWindow = 2 * time.Minute
+
+type nonceKey struct {
+	userId int32
+	nonce  string
+}
+
+// nonceEntry holds the ack of a handled event. The ack is nil while the event is still being handled.
+type nonceEntry struct {
+	ack   *models.WebsocketAck
+	timer *time.Timer
+}
+
+// nonceTracker is kept in memory like typingTracker, so nonces are only deduplicated on the server that
+// handled the first send.
+type nonceTracker struct {
+	mutex   sync.Mutex
+	entries map[nonceKey]*nonceEntry
+}
+
+func newNonceTracker() *nonceTracker {
+	return &nonceTracker{entries: make(map[nonceKey]*nonceEntry)}
+}
+
+// ClaimNonce returns true when the user hasn't sent the nonce within the window, and the event should be handled.
+// Otherwise it returns the ack of the first send, which is nil while that send is still being handled.
+func (ws *WebsocketServer) ClaimNonce(userId int32, nonce string) (*models.WebsocketAck, bool) {
+	key := nonceKey{userId, nonce}
+
+	ws.nonces.mutex.Lock()
+	defer ws.nonces.mutex.Unlock()
+	if entry, ok := ws.nonces.entries[key]; ok {
+		return entry.ack, false
+	}
+	ws.nonces.entries[key] = &nonceEntry{}
+	return nil, true
+}
+
+// CompleteNonce stores the ack sent for the nonce and starts the window it is remembered for.
+func (ws *WebsocketServer) CompleteNonce(userId int32, ack *models.WebsocketAck) {
+	key := nonceKey{userId, ack.Nonce}
+
+	ws.nonces.mutex.Lock()
+	defer ws.nonces.mutex.Unlock()
+	entry, ok := ws.nonces.entries[key]
+	if !ok {
+		entry = &nonceEntry{}
+		ws.nonces.entries[key] = entry
+	}
+	entry.ack = ack
+	entry.timer = time.AfterFunc(nonceWindow, func() { ws.expireNonce(key, entry) })
+}
+
+// ReleaseNonce forgets a nonce whose event failed so the client is able to retry it.
+func (ws *WebsocketServer) ReleaseNonce(userId int32, nonce string) {
+	key := nonceKey{userId, nonce}
+
+	ws.nonces.mutex.Lock()
+	defer ws.nonces.mutex.Unlock()
+	if entry, ok := ws.nonces.entries[key]; ok {
+		if entry.timer != nil {
+			entry.timer.Stop()
+		}
+		delete(ws.nonces.entries, key)
+	}
+}
+
+func (ws *WebsocketServer) expireNonce(key nonceKey, entry *nonceEntry) {
+	ws.nonces.mutex.Lock()
+	defer ws.nonces.mutex.Unlock()
+	// The nonce may have been released and claimed again after the timer fired.
+	if ws.nonces.entries[key] == entry {
+		delete(ws.nonces.entries, key)
+	}
+}
@@ -28,6 +28,12 @@ func NewPushNotificationService(config *config.PushNotificationConfig, logger Lo
 
 // SimplePush sends a notification to the URL provided by the user when the registered for push notifications.
 func (p *PushNotificationService) SimplePush(subscription *webpush.Subscription, message *models.PushNotificationMessage) error {
+	return p.Push(subscription, message, webpush.UrgencyNormal, "updates")
+}
+
+// Push sends a notification with the given urgency. Notifications with the same topic replace each other
+// while they are waiting to be delivered.
+func (p *PushNotificationService) Push(subscription *webpush.Subscription, message *models.PushNotificationMessage, urgency webpush.Urgency, topic string) error {
 	data, err := message.Marhsal()
 	if err != nil {
 		return fmt.Errorf("an error occurred while marshaling push notification message %v", err)
@@ -37,8 +43,8 @@ func (p *PushNotificationService) SimplePush(subscription *webpush.Subscription,
 		VAPIDPublicKey:  p.VapidPublicKey,
 		VAPIDPrivateKey: p.VapidPrivateKey,
 		TTL:             2419200,
-		Urgency:         "normal",
-		Topic:           "updates",
+		Urgency:         urgency,
+		Topic:           topic,
 	})
 	if err != nil {
 		return fmt.Errorf("an error ocurred while trying to send push notification: %v", err)
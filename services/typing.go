@@ -0,0 +1,125 @@
+package services
+
+import (
+	"fmt"
+	"sync"
+	"time"
+	"tranquility/models"
+)
+
+var (
+	// How long a typing indicator lasts after the last typing_start from the user.
+	typingTimeout = 8 * time.Second
+	// typing_start from the same user in the same channel is only relayed once per interval.
+	// Clients are expected to keep sending it while the user is typing to keep the indicator alive.
+	typingRelayInterval = 5 * time.Second
+)
+
+type typingKey struct {
+	channelId int32
+	userId    int32
+}
+
+type typingIndicator struct {
+	typing      *models.Typing
+	receivers   map[int32]bool
+	lastRelayed time.Time
+	expires     time.Time
+	timer       *time.Timer
+}
+
+// typingTracker holds who is typing in each channel. Nothing is persisted, so indicators are lost on restart
+// the same way they would be lost when they expire.
+type typingTracker struct {
+	mutex      sync.Mutex
+	indicators map[typingKey]*typingIndicator
+}
+
+func newTypingTracker() *typingTracker {
+	return &typingTracker{indicators: make(map[typingKey]*typingIndicator)}
+}
+
+// StartTyping relays typing_start to the receivers unless the user was relayed as typing in the channel recently.
+// The indicator is extended every time and expires with a typing_stop once the user stops sending typing_start.
+func (ws *WebsocketServer) StartTyping(typing *models.Typing, receivers map[int32]bool) error {
+	key := typingKey{typing.ChannelId, typing.UserId}
+	now := time.Now()
+
+	ws.typing.mutex.Lock()
+	indicator, ok := ws.typing.indicators[key]
+	if !ok {
+		indicator = &typingIndicator{}
+		ws.typing.indicators[key] = indicator
+	} else {
+		indicator.timer.Stop()
+	}
+	relay := !ok || now.Sub(indicator.lastRelayed) >= typingRelayInterval
+	if relay {
+		indicator.lastRelayed = now
+	}
+	indicator.typing = typing
+	indicator.receivers = receivers
+	indicator.expires = now.Add(typingTimeout)
+	indicator.timer = time.AfterFunc(typingTimeout, func() { ws.expireTyping(key, indicator) })
+	ws.typing.mutex.Unlock()
+
+	if !relay {
+		return nil
+	}
+	return ws.Broadcast(typing.UserId, typingEvent("typing_start", typing), receivers)
+}
+
+// ExtendTyping keeps the user's indicator alive when typing_start was relayed for them in the channel recently,
+// so the permission check and receivers from that relay are reused. It returns false when the typing_start has to
+// be checked and relayed with StartTyping instead.
+func (ws *WebsocketServer) ExtendTyping(userId, channelId int32) bool {
+	key := typingKey{channelId, userId}
+	now := time.Now()
+
+	ws.typing.mutex.Lock()
+	defer ws.typing.mutex.Unlock()
+	indicator, ok := ws.typing.indicators[key]
+	if !ok || now.Sub(indicator.lastRelayed) >= typingRelayInterval {
+		return false
+	}
+	indicator.timer.Stop()
+	indicator.expires = now.Add(typingTimeout)
+	indicator.timer = time.AfterFunc(typingTimeout, func() { ws.expireTyping(key, indicator) })
+	return true
+}
+
+// StopTyping removes the user's indicator without notifying anyone.
+// It's used when the user sends a message, which clients already treat as the end of typing.
+func (ws *WebsocketServer) StopTyping(userId, channelId int32) {
+	key := typingKey{channelId, userId}
+
+	ws.typing.mutex.Lock()
+	defer ws.typing.mutex.Unlock()
+	if indicator, ok := ws.typing.indicators[key]; ok {
+		indicator.timer.Stop()
+		delete(ws.typing.indicators, key)
+	}
+}
+
+func (ws *WebsocketServer) expireTyping(key typingKey, indicator *typingIndicator) {
+	ws.typing.mutex.Lock()
+	// The indicator may have been replaced or extended after the timer fired.
+	if ws.typing.indicators[key] != indicator || time.Now().Before(indicator.expires) {
+		ws.typing.mutex.Unlock()
+		return
+	}
+	delete(ws.typing.indicators, key)
+	ws.typing.mutex.Unlock()
+
+	event := typingEvent("typing_stop", indicator.typing)
+	if err := ws.Broadcast(key.userId, event, indicator.receivers); err != nil {
+		ws.logger.ERROR(fmt.Sprintf("an error occurred while broadcasting typing_stop for %d in %d: %v", key.userId, key.channelId, err))
+	}
+}
+
+// Typing is only sent to sessions viewing the channel once they have subscribed.
+func typingEvent(eventType string, typing *models.Typing) *models.WebsocketMessage {
+	event := models.NewWebsocketMessage(eventType, typing)
+	event.Topic = &models.WebsocketTopic{ChannelIds: []int32{typing.ChannelId}}
+	return event
+}
@@ -2,99 +2,217 @@ package services
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"sync"
+	"time"
 	"tranquility/models"
 
 	"github.com/coder/websocket"
+	"github.com/google/uuid"
+)
+
+var (
+	// How long the server waits before listening again after the broadcaster stops, doubling up to the maximum.
+	listenRetryMinimum = time.Second
+	listenRetryMaximum = time.Minute
 )
 
 // WebsocketServer should created in the main process, and passed to the WebsocketController as a pointer.
 //
 // This struct is in charge of sending communications and notificates between connections.
 type WebsocketServer struct {
-	// The mutex is required to not allow new users to be added until all messages are sent.
+	// The mutex is required to not allow new users to be added until all messages are queued.
 	mutex sync.Mutex
 	// When the user connects to WebsocketServer, they pass their connection with it so that
 	// we don't have to manage communication back to the requester.
-	users map[int32]*websocket.Conn
+	//
+	// A user can be connected from multiple devices at once so each connection is stored by its connection id.
+	users map[int32]map[string]*websocketConnection
+	// Every connection has a session that numbers the events sent to it. Sessions are stored by their id
+	// and outlive their connection for a short time so the client can resume them after reconnecting.
+	sessions map[int32]map[string]*websocketSession
+	// deliveries counts the events delivered by this server. It's used to tell which events a session received
+	// before another was created.
+	deliveries uint64
 	// This is used for handlers to send commands to the server
-	commandChannel  chan models.WebsocketCommand
+	commandChannel chan models.WebsocketCommand
+	// Messages are sent through the broadcaster so users connected to other servers receive them as well.
+	broadcaster WebsocketBroadcaster
+	// typing has its own lock so indicators can be updated and expired without holding up connections.
+	typing *typingTracker
+	// nonces remembers recently handled client nonces so retried sends aren't handled twice.
+	nonces          *nonceTracker
 	logger          Logger
 	shutdownContext context.Context
 }
 
-func NewWebsocketServer(ctx context.Context, logger Logger) *WebsocketServer {
+func NewWebsocketServer(ctx context.Context, logger Logger, broadcaster WebsocketBroadcaster) *WebsocketServer {
 	return &WebsocketServer{
-		users:           make(map[int32]*websocket.Conn),
+		users:           make(map[int32]map[string]*websocketConnection),
+		sessions:        make(map[int32]map[string]*websocketSession),
 		commandChannel:  make(chan models.WebsocketCommand),
+		broadcaster:     broadcaster,
+		typing:          newTypingTracker(),
+		nonces:          newNonceTracker(),
 		logger:          logger,
 		shutdownContext: ctx,
 	}
 }
 
-func (ws *WebsocketServer) sendSystemMessage(data *models.WebsocketMessage, notificationTargets map[int32]bool) {
+// sendSystemMessage publishes the message to every server through the broadcaster.
+func (ws *WebsocketServer) sendSystemMessage(data *models.WebsocketMessage, notificationTargets map[int32]bool) error {
+	event, err := models.NewWebsocketEvent(data, notificationTargets)
+	if err != nil {
+		ws.logger.ERROR(fmt.Sprintf("Error marshaling data: %+v", data))
+		return err
+	}
+
+	if err := ws.broadcaster.Publish(ws.shutdownContext, event); err != nil {
+		return fmt.Errorf("an error occurred while publishing %s event: %v", event.Type, err)
+	}
+	return nil
+}
+
+// deliver records the event on every session of the event's targets on this server and queues it on the
+// sessions that are connected. A connection that is unable to keep up is closed and reported without
+// stopping the rest of the broadcast.
+func (ws *WebsocketServer) deliver(event *models.WebsocketEvent) {
+	ws.mutex.Lock()
+	defer ws.mutex.Unlock()
+
+	ws.deliveries++
+	for _, userId := range event.Targets {
+		for _, session := range ws.sessions[userId] {
+			if !session.wants(event.Topic) {
+				continue
+			}
+			frame, err := session.record(event, ws.deliveries)
+			if err != nil {
+				ws.logger.ERROR(fmt.Sprintf("Error marshaling %s event frame for %d: %v", event.Type, userId, err))
+				continue
+			}
+			if session.connection != nil {
+				ws.send(session.connection, frame)
+			}
+		}
+	}
+}
+
+func (ws *WebsocketServer) connect(userId int32, connectionId string, conn *websocket.Conn) {
 	ws.mutex.Lock()
 	defer ws.mutex.Unlock()
+	ws.logger.INFO(fmt.Sprintf("Adding %d to connections on %s", userId, connectionId))
+	if _, ok := ws.users[userId]; !ok {
+		ws.users[userId] = make(map[string]*websocketConnection)
+	}
+	connection := newWebsocketConnection(connectionId, userId, conn)
+	ws.users[userId][connectionId] = connection
 
-	bytes, err := json.Marshal(data)
+	session := newWebsocketSession(userId, ws.deliveries)
+	if _, ok := ws.sessions[userId]; !ok {
+		ws.sessions[userId] = make(map[string]*websocketSession)
+	}
+	ws.sessions[userId][session.id] = session
+	connection.session = session
+	session.connection = connection
+	go ws.runConnection(connection)
+
+	// The client needs the session id to be able to resume it later.
+	frame, err := sessionFrame("ready", session)
 	if err != nil {
-		ws.logger.ERROR(fmt.Sprintf("Error marshaling data: %+v", data))
+		ws.logger.ERROR(fmt.Sprintf("Error marshaling ready frame for %d: %v", userId, err))
 		return
 	}
+	ws.send(connection, frame)
+}
 
-	for userId, conn := range ws.users {
-		if _, ok := notificationTargets[userId]; !ok {
-			continue
-		}
-		ws.logger.INFO(fmt.Sprintf("Sending notification to %d", userId))
-		w, err := conn.Writer(ws.shutdownContext, 1)
-		if err != nil {
-			ws.logger.ERROR(fmt.Sprintf("Error getting writer for connection %d: %v", userId, err))
-			return
-		}
-		defer w.Close()
-
-		_, err = w.Write(bytes)
-		if err != nil {
-			ws.logger.ERROR(fmt.Sprintf("Error writing to connection %d: %v", userId, err))
-			return
-		}
-		ws.logger.INFO(fmt.Sprintf("Notification sent %d", userId))
+// The user is only removed from the server once their last connection has been closed.
+func (ws *WebsocketServer) disconnect(userId int32, connectionId string) error {
+	ws.mutex.Lock()
+	defer ws.mutex.Unlock()
+	connection, ok := ws.users[userId][connectionId]
+	if !ok {
+		// The connection is removed as soon as it stops writing, which is usually before the reader notices.
+		ws.logger.INFO(fmt.Sprintf("Connection %s for %d was already removed", connectionId, userId))
+		return nil
 	}
+	ws.removeConnection(connection)
+	return nil
 }
 
-func (ws *WebsocketServer) connect(userId int32, conn *websocket.Conn) {
+// runConnection writes the connection's messages and removes it from the server once it stops,
+// so events aren't queued for a connection that is no longer able to receive them.
+func (ws *WebsocketServer) runConnection(connection *websocketConnection) {
+	connection.run(ws.shutdownContext, ws.logger)
+
 	ws.mutex.Lock()
 	defer ws.mutex.Unlock()
-	ws.logger.INFO(fmt.Sprintf("Adding %d to connections", userId))
-	ws.users[userId] = conn
+	if ws.users[connection.userId][connection.id] == connection {
+		ws.removeConnection(connection)
+	}
 }
 
-func (ws *WebsocketServer) disconnect(userId int32) error {
+// removeConnection should only be called while holding the mutex.
+func (ws *WebsocketServer) removeConnection(connection *websocketConnection) {
+	ws.logger.INFO(fmt.Sprintf("Removing %s from %d connections", connection.id, connection.userId))
+	connection.stop()
+	// The session may have already been resumed by another connection.
+	if connection.session.connection == connection {
+		ws.detachSession(connection.session)
+	}
+	connections := ws.users[connection.userId]
+	delete(connections, connection.id)
+	if len(connections) == 0 {
+		ws.logger.INFO(fmt.Sprintf("Removing %d from connections", connection.userId))
+		delete(ws.users, connection.userId)
+	}
+}
+
+// reply is only sent to the connection and isn't given a sequence number or kept for replay,
+// since a client that reconnects is expected to retry anything it didn't receive a reply for.
+func (ws *WebsocketServer) reply(userId int32, connectionId string, data *models.WebsocketMessage) error {
+	event, err := models.NewWebsocketEvent(data, nil)
+	if err != nil {
+		return err
+	}
+	frame, err := event.Frame(0)
+	if err != nil {
+		return err
+	}
+
 	ws.mutex.Lock()
 	defer ws.mutex.Unlock()
-	if _, ok := ws.users[userId]; !ok {
-		ws.logger.ERROR(fmt.Sprintf("Tried removing %d from connections while it didn't exist.", userId))
-		return fmt.Errorf("disconnect occurred while they were not in the map")
+	connection, ok := ws.users[userId][connectionId]
+	if !ok {
+		return fmt.Errorf("reply occurred while the connection was not in the map")
 	}
-	ws.logger.INFO(fmt.Sprintf("Removing %d from connections", userId))
-	delete(ws.users, userId)
+	ws.send(connection, frame)
 	return nil
 }
 
 func (ws *WebsocketServer) handleCommand(command models.WebsocketCommand) error {
 	switch command.Type {
 	case "connect":
-		ws.connect(command.UserId, command.Connection)
+		ws.connect(command.UserId, command.ConnectionId, command.Connection)
 		command.AcknowledgeChannel <- nil
 	case "disconnect":
-		err := ws.disconnect(command.UserId)
+		err := ws.disconnect(command.UserId, command.ConnectionId)
 		command.AcknowledgeChannel <- err
 	case "message":
-		ws.sendSystemMessage(command.Message, command.NotificationTargets)
-		command.AcknowledgeChannel <- nil
+		// Publishing can wait on the database, so it's done outside the command loop to keep it from holding up
+		// every other connection. The sender still waits for the acknowledgement so its messages stay in order.
+		go func() {
+			command.AcknowledgeChannel <- ws.sendSystemMessage(command.Message, command.NotificationTargets)
+		}()
+	case "resume":
+		err := ws.resume(command.UserId, command.ConnectionId, command.Session)
+		command.AcknowledgeChannel <- err
+	case "subscribe", "unsubscribe":
+		err := ws.subscribe(command.UserId, command.ConnectionId, command.Type == "subscribe", command.Topic)
+		command.AcknowledgeChannel <- err
+	case "reply":
+		err := ws.reply(command.UserId, command.ConnectionId, command.Message)
+		command.AcknowledgeChannel <- err
 	default:
 		return fmt.Errorf("unknown command has been provided: %s", command.Type)
 	}
@@ -105,6 +223,7 @@ func (ws *WebsocketServer) handleCommand(command models.WebsocketCommand) error
 // This function allows for
 func (ws *WebsocketServer) Run() {
 	ws.logger.INFO("Websocket server has started...")
+	go ws.listen()
 	for {
 		select {
 		case <-ws.shutdownContext.Done():
@@ -119,21 +238,67 @@ func (ws *WebsocketServer) Run() {
 	}
 }
 
+// listen delivers the broadcaster's events until the server shuts down. The broadcaster is restarted when it stops
+// since nothing would be delivered to this server's connections without it.
+func (ws *WebsocketServer) listen() {
+	retry := listenRetryMinimum
+	for {
+		started := time.Now()
+		err := ws.broadcaster.Listen(ws.shutdownContext, ws.deliver)
+		if ws.shutdownContext.Err() != nil {
+			return
+		}
+		// A broadcaster that ran for a while before stopping is retried quickly again.
+		if time.Since(started) > listenRetryMaximum {
+			retry = listenRetryMinimum
+		}
+		ws.logger.ERROR(fmt.Sprintf("Websocket broadcaster stopped listening, retrying in %s: %v", retry, err))
+
+		select {
+		case <-ws.shutdownContext.Done():
+			return
+		case <-time.After(retry):
+		}
+		retry = min(retry*2, listenRetryMaximum)
+	}
+}
+
+// Broadcast is used to notify connected users of changes that did not come from their websocket connection,
+// such as REST requests.
+func (ws *WebsocketServer) Broadcast(userId int32, data *models.WebsocketMessage, receivers map[int32]bool) error {
+	command, errorChannel := models.NewWebsocketMessageCommand(userId, data, receivers)
+
+	select {
+	case ws.commandChannel <- *command:
+	case <-ws.shutdownContext.Done():
+		return ws.shutdownContext.Err()
+	}
+
+	return <-errorChannel
+}
+
 // This function will be called any time a new websocket connection is created.
 // Each connection has it's own WebsocketHandler so they can communicate to the WebsocketServer
 // but not directly to each other.
 func (ws *WebsocketServer) NewHandler() *WebsocketHandler {
 	return &WebsocketHandler{
 		commandChannel: ws.commandChannel,
+		connectionId:   uuid.New().String(),
 	}
 }
 
 type WebsocketHandler struct {
 	commandChannel chan<- models.WebsocketCommand
+	// Every handler represents a single connection so a user can be connected from multiple devices.
+	connectionId string
+}
+
+func (wh *WebsocketHandler) ConnectionID() string {
+	return wh.connectionId
 }
 
 func (wh *WebsocketHandler) Connect(userId int32, conn *websocket.Conn) error {
-	command, errorChannel := models.NewWebsocketConnectCommand(userId, conn)
+	command, errorChannel := models.NewWebsocketConnectCommand(userId, wh.connectionId, conn)
 
 	wh.commandChannel <- *command
 
@@ -144,7 +309,7 @@ func (wh *WebsocketHandler) Connect(userId int32, conn *websocket.Conn) error {
 }
 
 func (wh *WebsocketHandler) Disconnect(userId int32) error {
-	command, errorChannel := models.NewWebsocketDisconnectCommand(userId)
+	command, errorChannel := models.NewWebsocketDisconnectCommand(userId, wh.connectionId)
 
 	wh.commandChannel <- *command
 
@@ -164,3 +329,40 @@ func (wh *WebsocketHandler) SendMessage(userId int32, data *models.WebsocketMess
 	}
 	return nil
 }
+
+// Resume asks the server to move this connection onto the session the client had before reconnecting.
+// The client is sent either the events it missed followed by resumed, or invalid_session.
+func (wh *WebsocketHandler) Resume(userId int32, session *models.WebsocketSession) error {
+	command, errorChannel := models.NewWebsocketResumeCommand(userId, wh.connectionId, session)
+
+	wh.commandChannel <- *command
+
+	if err := <-errorChannel; err != nil {
+		return err
+	}
+	return nil
+}
+
+// Subscribe adds or removes the guilds and channels this connection's session receives high volume events for.
+func (wh *WebsocketHandler) Subscribe(userId int32, subscribe bool, topic *models.WebsocketTopic) error {
+	command, errorChannel := models.NewWebsocketSubscribeCommand(userId, wh.connectionId, subscribe, topic)
+
+	wh.commandChannel <- *command
+
+	if err := <-errorChannel; err != nil {
+		return err
+	}
+	return nil
+}
+
+// Reply sends an ack or error to this connection only.
+func (wh *WebsocketHandler) Reply(userId int32, data *models.WebsocketMessage) error {
+	command, errorChannel := models.NewWebsocketReplyCommand(userId, wh.connectionId, data)
+
+	wh.commandChannel <- *command
+
+	if err := <-errorChannel; err != nil {
+		return err
+	}
+	return nil
+}
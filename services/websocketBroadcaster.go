@@ -0,0 +1,49 @@
+package services
+
+import (
+	"context"
+	"tranquility/models"
+)
+
+// WebsocketBroadcaster shares events between every running WebsocketServer so users receive events
+// no matter which server they are connected to.
+//
+// Events published by a server are also delivered back to that server.
+type WebsocketBroadcaster interface {
+	Publish(ctx context.Context, event *models.WebsocketEvent) error
+	// # Listen should be ran in a goroutine.
+	//
+	// Listen calls deliver for every event published by any server until the context is done.
+	Listen(ctx context.Context, deliver func(*models.WebsocketEvent)) error
+}
+
+// MemoryBroadcaster is used when only a single server is running.
+type MemoryBroadcaster struct {
+	events chan *models.WebsocketEvent
+}
+
+func NewMemoryBroadcaster() *MemoryBroadcaster {
+	return &MemoryBroadcaster{
+		events: make(chan *models.WebsocketEvent, 256),
+	}
+}
+
+func (m *MemoryBroadcaster) Publish(ctx context.Context, event *models.WebsocketEvent) error {
+	select {
+	case m.events <- event:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (m *MemoryBroadcaster) Listen(ctx context.Context, deliver func(*models.WebsocketEvent)) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event := <-m.events:
+			deliver(event)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+	"tranquility/models"
+
+	"github.com/coder/websocket"
+)
+
+var (
+	// The number of messages that can be waiting to be written before the client is considered too slow.
+	connectionQueueSize = 64
+	// How long a single write is allowed to take before the client is considered too slow.
+	connectionWriteTimeout = 5 * time.Second
+)
+
+// websocketConnection owns the outbound side of a single websocket connection.
+//
+// Messages are queued and written by the connection's own goroutine so one slow client
+// isn't able to stall messages being sent to everyone else.
+type websocketConnection struct {
+	id     string
+	userId int32
+	conn   *websocket.Conn
+	// session is replaced when the client resumes the session it had before reconnecting.
+	session *websocketSession
+	queue   chan []byte
+	// done is closed once the connection should stop writing.
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+func newWebsocketConnection(id string, userId int32, conn *websocket.Conn) *websocketConnection {
+	return &websocketConnection{
+		id:     id,
+		userId: userId,
+		conn:   conn,
+		queue:  make(chan []byte, connectionQueueSize),
+		done:   make(chan struct{}),
+	}
+}
+
+// enqueue never blocks. It returns false when the queue is full or the connection has stopped.
+func (c *websocketConnection) enqueue(message []byte) bool {
+	select {
+	case <-c.done:
+		return false
+	default:
+	}
+
+	select {
+	case c.queue <- message:
+		return true
+	default:
+		return false
+	}
+}
+
+// # This function should be ran in a goroutine.
+//
+// run writes queued messages until the connection is stopped, a write fails or the server shuts down.
+func (c *websocketConnection) run(ctx context.Context, logger Logger) {
+	for {
+		select {
+		case <-ctx.Done():
+			c.close(models.CloseServerShutdown, "server is shutting down")
+			return
+		case <-c.done:
+			return
+		case message := <-c.queue:
+			writeContext, cancel := context.WithTimeout(ctx, connectionWriteTimeout)
+			err := c.conn.Write(writeContext, websocket.MessageText, message)
+			cancel()
+			if err != nil {
+				switch {
+				case ctx.Err() != nil:
+					c.close(models.CloseServerShutdown, "server is shutting down")
+				case errors.Is(err, context.DeadlineExceeded):
+					logger.WARNING(fmt.Sprintf("Connection %s for %d timed out writing a message, disconnecting", c.id, c.userId))
+					c.close(websocket.StatusPolicyViolation, "client was too slow to receive messages")
+				default:
+					// The socket is already gone so there is nobody to send a close frame to.
+					logger.INFO(fmt.Sprintf("Connection %s for %d was lost while writing: %v", c.id, c.userId, err))
+					c.stop()
+				}
+				return
+			}
+		}
+	}
+}
+
+// stop prevents any more messages from being written without closing the underlying connection.
+// It returns true the first time it's called.
+func (c *websocketConnection) stop() bool {
+	stopped := false
+	c.stopOnce.Do(func() {
+		close(c.done)
+		stopped = true
+	})
+	return stopped
+}
+
+// close stops the connection and sends the close frame to the client.
+// The close handshake is done in the background because it waits on the client to respond.
+func (c *websocketConnection) close(code websocket.StatusCode, reason string) {
+	if c.stop() {
+		go c.conn.Close(code, reason)
+	}
+}
@@ -0,0 +1,276 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+	"tranquility/models"
+
+	"github.com/coder/websocket"
+	"github.com/google/uuid"
+)
+
+var (
+	// The number of recent events kept for each session so they can be replayed after a reconnect.
+	// It's kept below connectionQueueSize so a full replay fits in the connection's queue.
+	sessionReplayBufferSize = 50
+	// How long a session can be resumed after its connection has closed.
+	sessionResumeTimeout = 2 * time.Minute
+)
+
+var ErrTooManySubscriptions = errors.New("the session is subscribed to too many guilds and channels")
+
+type sessionEvent struct {
+	seq int64
+	// delivery is the server's delivery count when the event was recorded.
+	delivery uint64
+	frame    []byte
+}
+
+// websocketSession numbers the events sent to a client and keeps the most recent ones,
+// so a client that loses its connection can resume without missing anything.
+//
+// Sessions only live on the server the client connected to and are guarded by the server's mutex.
+type websocketSession struct {
+	id     string
+	userId int32
+	seq    int64
+	// buffer is a ring of the most recent events where start is the oldest.
+	buffer []sessionEvent
+	start  int
+	// createdAt is the server's delivery count when the session was created.
+	createdAt uint64
+	// connection is nil while the client is away.
+	connection *websocketConnection
+	expires    time.Time
+	expiry     *time.Timer
+	// Subscriptions are kept with the session so they're restored when it's resumed.
+	subscribed bool
+	guilds     map[int32]bool
+	channels   map[int32]bool
+}
+
+func newWebsocketSession(userId int32, createdAt uint64) *websocketSession {
+	return &websocketSession{
+		id:        uuid.New().String(),
+		userId:    userId,
+		buffer:    make([]sessionEvent, 0, sessionReplayBufferSize),
+		createdAt: createdAt,
+		guilds:    make(map[int32]bool),
+		channels:  make(map[int32]bool),
+	}
+}
+
+// wants returns false for events with a topic the session has not subscribed to.
+func (s *websocketSession) wants(topic *models.WebsocketTopic) bool {
+	if topic == nil || !s.subscribed {
+		return true
+	}
+	for _, guildId := range topic.GuildIds {
+		if s.guilds[guildId] {
+			return true
+		}
+	}
+	for _, channelId := range topic.ChannelIds {
+		if s.channels[channelId] {
+			return true
+		}
+	}
+	return false
+}
+
+// subscribe only counts ids the session isn't already subscribed to towards the limit,
+// so clients are able to send their full list of subscriptions again.
+func (s *websocketSession) subscribe(topic *models.WebsocketTopic) error {
+	guilds := make(map[int32]bool)
+	for _, guildId := range topic.GuildIds {
+		if !s.guilds[guildId] {
+			guilds[guildId] = true
+		}
+	}
+	channels := make(map[int32]bool)
+	for _, channelId := range topic.ChannelIds {
+		if !s.channels[channelId] {
+			channels[channelId] = true
+		}
+	}
+	if len(s.guilds)+len(s.channels)+len(guilds)+len(channels) > models.MaxWebsocketSubscriptions {
+		return ErrTooManySubscriptions
+	}
+
+	s.subscribed = true
+	for guildId := range guilds {
+		s.guilds[guildId] = true
+	}
+	for channelId := range channels {
+		s.channels[channelId] = true
+	}
+	return nil
+}
+
+func (s *websocketSession) unsubscribe(topic *models.WebsocketTopic) {
+	for _, guildId := range topic.GuildIds {
+		delete(s.guilds, guildId)
+	}
+	for _, channelId := range topic.ChannelIds {
+		delete(s.channels, channelId)
+	}
+	// Without any subscriptions left the session goes back to receiving every event.
+	if len(s.guilds) == 0 && len(s.channels) == 0 {
+		s.subscribed = false
+	}
+}
+
+// record gives the event the session's next sequence number and keeps it for replay.
+func (s *websocketSession) record(event *models.WebsocketEvent, delivery uint64) ([]byte, error) {
+	frame, err := event.Frame(s.seq + 1)
+	if err != nil {
+		return nil, err
+	}
+	s.seq++
+
+	buffered := sessionEvent{s.seq, delivery, frame}
+	if len(s.buffer) < sessionReplayBufferSize {
+		s.buffer = append(s.buffer, buffered)
+	} else {
+		s.buffer[s.start] = buffered
+		s.start = (s.start + 1) % len(s.buffer)
+	}
+	return frame, nil
+}
+
+// missed returns the frames after the sequence number that were delivered before the delivery count.
+// It returns false when some of them are no longer buffered.
+func (s *websocketSession) missed(after int64, before uint64) ([][]byte, bool) {
+	oldest := s.seq - int64(len(s.buffer)) + 1
+	if after < 0 || after > s.seq || after+1 < oldest {
+		return nil, false
+	}
+
+	frames := make([][]byte, 0, s.seq-after)
+	for i := range s.buffer {
+		event := s.buffer[(s.start+i)%len(s.buffer)]
+		if event.seq > after && event.delivery <= before {
+			frames = append(frames, event.frame)
+		}
+	}
+	return frames, true
+}
+
+func sessionFrame(eventType string, session *websocketSession) ([]byte, error) {
+	var data models.WebsocketMessageData
+	if session != nil {
+		data = &models.WebsocketSession{SessionId: session.id, Seq: session.seq}
+	}
+	event, err := models.NewWebsocketEvent(models.NewWebsocketMessage(eventType, data), nil)
+	if err != nil {
+		return nil, err
+	}
+	// Session frames aren't events themselves so they don't take a sequence number.
+	return event.Frame(0)
+}
+
+// detachSession keeps the session around for sessionResumeTimeout after its connection closes.
+func (ws *WebsocketServer) detachSession(session *websocketSession) {
+	session.connection = nil
+	session.expires = time.Now().Add(sessionResumeTimeout)
+	session.expiry = time.AfterFunc(sessionResumeTimeout, func() { ws.expireSession(session) })
+}
+
+func (ws *WebsocketServer) expireSession(session *websocketSession) {
+	ws.mutex.Lock()
+	defer ws.mutex.Unlock()
+
+	// The session may have been resumed, or resumed and detached again, after the timer fired.
+	if session.connection != nil || time.Now().Before(session.expires) {
+		return
+	}
+	sessions := ws.sessions[session.userId]
+	if sessions[session.id] != session {
+		return
+	}
+	delete(sessions, session.id)
+	if len(sessions) == 0 {
+		delete(ws.sessions, session.userId)
+	}
+}
+
+// resume moves the connection onto the session it had before reconnecting and replays the events it missed,
+// followed by resumed. The client is sent invalid_session instead when the session has expired or the events
+// are no longer buffered, and keeps the session it was given in ready.
+func (ws *WebsocketServer) resume(userId int32, connectionId string, request *models.WebsocketSession) error {
+	ws.mutex.Lock()
+	defer ws.mutex.Unlock()
+
+	connection, ok := ws.users[userId][connectionId]
+	if !ok {
+		return fmt.Errorf("resume occurred while the connection was not in the map")
+	}
+	current := connection.session
+
+	// Events delivered after the client reconnected were already sent on its new session, so they aren't replayed.
+	// Clients are expected to resume before subscribing, since a new session receives every event until then.
+	session, ok := ws.sessions[userId][request.SessionId]
+	var frames [][]byte
+	if ok && session != current {
+		frames, ok = session.missed(request.Seq, current.createdAt)
+	}
+	if !ok || session == current {
+		ws.logger.INFO(fmt.Sprintf("Connection %s for %d was not able to resume session %s", connectionId, userId, request.SessionId))
+		frame, err := sessionFrame("invalid_session", nil)
+		if err != nil {
+			return err
+		}
+		ws.send(connection, frame)
+		return nil
+	}
+
+	ws.logger.INFO(fmt.Sprintf("Connection %s for %d resumed session %s with %d missed events", connectionId, userId, session.id, len(frames)))
+	// The session's old connection may not have noticed the client is gone yet.
+	if session.connection != nil {
+		session.connection.close(models.CloseSessionReplaced, "session was resumed by another connection")
+	}
+	if session.expiry != nil {
+		session.expiry.Stop()
+	}
+	delete(ws.sessions[userId], current.id)
+	connection.session = session
+	session.connection = connection
+
+	resumed, err := sessionFrame("resumed", session)
+	if err != nil {
+		return err
+	}
+	for _, frame := range append(frames, resumed) {
+		if !ws.send(connection, frame) {
+			break
+		}
+	}
+	return nil
+}
+
+// subscribe changes which guilds and channels the connection's session receives high volume events for.
+func (ws *WebsocketServer) subscribe(userId int32, connectionId string, subscribe bool, topic *models.WebsocketTopic) error {
+	ws.mutex.Lock()
+	defer ws.mutex.Unlock()
+
+	connection, ok := ws.users[userId][connectionId]
+	if !ok {
+		return fmt.Errorf("subscribe occurred while the connection was not in the map")
+	}
+	if !subscribe {
+		connection.session.unsubscribe(topic)
+		return nil
+	}
+	return connection.session.subscribe(topic)
+}
+
+// send queues the frame on the connection and closes it when it isn't able to keep up.
+func (ws *WebsocketServer) send(connection *websocketConnection, frame []byte) bool {
+	if connection.enqueue(frame) {
+		return true
+	}
+	ws.logger.WARNING(fmt.Sprintf("Connection %s for %d is not keeping up with messages, disconnecting", connection.id, connection.userId))
+	connection.close(websocket.StatusPolicyViolation, "client was too slow to receive messages")
+	return false
+}
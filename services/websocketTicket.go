@@ -0,0 +1,24 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+// GenerateWebsocketTicket creates a random ticket used once to open a websocket connection.
+func GenerateWebsocketTicket() (string, error) {
+	ticket := make([]byte, 32)
+	if _, err := rand.Read(ticket); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(ticket), nil
+}
+
+// HashWebsocketTicket is what gets stored and looked up instead of the ticket itself.
+func HashWebsocketTicket(ticket string) string {
+	hash := sha256.Sum256([]byte(ticket))
+	return hex.EncodeToString(hash[:])
+}
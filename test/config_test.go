@@ -57,6 +57,9 @@ func TestNewConfig(t *testing.T) {
 		if cfg.ConnectionString != "test_connection" {
 			t.Errorf("ConnectionString mismatch: got %v, want %v", cfg.ConnectionString, "test_connection")
 		}
+		if cfg.WebsocketBroadcaster != "memory" {
+			t.Errorf("WebsocketBroadcaster mismatch: got %v, want %v", cfg.WebsocketBroadcaster, "memory")
+		}
 		if cfg.UploadPath != "test_upload" {
 			t.Errorf("UploadPath mismatch: got %v, want %v", cfg.UploadPath, "test_upload")
 		}
@@ -340,6 +343,24 @@ func TestNewConfig(t *testing.T) {
 		}
 	})
 
+	t.Run("Invalid Websocket Broadcaster", func(t *testing.T) {
+		broadcaster := os.Getenv("WEBSOCKET_BROADCASTER")
+		defer os.Setenv("WEBSOCKET_BROADCASTER", broadcaster)
+		os.Setenv("WEBSOCKET_BROADCASTER", "redis")
+
+		_, err := config.NewConfig()
+		if err == nil {
+			t.Errorf("expected error, got nil")
+		}
+		if err.Error() != "invalid WEBSOCKET_BROADCASTER was provided: redis" {
+			t.Errorf(
+				"expected error message '%s', got '%s'",
+				"invalid WEBSOCKET_BROADCASTER was provided: redis",
+				err.Error(),
+			)
+		}
+	})
+
 	t.Run("Empty RP Origins", func(t *testing.T) {
 		vapidPrivate := os.Getenv("RP_ORIGINS")
 		defer os.Setenv("RP_ORIGINS", vapidPrivate)
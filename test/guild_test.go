@@ -0,0 +1,70 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"tranquility/data"
+	"tranquility/models"
+)
+
+func TestGuildUpdateClearsDescription(t *testing.T) {
+	var rename models.GuildUpdate
+	if err := json.Unmarshal([]byte(`{"name": "renamed"}`), &rename); err != nil {
+		t.Fatal(err)
+	}
+	if rename.Description != nil {
+		t.Errorf("expected the description to be left out of a rename, got %q", *rename.Description)
+	}
+
+	var clear models.GuildUpdate
+	if err := json.Unmarshal([]byte(`{"description": ""}`), &clear); err != nil {
+		t.Fatal(err)
+	}
+	if clear.Description == nil || *clear.Description != "" {
+		t.Errorf("expected the description to be cleared, got %v", clear.Description)
+	}
+}
+
+func TestUpdateGuildDescription(t *testing.T) {
+	database, db := newTestDatabase(t)
+	ctx := context.Background()
+	ownerId := createTestUser(t, db, "owner")
+	guild, err := database.CreateGuild(ctx, &models.Guild{Name: "guild", Description: "about"}, ownerId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	renamed, err := database.UpdateGuild(ctx, &models.GuildUpdate{ID: guild.ID, Name: "renamed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if renamed.Name != "renamed" || renamed.Description != "about" {
+		t.Errorf("expected only the name to change, got %+v", renamed)
+	}
+
+	empty := ""
+	cleared, err := database.UpdateGuild(ctx, &models.GuildUpdate{ID: guild.ID, Description: &empty})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cleared.Name != "renamed" || cleared.Description != "" {
+		t.Errorf("expected only the description to be cleared, got %+v", cleared)
+	}
+}
+
+func TestRemoveMemberOwnerCannotLeave(t *testing.T) {
+	database, db := newTestDatabase(t)
+	ctx := context.Background()
+	ownerId := createTestUser(t, db, "owner")
+	outsiderId := createTestUser(t, db, "outsider")
+	channel := createTestChannel(t, database, db, ownerId)
+
+	if err := database.RemoveMember(ctx, channel.GuildId, ownerId); !errors.Is(err, data.ErrOwnerCannotLeave) {
+		t.Errorf("expected %v, got %v", data.ErrOwnerCannotLeave, err)
+	}
+	if err := database.RemoveMember(ctx, channel.GuildId, outsiderId); !errors.Is(err, data.ErrMemberNotFound) {
+		t.Errorf("expected %v, got %v", data.ErrMemberNotFound, err)
+	}
+}
@@ -0,0 +1,29 @@
+package test
+
+import (
+	"testing"
+	"tranquility/services"
+	"unicode"
+)
+
+func TestGenerateInviteCode(t *testing.T) {
+	seen := make(map[string]bool)
+	for range 100 {
+		code, err := services.GenerateInviteCode()
+		if err != nil {
+			t.Fatalf("an error occurred while generating invite code: %v", err)
+		}
+		if len(code) != 10 {
+			t.Fatalf("invite code was not 10 characters: %s", code)
+		}
+		for _, c := range code {
+			if c > unicode.MaxASCII || !(unicode.IsLetter(c) || unicode.IsDigit(c)) {
+				t.Fatalf("invite code contained an invalid character: %s", code)
+			}
+		}
+		if seen[code] {
+			t.Fatalf("invite code was generated twice: %s", code)
+		}
+		seen[code] = true
+	}
+}
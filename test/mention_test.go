@@ -0,0 +1,39 @@
+package test
+
+import (
+	"slices"
+	"testing"
+	"tranquility/models"
+)
+
+func TestParseMentions(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		users    []int32
+		roles    []int32
+		everyone bool
+	}{
+		{name: "no mentions", content: "hello there", users: []int32{}, roles: []int32{}},
+		{name: "users and roles", content: "<@3> and <@&7> then <@4>", users: []int32{3, 4}, roles: []int32{7}},
+		{name: "duplicates", content: "<@3> <@3> <@&7> <@&7>", users: []int32{3}, roles: []int32{7}},
+		{name: "everyone", content: "@everyone look", users: []int32{}, roles: []int32{}, everyone: true},
+		{name: "everyone in an email", content: "mail me@everyone.com", users: []int32{}, roles: []int32{}},
+		{name: "invalid ids", content: "<@0> <@abc> <@99999999999>", users: []int32{}, roles: []int32{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mentions := models.ParseMentions(tt.content)
+			if !slices.Equal(mentions.Users, tt.users) {
+				t.Errorf("expected users %v, got %v", tt.users, mentions.Users)
+			}
+			if !slices.Equal(mentions.Roles, tt.roles) {
+				t.Errorf("expected roles %v, got %v", tt.roles, mentions.Roles)
+			}
+			if mentions.Everyone != tt.everyone {
+				t.Errorf("expected everyone to be %v", tt.everyone)
+			}
+		})
+	}
+}
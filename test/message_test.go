@@ -0,0 +1,222 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"tranquility/data"
+	"tranquility/models"
+)
+
+func TestUpdateMessageCreatesRevision(t *testing.T) {
+	database, db := newTestDatabase(t)
+	ctx := context.Background()
+	authorId := createTestUser(t, db, "author")
+	channel := createTestChannel(t, database, db, authorId)
+
+	message, err := database.CreateMessage(ctx, &models.Message{ChannelID: channel.ID, Content: "first"}, authorId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.UpdateMessage(ctx, &models.Message{ID: message.ID, ChannelID: channel.ID, Content: "second"}, authorId); err != nil {
+		t.Fatal(err)
+	}
+
+	history, err := database.GetMessageHistory(ctx, channel.ID, message.ID, authorId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if history.Message.Content != "second" {
+		t.Errorf("expected the message to have the new content, got %q", history.Message.Content)
+	}
+	if len(history.Revisions) != 1 || history.Revisions[0].Content != "first" {
+		t.Fatalf("expected a single revision with the original content, got %+v", history.Revisions)
+	}
+}
+
+func TestDeletedMessageIsHidden(t *testing.T) {
+	database, db := newTestDatabase(t)
+	ctx := context.Background()
+	authorId := createTestUser(t, db, "author")
+	memberId := createTestUser(t, db, "member")
+	channel := createTestChannel(t, database, db, authorId, memberId)
+
+	content := fmt.Sprintf("tombstone <@%d>", memberId)
+	message, err := database.CreateMessage(ctx, &models.Message{ChannelID: channel.ID, Content: content}, authorId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply, err := database.CreateMessage(ctx, &models.Message{ChannelID: channel.ID, Content: content, ThreadId: &message.ID}, memberId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.DeleteMessage(ctx, channel.ID, message.ID, authorId); err != nil {
+		t.Fatal(err)
+	}
+
+	page, err := database.GetChannelMessages(ctx, memberId, channel.GuildId, channel.ID, &models.MessageQuery{Limit: models.DefaultMessageLimit})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Messages) != 0 {
+		t.Errorf("expected deleted messages to be hidden from the channel, got %d messages", len(page.Messages))
+	}
+
+	thread, err := database.GetChannelMessages(ctx, memberId, channel.GuildId, channel.ID, &models.MessageQuery{Limit: models.DefaultMessageLimit, ThreadId: message.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(thread.Messages) != 0 {
+		t.Errorf("expected the replies of a deleted thread to be hidden, got %d messages", len(thread.Messages))
+	}
+
+	results, err := database.SearchMessages(ctx, memberId, &models.MessageSearch{Query: "tombstone", Limit: models.DefaultSearchLimit})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 0 {
+		t.Errorf("expected deleted messages to be hidden from search, got %d results", len(results))
+	}
+
+	mentions, err := database.GetMentionedMessages(ctx, memberId, &models.MessageQuery{Limit: models.DefaultMessageLimit})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mentions.Messages) != 0 {
+		t.Errorf("expected deleted messages to be hidden from mentions, got %d messages", len(mentions.Messages))
+	}
+
+	var messageCount int32
+	if err := db.Get(&messageCount, `SELECT message_count FROM channel WHERE id = $1`, channel.ID); err != nil {
+		t.Fatal(err)
+	}
+	if messageCount != 0 {
+		t.Errorf("expected the deleted thread to stop counting towards the channel, got %d messages", messageCount)
+	}
+
+	if _, err := database.GetMessageHistory(ctx, channel.ID, reply.ID, memberId); err != nil {
+		t.Errorf("expected the reply's author to still see its history: %v", err)
+	}
+	if _, err := database.DeleteMessage(ctx, channel.ID, message.ID, authorId); !errors.Is(err, data.ErrMessageNotFound) {
+		t.Errorf("expected deleting the message again to fail with %v, got %v", data.ErrMessageNotFound, err)
+	}
+}
+
+func TestMessageHistoryPermissions(t *testing.T) {
+	database, db := newTestDatabase(t)
+	ctx := context.Background()
+	ownerId := createTestUser(t, db, "owner")
+	authorId := createTestUser(t, db, "author")
+	memberId := createTestUser(t, db, "member")
+	outsiderId := createTestUser(t, db, "outsider")
+	channel := createTestChannel(t, database, db, ownerId, authorId, memberId)
+
+	message, err := database.CreateMessage(ctx, &models.Message{ChannelID: channel.ID, Content: "history"}, authorId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		userId  int32
+		allowed bool
+	}{
+		{"author", authorId, true},
+		{"moderator", ownerId, true},
+		{"member", memberId, false},
+		{"outsider", outsiderId, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := database.GetMessageHistory(ctx, channel.ID, message.ID, test.userId)
+			if test.allowed && err != nil {
+				t.Errorf("expected the history to be readable: %v", err)
+			}
+			if !test.allowed && !errors.Is(err, data.ErrUserLacksPermission) {
+				t.Errorf("expected %v, got %v", data.ErrUserLacksPermission, err)
+			}
+		})
+	}
+}
+
+func TestCreateMessageReplyMustBeInChannel(t *testing.T) {
+	database, db := newTestDatabase(t)
+	ctx := context.Background()
+	userId := createTestUser(t, db, "author")
+	channel := createTestChannel(t, database, db, userId)
+	other, err := database.CreateChannel(ctx, &models.Channel{Name: "other", GuildId: channel.GuildId}, userId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	original, err := database.CreateMessage(ctx, &models.Message{ChannelID: channel.ID, Content: "original"}, userId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reply, err := database.CreateMessage(ctx, &models.Message{ChannelID: channel.ID, Content: "reply", ReplyToId: &original.ID}, userId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.ReplyTo == nil || reply.ReplyTo.Content != "original" {
+		t.Errorf("expected the reply to include the original message, got %+v", reply.ReplyTo)
+	}
+
+	if _, err := database.CreateMessage(ctx, &models.Message{ChannelID: other.ID, Content: "reply", ReplyToId: &original.ID}, userId); !errors.Is(err, data.ErrMessageNotFound) {
+		t.Errorf("expected replying to a message in another channel to fail, got %v", err)
+	}
+
+	if _, err := database.DeleteMessage(ctx, channel.ID, original.ID, userId); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.CreateMessage(ctx, &models.Message{ChannelID: channel.ID, Content: "reply", ReplyToId: &original.ID}, userId); !errors.Is(err, data.ErrMessageNotFound) {
+		t.Errorf("expected replying to a deleted message to fail, got %v", err)
+	}
+
+	var messageCount int32
+	if err := db.Get(&messageCount, `SELECT count(*) FROM message WHERE channel_id IN ($1, $2)`, channel.ID, other.ID); err != nil {
+		t.Fatal(err)
+	}
+	if messageCount != 2 {
+		t.Errorf("expected only the original message and its reply to be stored, got %d messages", messageCount)
+	}
+}
+
+func TestCreateMessageThreadCannotBeNested(t *testing.T) {
+	database, db := newTestDatabase(t)
+	ctx := context.Background()
+	userId := createTestUser(t, db, "author")
+	channel := createTestChannel(t, database, db, userId)
+	other, err := database.CreateChannel(ctx, &models.Channel{Name: "other", GuildId: channel.GuildId}, userId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root, err := database.CreateMessage(ctx, &models.Message{ChannelID: channel.ID, Content: "root"}, userId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	threaded, err := database.CreateMessage(ctx, &models.Message{ChannelID: channel.ID, Content: "threaded", ThreadId: &root.ID}, userId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if threaded.ThreadId == nil || *threaded.ThreadId != root.ID {
+		t.Fatalf("expected the message to be in the thread of %d, got %v", root.ID, threaded.ThreadId)
+	}
+
+	if _, err := database.CreateMessage(ctx, &models.Message{ChannelID: channel.ID, Content: "nested", ThreadId: &threaded.ID}, userId); !errors.Is(err, data.ErrMessageNotFound) {
+		t.Errorf("expected starting a thread from a thread message to fail, got %v", err)
+	}
+	if _, err := database.CreateMessage(ctx, &models.Message{ChannelID: other.ID, Content: "elsewhere", ThreadId: &root.ID}, userId); !errors.Is(err, data.ErrMessageNotFound) {
+		t.Errorf("expected adding to a thread from another channel to fail, got %v", err)
+	}
+
+	participants, err := database.GetThreadParticipants(ctx, channel.ID, root.ID, userId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(participants) != 1 || participants[0].ID != userId {
+		t.Errorf("expected the author to be the only participant, got %+v", participants)
+	}
+}
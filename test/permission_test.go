@@ -0,0 +1,131 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"testing"
+	"tranquility/models"
+)
+
+func TestPermissionHas(t *testing.T) {
+	permissions := models.PermissionViewChannel | models.PermissionSendMessages
+
+	if !permissions.Has(models.PermissionViewChannel) {
+		t.Fatalf("permission set was missing view channel: %b", permissions)
+	}
+	if !permissions.Has(models.PermissionViewChannel | models.PermissionSendMessages) {
+		t.Fatalf("permission set was missing view channel and send messages: %b", permissions)
+	}
+	if permissions.Has(models.PermissionSendMessages | models.PermissionManageChannels) {
+		t.Fatalf("permission set should not have manage channels: %b", permissions)
+	}
+}
+
+func TestPermissionIntents(t *testing.T) {
+	permissions := models.PermissionViewChannel | models.PermissionKickMembers | models.PermissionAdministrator
+
+	intents := permissions.Intents()
+	expected := []models.Permission{models.PermissionViewChannel, models.PermissionKickMembers, models.PermissionAdministrator}
+	if !slices.Equal(intents, expected) {
+		t.Fatalf("intents did not match: got %v, want %v", intents, expected)
+	}
+
+	if len(models.Permission(0).Intents()) != 0 {
+		t.Fatalf("an empty permission should not have any intents")
+	}
+	if len(models.PermissionAll.Intents()) == 0 {
+		t.Fatalf("all permissions should have intents")
+	}
+}
+
+func TestResolvePermissions(t *testing.T) {
+	if permissions := models.ResolvePermissions(true, 0); permissions != models.PermissionAll {
+		t.Fatalf("owner did not receive all permissions: %b", permissions)
+	}
+	if permissions := models.ResolvePermissions(false, models.PermissionAdministrator); permissions != models.PermissionAll {
+		t.Fatalf("administrator did not receive all permissions: %b", permissions)
+	}
+
+	permissions := models.ResolvePermissions(false, models.PermissionKickMembers)
+	if !permissions.Has(models.PermissionDefault | models.PermissionKickMembers) {
+		t.Fatalf("member did not receive default and granted permissions: %b", permissions)
+	}
+	if permissions.Has(models.PermissionBanMembers) {
+		t.Fatalf("member received a permission that was not granted: %b", permissions)
+	}
+}
+
+func TestCanModerate(t *testing.T) {
+	moderator := models.ResolvePermissions(false, models.PermissionKickMembers|models.PermissionBanMembers)
+	member := models.ResolvePermissions(false, 0)
+
+	if !models.CanModerate(false, moderator, false, member) {
+		t.Fatal("a moderator was not able to moderate a member with fewer permissions")
+	}
+	if !models.CanModerate(true, models.PermissionAll, false, models.PermissionAll) {
+		t.Fatal("the owner was not able to moderate an administrator")
+	}
+	if models.CanModerate(false, models.PermissionAll, true, models.PermissionAll) {
+		t.Fatal("an administrator was able to moderate the owner")
+	}
+	if models.CanModerate(false, moderator, false, models.PermissionAll) {
+		t.Fatal("a moderator was able to moderate an administrator")
+	}
+	if models.CanModerate(false, moderator, false, moderator) {
+		t.Fatal("a moderator was able to moderate a member with the same permissions")
+	}
+	// A member with a permission the moderator lacks isn't below them even with fewer permissions overall.
+	other := models.ResolvePermissions(false, models.PermissionManageRoles)
+	if models.CanModerate(false, moderator, false, other) {
+		t.Fatal("a moderator was able to moderate a member with a permission they lack")
+	}
+}
+
+func TestRoleUpdateKeepsMissingPermissions(t *testing.T) {
+	var rename models.RoleUpdate
+	if err := json.Unmarshal([]byte(`{"name": "renamed"}`), &rename); err != nil {
+		t.Fatal(err)
+	}
+	if rename.Permissions != nil {
+		t.Errorf("expected permissions to be left out of a rename, got %d", *rename.Permissions)
+	}
+
+	var clear models.RoleUpdate
+	if err := json.Unmarshal([]byte(`{"permissions": 0}`), &clear); err != nil {
+		t.Fatal(err)
+	}
+	if clear.Permissions == nil || *clear.Permissions != 0 {
+		t.Errorf("expected permissions to be cleared, got %v", clear.Permissions)
+	}
+}
+
+func TestUpdateRoleOnlyReplacesSentPermissions(t *testing.T) {
+	database, db := newTestDatabase(t)
+	ctx := context.Background()
+	ownerId := createTestUser(t, db, "owner")
+	channel := createTestChannel(t, database, db, ownerId)
+
+	permissions := models.PermissionManageMessages | models.PermissionManageRoles
+	role, err := database.CreateRole(ctx, &models.Role{Name: "moderator", GuildId: channel.GuildId, Permissions: permissions})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	renamed, err := database.UpdateRole(ctx, &models.RoleUpdate{ID: role.ID, GuildId: role.GuildId, Name: "renamed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if renamed.Name != "renamed" || renamed.Permissions != permissions {
+		t.Fatalf("expected the rename to keep the permissions, got %+v", renamed)
+	}
+
+	none := models.Permission(0)
+	cleared, err := database.UpdateRole(ctx, &models.RoleUpdate{ID: role.ID, GuildId: role.GuildId, Permissions: &none})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cleared.Name != "renamed" || cleared.Permissions != 0 {
+		t.Fatalf("expected the permissions to be cleared, got %+v", cleared)
+	}
+}
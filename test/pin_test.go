@@ -0,0 +1,65 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"tranquility/data"
+	"tranquility/models"
+)
+
+func TestPinMessageLimit(t *testing.T) {
+	database, db := newTestDatabase(t)
+	ctx := context.Background()
+	userId := createTestUser(t, db, "pinner")
+	channel := createTestChannel(t, database, db, userId)
+
+	messageIds := make([]int32, models.MaxChannelPins+1)
+	for i := range messageIds {
+		message, err := database.CreateMessage(ctx, &models.Message{ChannelID: channel.ID, Content: "pin"}, userId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		messageIds[i] = message.ID
+	}
+
+	for _, messageId := range messageIds[:models.MaxChannelPins] {
+		if _, created, err := database.PinMessage(ctx, channel.ID, messageId, userId); err != nil || !created {
+			t.Fatalf("expected message %d to be pinned, created: %t, err: %v", messageId, created, err)
+		}
+	}
+	last := messageIds[models.MaxChannelPins]
+	if _, _, err := database.PinMessage(ctx, channel.ID, last, userId); !errors.Is(err, data.ErrTooManyPins) {
+		t.Fatalf("expected %v, got %v", data.ErrTooManyPins, err)
+	}
+
+	// Pinning a message again returns the existing pin even when the channel is full.
+	if pin, created, err := database.PinMessage(ctx, channel.ID, messageIds[0], userId); err != nil || created || pin.MessageId != messageIds[0] {
+		t.Fatalf("expected the existing pin, got %+v, created: %t, err: %v", pin, created, err)
+	}
+
+	if _, err := database.UnpinMessage(ctx, channel.ID, messageIds[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.UnpinMessage(ctx, channel.ID, messageIds[0]); !errors.Is(err, data.ErrPinNotFound) {
+		t.Fatalf("expected %v, got %v", data.ErrPinNotFound, err)
+	}
+	if _, created, err := database.PinMessage(ctx, channel.ID, last, userId); err != nil || !created {
+		t.Fatalf("expected a pin to be allowed after unpinning, created: %t, err: %v", created, err)
+	}
+
+	// Deleted messages can't be pinned and stop taking up room.
+	if _, err := database.DeleteMessage(ctx, channel.ID, last, userId); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := database.PinMessage(ctx, channel.ID, last, userId); !errors.Is(err, data.ErrMessageNotFound) {
+		t.Fatalf("expected %v, got %v", data.ErrMessageNotFound, err)
+	}
+	pins, err := database.GetChannelPins(ctx, channel.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pins) != models.MaxChannelPins-1 {
+		t.Fatalf("expected %d pins, got %d", models.MaxChannelPins-1, len(pins))
+	}
+}
@@ -0,0 +1,19 @@
+package test
+
+import (
+	"testing"
+	"tranquility/models"
+)
+
+func TestIsValidPresenceStatus(t *testing.T) {
+	for _, status := range []string{models.PresenceOnline, models.PresenceIdle, models.PresenceDoNotDisturb, models.PresenceOffline} {
+		if !models.IsValidPresenceStatus(status) {
+			t.Errorf("%q should be a valid presence status", status)
+		}
+	}
+	for _, status := range []string{"", "away", "ONLINE"} {
+		if models.IsValidPresenceStatus(status) {
+			t.Errorf("%q should not be a valid presence status", status)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package test
+
+import (
+	"testing"
+	"tranquility/models"
+)
+
+func TestIsValidEmoji(t *testing.T) {
+	valid := []string{"👍", "❤️", "👍🏽", "👨‍👩‍👧", "🇺🇸", "1️⃣", "#️⃣", "🏴󠁧󠁢󠁳󠁣󠁴󠁿"}
+	for _, emoji := range valid {
+		if !models.IsValidEmoji(emoji) {
+			t.Errorf("%q should be a valid emoji", emoji)
+		}
+	}
+
+	invalid := []string{"", "a", "1", "👍a", "<script>", "‍👍", "🏽", "👍👍👍👍👍👍👍👍👍",
+		"👍👍", "😀😀😀", "❤️👍", "🇺🇸🇺🇸", "🇺", "👍‍", "👨‍‍👩", "1️⃣👍"}
+	for _, emoji := range invalid {
+		if models.IsValidEmoji(emoji) {
+			t.Errorf("%q should not be a valid emoji", emoji)
+		}
+	}
+}
@@ -1 +1,126 @@
 package test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+	"tranquility/data"
+	"tranquility/models"
+	"tranquility/services"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+)
+
+// newTestDatabase creates every table in a new schema of the database at TEST_CONNECTION_STRING and drops the
+// schema once the test is done. Tests that need a database are skipped when the variable isn't set.
+func newTestDatabase(t *testing.T) (*data.Postgres, *sqlx.DB) {
+	t.Helper()
+	connectionString := os.Getenv("TEST_CONNECTION_STRING")
+	if connectionString == "" {
+		t.Skip("TEST_CONNECTION_STRING is not set")
+	}
+
+	admin, err := sqlx.Connect("postgres", connectionString)
+	if err != nil {
+		t.Fatalf("unable to connect to the test database: %v", err)
+	}
+	t.Cleanup(func() { admin.Close() })
+
+	schema := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec(fmt.Sprintf("CREATE SCHEMA %s", schema)); err != nil {
+		t.Fatalf("unable to create schema %s: %v", schema, err)
+	}
+	t.Cleanup(func() {
+		if _, err := admin.Exec(fmt.Sprintf("DROP SCHEMA %s CASCADE", schema)); err != nil {
+			t.Errorf("unable to drop schema %s: %v", schema, err)
+		}
+	})
+
+	// Every connection in the pool has to look in the new schema, so it's set as a connection parameter.
+	if strings.Contains(connectionString, "://") {
+		separator := "?"
+		if strings.Contains(connectionString, "?") {
+			separator = "&"
+		}
+		connectionString += separator + "search_path=" + schema
+	} else {
+		connectionString += " search_path=" + schema
+	}
+
+	db, err := sqlx.Connect("postgres", connectionString)
+	if err != nil {
+		t.Fatalf("unable to connect to schema %s: %v", schema, err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	scripts, err := filepath.Glob("../database_scripts/*.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(scripts)
+	for _, script := range scripts {
+		// The first script creates the database itself along with pg_cron, which the tests don't use.
+		if filepath.Base(script) == "0-create_database.sql" {
+			continue
+		}
+		contents, err := os.ReadFile(script)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.Exec(string(contents)); err != nil {
+			t.Fatalf("unable to run %s: %v", filepath.Base(script), err)
+		}
+	}
+
+	database, err := data.CreatePostgres(connectionString, services.NewFileHandler(t.TempDir()), nil, nil, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("unable to create the test database: %v", err)
+	}
+	return database, db
+}
+
+// createTestUser inserts the user directly so tests don't need turnstile to register.
+func createTestUser(t *testing.T, db *sqlx.DB, username string) int32 {
+	t.Helper()
+	var userId int32
+	err := db.QueryRow(
+		`INSERT INTO auth (username, password, email) VALUES ($1, '', $1 || '@example.com') RETURNING id`,
+		username,
+	).Scan(&userId)
+	if err != nil {
+		t.Fatalf("unable to create user %s: %v", username, err)
+	}
+	return userId
+}
+
+// createTestChannel creates a guild owned by the user with a single channel, and adds every member to the guild.
+func createTestChannel(t *testing.T, database *data.Postgres, db *sqlx.DB, ownerId int32, memberIds ...int32) *models.Channel {
+	t.Helper()
+	ctx := context.Background()
+	guild, err := database.CreateGuild(ctx, &models.Guild{Name: "guild"}, ownerId)
+	if err != nil {
+		t.Fatalf("unable to create guild: %v", err)
+	}
+	for _, memberId := range memberIds {
+		if _, err := db.Exec(
+			`INSERT INTO member (user_id, guild_id, user_who_added) VALUES ($1, $2, $3)`,
+			memberId,
+			guild.ID,
+			ownerId,
+		); err != nil {
+			t.Fatalf("unable to add %d to guild %d: %v", memberId, guild.ID, err)
+		}
+	}
+
+	channel, err := database.CreateChannel(ctx, &models.Channel{Name: "general", GuildId: guild.ID}, ownerId)
+	if err != nil {
+		t.Fatalf("unable to create channel: %v", err)
+	}
+	return channel
+}
@@ -0,0 +1,457 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"tranquility/models"
+	"tranquility/services"
+
+	"github.com/coder/websocket"
+)
+
+type discardLogger struct{}
+
+func (discardLogger) INFO(string)    {}
+func (discardLogger) WARNING(string) {}
+func (discardLogger) ERROR(string)   {}
+func (discardLogger) TRACE(string)   {}
+
+// newWebsocketTest starts a websocket server using the broadcaster along with a test server that connects to it.
+// Both are stopped once the test is done.
+func newWebsocketTest(t *testing.T, broadcaster services.WebsocketBroadcaster) (context.Context, *services.WebsocketServer, *httptest.Server, chan *services.WebsocketHandler) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	websocketServer := services.NewWebsocketServer(ctx, discardLogger{}, broadcaster)
+	go websocketServer.Run()
+	server, handlers := newWebsocketTestServer(t, websocketServer)
+	return ctx, websocketServer, server, handlers
+}
+
+// newWebsocketTestServer connects every request to the websocket server as user 1
+// and keeps reading until the client goes away.
+func newWebsocketTestServer(t *testing.T, websocketServer *services.WebsocketServer) (*httptest.Server, chan *services.WebsocketHandler) {
+	handlers := make(chan *services.WebsocketHandler, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			t.Errorf("unable to accept websocket: %v", err)
+			return
+		}
+		defer c.CloseNow()
+
+		handler := websocketServer.NewHandler()
+		if err := handler.Connect(1, c); err != nil {
+			t.Errorf("unable to connect to websocket server: %v", err)
+			return
+		}
+		defer handler.Disconnect(1)
+		handlers <- handler
+
+		for {
+			if _, _, err := c.Read(r.Context()); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, handlers
+}
+
+func dialWebsocket(t *testing.T, ctx context.Context, server *httptest.Server) *websocket.Conn {
+	c, _ := dialWebsocketSession(t, ctx, server)
+	return c
+}
+
+// dialWebsocketSession connects and reads the ready message every connection starts with.
+func dialWebsocketSession(t *testing.T, ctx context.Context, server *httptest.Server) (*websocket.Conn, *models.WebsocketSession) {
+	c, _, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("unable to dial websocket: %v", err)
+	}
+	t.Cleanup(func() { c.CloseNow() })
+
+	ready := readWebsocketMessage(t, ctx, c)
+	if ready.Type != "ready" {
+		t.Fatalf("expected ready as the first message, got %s", ready.Type)
+	}
+	var session models.WebsocketSession
+	if err := json.Unmarshal(ready.Data, &session); err != nil || session.SessionId == "" {
+		t.Fatalf("ready did not contain a session: %v", err)
+	}
+	return c, &session
+}
+
+func readWebsocketMessage(t *testing.T, ctx context.Context, c *websocket.Conn) models.WebsocketMessageWrapper {
+	readContext, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	_, data, err := c.Read(readContext)
+	if err != nil {
+		t.Fatalf("unable to read websocket message: %v", err)
+	}
+	var message models.WebsocketMessageWrapper
+	if err := json.Unmarshal(data, &message); err != nil {
+		t.Fatalf("unable to unmarshal websocket message: %v", err)
+	}
+	return message
+}
+
+func TestWebsocketServerMultipleConnections(t *testing.T) {
+	ctx, websocketServer, server, handlers := newWebsocketTest(t, services.NewMemoryBroadcaster())
+
+	desktop := dialWebsocket(t, ctx, server)
+	desktopHandler := <-handlers
+	mobile := dialWebsocket(t, ctx, server)
+	<-handlers
+
+	message := models.NewWebsocketMessage("message", &models.Message{Content: "hello"})
+	if err := websocketServer.Broadcast(2, message, map[int32]bool{1: true}); err != nil {
+		t.Fatalf("broadcast returned an error: %v", err)
+	}
+	for _, c := range []*websocket.Conn{desktop, mobile} {
+		if received := readWebsocketMessage(t, ctx, c); received.Type != "message" {
+			t.Fatalf("unexpected message type: %s", received.Type)
+		}
+	}
+
+	// Closing one connection should not remove the user's other connections.
+	if err := desktopHandler.Disconnect(1); err != nil {
+		t.Fatalf("disconnecting the first connection returned an error: %v", err)
+	}
+	if err := websocketServer.Broadcast(2, message, map[int32]bool{1: true}); err != nil {
+		t.Fatalf("broadcast after disconnect returned an error: %v", err)
+	}
+	if received := readWebsocketMessage(t, ctx, mobile); received.Type != "message" {
+		t.Fatalf("unexpected message type after disconnect: %s", received.Type)
+	}
+}
+
+func TestWebsocketMessageWrapperReplyAndThread(t *testing.T) {
+	wrapper := models.WebsocketMessageWrapper{
+		Type: "message",
+		Data: []byte(`{"channel_id": 3, "content": "hello", "reply_to_id": 10, "thread_id": 7}`),
+	}
+
+	message, err := wrapper.ToMessage()
+	if err != nil {
+		t.Fatalf("an error occurred while converting wrapper to message: %v", err)
+	}
+	data, ok := message.Data.(*models.Message)
+	if !ok {
+		t.Fatalf("message data was not a message: %T", message.Data)
+	}
+	if data.ReplyToId == nil || *data.ReplyToId != 10 {
+		t.Fatalf("reply_to_id was not read from the message: %v", data.ReplyToId)
+	}
+	if data.ThreadId == nil || *data.ThreadId != 7 {
+		t.Fatalf("thread_id was not read from the message: %v", data.ThreadId)
+	}
+}
+
+func TestWebsocketServerTypingIsRateLimited(t *testing.T) {
+	ctx, websocketServer, server, handlers := newWebsocketTest(t, services.NewMemoryBroadcaster())
+
+	c := dialWebsocket(t, ctx, server)
+	<-handlers
+
+	typing := &models.Typing{ChannelId: 3, UserId: 2, Username: "typer"}
+	for range 2 {
+		if err := websocketServer.StartTyping(typing, map[int32]bool{1: true}); err != nil {
+			t.Fatalf("start typing returned an error: %v", err)
+		}
+	}
+	if received := readWebsocketMessage(t, ctx, c); received.Type != "typing_start" {
+		t.Fatalf("unexpected message type: %s", received.Type)
+	}
+
+	// The second typing_start should not have been relayed, so the next event is the message.
+	if err := websocketServer.Broadcast(2, models.NewWebsocketMessage("message", &models.Message{Content: "hello"}), map[int32]bool{1: true}); err != nil {
+		t.Fatalf("broadcast returned an error: %v", err)
+	}
+	if received := readWebsocketMessage(t, ctx, c); received.Type != "message" {
+		t.Fatalf("typing_start was relayed more than once: %s", received.Type)
+	}
+	websocketServer.StopTyping(2, 3)
+}
+
+func TestWebsocketServerExtendTypingOnlyWithinRelayWindow(t *testing.T) {
+	_, websocketServer, _, _ := newWebsocketTest(t, services.NewMemoryBroadcaster())
+
+	if websocketServer.ExtendTyping(2, 3) {
+		t.Fatal("typing was extended before it was relayed")
+	}
+	if err := websocketServer.StartTyping(&models.Typing{ChannelId: 3, UserId: 2, Username: "typer"}, map[int32]bool{1: true}); err != nil {
+		t.Fatalf("start typing returned an error: %v", err)
+	}
+	if !websocketServer.ExtendTyping(2, 3) {
+		t.Fatal("typing was not extended right after it was relayed")
+	}
+	if websocketServer.ExtendTyping(2, 4) {
+		t.Fatal("typing was extended in a channel it was never relayed in")
+	}
+
+	websocketServer.StopTyping(2, 3)
+	if websocketServer.ExtendTyping(2, 3) {
+		t.Fatal("typing was extended after it stopped")
+	}
+}
+
+func TestWebsocketServerResumeReplaysMissedEvents(t *testing.T) {
+	ctx, websocketServer, server, handlers := newWebsocketTest(t, services.NewMemoryBroadcaster())
+
+	broadcast := func(content string) {
+		message := models.NewWebsocketMessage("message", &models.Message{Content: content})
+		if err := websocketServer.Broadcast(2, message, map[int32]bool{1: true}); err != nil {
+			t.Fatalf("broadcast returned an error: %v", err)
+		}
+	}
+
+	first, session := dialWebsocketSession(t, ctx, server)
+	firstHandler := <-handlers
+	broadcast("before")
+	if received := readWebsocketMessage(t, ctx, first); received.Seq != 1 {
+		t.Fatalf("expected the first event to have seq 1, got %d", received.Seq)
+	}
+
+	// Events sent while the client is away are kept for the session.
+	if err := firstHandler.Disconnect(1); err != nil {
+		t.Fatalf("disconnecting returned an error: %v", err)
+	}
+	broadcast("missed 1")
+	broadcast("missed 2")
+
+	second := dialWebsocket(t, ctx, server)
+	secondHandler := <-handlers
+	broadcast("after reconnect")
+	readWebsocketMessage(t, ctx, second)
+
+	if err := secondHandler.Resume(1, &models.WebsocketSession{SessionId: session.SessionId, Seq: 1}); err != nil {
+		t.Fatalf("resume returned an error: %v", err)
+	}
+	// The event received before resuming is not replayed again.
+	for _, want := range []string{"missed 1", "missed 2"} {
+		received := readWebsocketMessage(t, ctx, second)
+		var message models.Message
+		if err := json.Unmarshal(received.Data, &message); err != nil || message.Content != want {
+			t.Fatalf("expected %q to be replayed, got %s: %s", want, received.Type, received.Data)
+		}
+	}
+	resumed := readWebsocketMessage(t, ctx, second)
+	var resumedSession models.WebsocketSession
+	if err := json.Unmarshal(resumed.Data, &resumedSession); err != nil || resumed.Type != "resumed" || resumedSession.Seq != 4 {
+		t.Fatalf("unexpected resumed message %s: %s", resumed.Type, resumed.Data)
+	}
+
+	broadcast("resumed")
+	if received := readWebsocketMessage(t, ctx, second); received.Seq != 5 {
+		t.Fatalf("expected the session's numbering to continue at 5, got %d", received.Seq)
+	}
+
+	if err := secondHandler.Resume(1, &models.WebsocketSession{SessionId: "unknown", Seq: 1}); err != nil {
+		t.Fatalf("resume returned an error: %v", err)
+	}
+	if received := readWebsocketMessage(t, ctx, second); received.Type != "invalid_session" {
+		t.Fatalf("expected invalid_session for an unknown session, got %s", received.Type)
+	}
+}
+
+func TestWebsocketServerNonceIsDeduplicated(t *testing.T) {
+	ctx, websocketServer, server, handlers := newWebsocketTest(t, services.NewMemoryBroadcaster())
+
+	c := dialWebsocket(t, ctx, server)
+	handler := <-handlers
+
+	if _, claimed := websocketServer.ClaimNonce(1, "abc"); !claimed {
+		t.Fatal("the first use of a nonce was not claimed")
+	}
+	if ack, claimed := websocketServer.ClaimNonce(1, "abc"); claimed || ack != nil {
+		t.Fatalf("a nonce still being handled was claimed again: %v %v", claimed, ack)
+	}
+	if _, claimed := websocketServer.ClaimNonce(2, "abc"); !claimed {
+		t.Fatal("nonces from different users should not collide")
+	}
+
+	ack := &models.WebsocketAck{Nonce: "abc", Type: "message", Data: &models.Message{ID: 9}}
+	websocketServer.CompleteNonce(1, ack)
+	retried, claimed := websocketServer.ClaimNonce(1, "abc")
+	if claimed || retried != ack {
+		t.Fatalf("a retry was not given the original ack: %v %v", claimed, retried)
+	}
+
+	websocketServer.ReleaseNonce(1, "abc")
+	if _, claimed := websocketServer.ClaimNonce(1, "abc"); !claimed {
+		t.Fatal("a released nonce was not able to be claimed again")
+	}
+
+	// Replies only go to the connection and aren't numbered like events.
+	if err := handler.Reply(1, models.NewWebsocketMessage("ack", retried)); err != nil {
+		t.Fatalf("reply returned an error: %v", err)
+	}
+	received := readWebsocketMessage(t, ctx, c)
+	var replied struct {
+		Nonce string `json:"nonce"`
+	}
+	if err := json.Unmarshal(received.Data, &replied); err != nil || received.Type != "ack" || received.Seq != 0 || replied.Nonce != "abc" {
+		t.Fatalf("unexpected reply %s (seq %d): %s", received.Type, received.Seq, received.Data)
+	}
+}
+
+func TestGenerateWebsocketTicket(t *testing.T) {
+	seen := make(map[string]bool)
+	for range 100 {
+		ticket, err := services.GenerateWebsocketTicket()
+		if err != nil {
+			t.Fatalf("an error occurred while generating websocket ticket: %v", err)
+		}
+		if seen[ticket] {
+			t.Fatalf("websocket ticket was generated twice: %s", ticket)
+		}
+		seen[ticket] = true
+
+		// The ticket is looked up by its hash, so it has to hash the same way every time.
+		hash := services.HashWebsocketTicket(ticket)
+		if hash == ticket || hash != services.HashWebsocketTicket(ticket) {
+			t.Fatalf("websocket ticket was not hashed consistently: %s", hash)
+		}
+	}
+}
+
+func TestWebsocketServerResumeClosesReplacedConnection(t *testing.T) {
+	ctx, _, server, handlers := newWebsocketTest(t, services.NewMemoryBroadcaster())
+
+	// The first connection hasn't noticed the client is gone when the session is resumed.
+	first, session := dialWebsocketSession(t, ctx, server)
+	<-handlers
+	second := dialWebsocket(t, ctx, server)
+	secondHandler := <-handlers
+
+	if err := secondHandler.Resume(1, session); err != nil {
+		t.Fatalf("resume returned an error: %v", err)
+	}
+	if received := readWebsocketMessage(t, ctx, second); received.Type != "resumed" {
+		t.Fatalf("expected resumed, got %s", received.Type)
+	}
+
+	readContext, readCancel := context.WithTimeout(ctx, 2*time.Second)
+	defer readCancel()
+	_, _, err := first.Read(readContext)
+	if status := websocket.CloseStatus(err); status != models.CloseSessionReplaced {
+		t.Fatalf("expected the replaced connection to be closed with %d, got %d: %v", models.CloseSessionReplaced, status, err)
+	}
+}
+
+func TestWebsocketServerSubscriptionsFilterTopicEvents(t *testing.T) {
+	ctx, websocketServer, server, handlers := newWebsocketTest(t, services.NewMemoryBroadcaster())
+
+	c := dialWebsocket(t, ctx, server)
+	handler := <-handlers
+	if err := handler.Subscribe(1, true, &models.WebsocketTopic{ChannelIds: []int32{3}}); err != nil {
+		t.Fatalf("subscribe returned an error: %v", err)
+	}
+
+	// Typing in a channel the session isn't viewing is skipped, while messages are always delivered.
+	other := &models.Typing{ChannelId: 4, UserId: 2, Username: "typer"}
+	if err := websocketServer.StartTyping(other, map[int32]bool{1: true}); err != nil {
+		t.Fatalf("start typing returned an error: %v", err)
+	}
+	defer websocketServer.StopTyping(2, 4)
+	if err := websocketServer.Broadcast(2, models.NewWebsocketMessage("message", &models.Message{ChannelID: 4, Content: "hello"}), map[int32]bool{1: true}); err != nil {
+		t.Fatalf("broadcast returned an error: %v", err)
+	}
+	if received := readWebsocketMessage(t, ctx, c); received.Type != "message" || received.Seq != 1 {
+		t.Fatalf("expected the message as the first event, got %s (seq %d)", received.Type, received.Seq)
+	}
+
+	subscribed := &models.Typing{ChannelId: 3, UserId: 2, Username: "typer"}
+	if err := websocketServer.StartTyping(subscribed, map[int32]bool{1: true}); err != nil {
+		t.Fatalf("start typing returned an error: %v", err)
+	}
+	defer websocketServer.StopTyping(2, 3)
+	if received := readWebsocketMessage(t, ctx, c); received.Type != "typing_start" {
+		t.Fatalf("expected typing in the subscribed channel, got %s", received.Type)
+	}
+
+	if err := handler.Subscribe(1, false, &models.WebsocketTopic{ChannelIds: []int32{3}}); err != nil {
+		t.Fatalf("unsubscribe returned an error: %v", err)
+	}
+	tooMany := &models.WebsocketTopic{GuildIds: topicIds(models.MaxWebsocketSubscriptions + 1)}
+	if err := handler.Subscribe(1, true, tooMany); !errors.Is(err, services.ErrTooManySubscriptions) {
+		t.Fatalf("expected too many subscriptions to be rejected, got %v", err)
+	}
+}
+
+// topicIds returns the ids 1 through count.
+func topicIds(count int) []int32 {
+	ids := make([]int32, count)
+	for i := range ids {
+		ids[i] = int32(i + 1)
+	}
+	return ids
+}
+
+func TestWebsocketServerSubscriptionLimitAndReset(t *testing.T) {
+	ctx, websocketServer, server, handlers := newWebsocketTest(t, services.NewMemoryBroadcaster())
+
+	c := dialWebsocket(t, ctx, server)
+	handler := <-handlers
+	full := &models.WebsocketTopic{GuildIds: topicIds(models.MaxWebsocketSubscriptions)}
+	for range 2 {
+		// Sending the same subscriptions again doesn't count them twice.
+		if err := handler.Subscribe(1, true, full); err != nil {
+			t.Fatalf("subscribe returned an error: %v", err)
+		}
+	}
+	if err := handler.Subscribe(1, true, &models.WebsocketTopic{ChannelIds: []int32{3}}); !errors.Is(err, services.ErrTooManySubscriptions) {
+		t.Fatalf("expected a subscription past the limit to be rejected, got %v", err)
+	}
+
+	// Once everything is unsubscribed the session receives every event again.
+	if err := handler.Subscribe(1, false, full); err != nil {
+		t.Fatalf("unsubscribe returned an error: %v", err)
+	}
+	typing := &models.Typing{ChannelId: 3, UserId: 2, Username: "typer"}
+	if err := websocketServer.StartTyping(typing, map[int32]bool{1: true}); err != nil {
+		t.Fatalf("start typing returned an error: %v", err)
+	}
+	defer websocketServer.StopTyping(2, 3)
+	if received := readWebsocketMessage(t, ctx, c); received.Type != "typing_start" {
+		t.Fatalf("expected typing after unsubscribing from everything, got %s", received.Type)
+	}
+}
+
+// failingBroadcaster fails to listen the first time so the server has to listen again.
+type failingBroadcaster struct {
+	*services.MemoryBroadcaster
+	failed chan struct{}
+}
+
+func (f *failingBroadcaster) Listen(ctx context.Context, deliver func(*models.WebsocketEvent)) error {
+	select {
+	case <-f.failed:
+		return f.MemoryBroadcaster.Listen(ctx, deliver)
+	default:
+		close(f.failed)
+		return errors.New("unable to listen")
+	}
+}
+
+func TestWebsocketServerListensAgainAfterBroadcasterFails(t *testing.T) {
+	broadcaster := &failingBroadcaster{services.NewMemoryBroadcaster(), make(chan struct{})}
+	ctx, websocketServer, server, handlers := newWebsocketTest(t, broadcaster)
+
+	c := dialWebsocket(t, ctx, server)
+	<-handlers
+	if err := websocketServer.Broadcast(2, models.NewWebsocketMessage("message", &models.Message{Content: "hello"}), map[int32]bool{1: true}); err != nil {
+		t.Fatalf("broadcast returned an error: %v", err)
+	}
+	if received := readWebsocketMessage(t, ctx, c); received.Type != "message" {
+		t.Fatalf("unexpected message type: %s", received.Type)
+	}
+}